@@ -5,6 +5,7 @@ import (
 
 	"github.com/golang/glog"
 
+	"github.com/dailymotion-oss/osiris/pkg/control"
 	deployments "github.com/dailymotion-oss/osiris/pkg/deployments/activator"
 	"github.com/dailymotion-oss/osiris/pkg/kubernetes"
 	"github.com/dailymotion-oss/osiris/pkg/version"
@@ -22,11 +23,21 @@ func RunActivator(ctx context.Context) {
 		glog.Fatalf("Error building kubernetes clientset: %s", err)
 	}
 
+	dynamicClient, err := kubernetes.DynamicClient()
+	if err != nil {
+		glog.Fatalf("Error building kubernetes dynamic client: %s", err)
+	}
+
 	cfg, err := deployments.GetConfigFromEnvironment()
 	if err != nil {
 		glog.Fatalf("Error getting activator envconfig: %s", err.Error())
 	}
 
+	controlCfg, err := control.GetConfigFromEnvironment()
+	if err != nil {
+		glog.Fatalf("Error getting control envconfig: %s", err.Error())
+	}
+
 	// Run the activator
-	deployments.NewActivator(cfg, client).Run(ctx)
+	deployments.NewActivator(cfg, controlCfg, client, dynamicClient).Run(ctx)
 }
@@ -5,6 +5,7 @@ import (
 
 	"github.com/golang/glog"
 
+	"github.com/dailymotion-oss/osiris/pkg/control"
 	deployments "github.com/dailymotion-oss/osiris/pkg/deployments/zeroscaler"
 	"github.com/dailymotion-oss/osiris/pkg/kubernetes"
 	"github.com/dailymotion-oss/osiris/pkg/version"
@@ -22,11 +23,32 @@ func RunZeroScaler(ctx context.Context) {
 		glog.Fatalf("Error building kubernetes clientset: %s", err.Error())
 	}
 
+	restConfig, err := kubernetes.RestConfig()
+	if err != nil {
+		glog.Fatalf("Error building kubernetes client config: %s", err.Error())
+	}
+
+	metricsClient, err := kubernetes.MetricsClient()
+	if err != nil {
+		glog.Fatalf("Error building kubernetes metrics clientset: %s", err.Error())
+	}
+
 	cfg, err := deployments.GetConfigFromEnvironment()
 	if err != nil {
 		glog.Fatalf("Error getting zeroscaler envconfig: %s", err.Error())
 	}
 
+	controlCfg, err := control.GetConfigFromEnvironment()
+	if err != nil {
+		glog.Fatalf("Error getting control envconfig: %s", err.Error())
+	}
+
 	// Run the zeroscaler
-	deployments.NewZeroscaler(cfg, client).Run(ctx)
+	deployments.NewZeroscaler(
+		cfg,
+		controlCfg,
+		client,
+		metricsClient,
+		restConfig,
+	).Run(ctx)
 }
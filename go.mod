@@ -11,6 +11,7 @@ require (
 	github.com/hashicorp/golang-lru v0.5.4 // indirect
 	github.com/imdario/mergo v0.3.11 // indirect
 	github.com/kelseyhightower/envconfig v1.4.0
+	github.com/prometheus/client_golang v1.7.1
 	github.com/prometheus/client_model v0.2.0
 	github.com/prometheus/common v0.10.0
 	github.com/satori/go.uuid v1.2.0
@@ -21,12 +22,14 @@ require (
 	go.opentelemetry.io/otel/exporters/otlp v0.16.0
 	go.opentelemetry.io/otel/sdk v0.16.0
 	golang.org/x/crypto v0.0.0-20200820211705-5c72a883971a // indirect
+	golang.org/x/net v0.0.0-20201209123823-ac852fbbde11
 	golang.org/x/time v0.0.0-20200630173020-3af7569d3a1e // indirect
 	k8s.io/api v0.19.1
 	k8s.io/apimachinery v0.19.1
 	k8s.io/client-go v1.5.1
 	k8s.io/klog/v2 v2.3.0 // indirect
 	k8s.io/kubernetes v1.19.1
+	k8s.io/metrics v0.19.1
 	k8s.io/utils v0.0.0-20200821003339-5e75c0163111 // indirect
 )
 
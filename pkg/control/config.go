@@ -0,0 +1,33 @@
+package control
+
+import (
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+const envconfigPrefix = "OSIRIS_CONTROL"
+
+// Config represents the configuration options for the watcher of the Osiris
+// control configmap
+// nolint: lll
+type Config struct {
+	ConfigMapNamespace string        `envconfig:"CONFIGMAP_NAMESPACE" default:"osiris-system"`
+	ConfigMapName      string        `envconfig:"CONFIGMAP_NAME" default:"osiris-control"`
+	ResyncInterval     time.Duration `envconfig:"INFORMERS_RESYNC_INTERVAL" required:"true"`
+}
+
+// NewConfigWithDefaults returns a Config object with default values already
+// applied. Callers are then free to set custom values for the remaining fields
+// and/or override default values.
+func NewConfigWithDefaults() Config {
+	return Config{}
+}
+
+// GetConfigFromEnvironment returns configuration derived from environment
+// variables
+func GetConfigFromEnvironment() (Config, error) {
+	c := NewConfigWithDefaults()
+	err := envconfig.Process(envconfigPrefix, &c)
+	return c, err
+}
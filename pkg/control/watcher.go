@@ -0,0 +1,217 @@
+package control
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	k8s "github.com/dailymotion-oss/osiris/pkg/kubernetes"
+)
+
+// keys of the Osiris control configmap
+const (
+	frozenKey            = "frozen"
+	frozenNamespacesKey  = "frozenNamespaces"
+	activatorFailFastKey = "activatorFailFast"
+)
+
+// State represents the content of the Osiris control configmap
+type State struct {
+	// Frozen is true if Osiris must not scale down any workload
+	Frozen bool `json:"frozen"`
+	// FrozenNamespaces are the namespaces in which Osiris must not scale down
+	// any workload
+	FrozenNamespaces []string `json:"frozenNamespaces,omitempty"`
+	// ActivatorFailFast is true if the activator must reject requests
+	// instead of activating workloads while frozen
+	ActivatorFailFast bool `json:"activatorFailFast"`
+}
+
+// IsFrozen checks if Osiris must not scale down workloads of the given
+// namespace.
+func (s State) IsFrozen(namespace string) bool {
+	if s.Frozen {
+		return true
+	}
+	for _, frozenNamespace := range s.FrozenNamespaces {
+		if frozenNamespace == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// Watcher is an interface for a component that watches the Osiris control
+// configmap, used to freeze Osiris cluster-wide or per-namespace.
+type Watcher interface {
+	// Run causes the watcher to watch the Osiris control configmap. This
+	// function will not return until the context it has been passed expires or
+	// is canceled.
+	Run(ctx context.Context)
+	// State returns the current state of the Osiris control configmap
+	State() State
+}
+
+type watcher struct {
+	config    Config
+	informer  cache.SharedIndexInformer
+	state     State
+	stateLock sync.RWMutex
+	recorder  record.EventRecorder
+	// startTime is used to recognize the configmap found on the initial sync,
+	// whose state is not a change worth an event
+	startTime time.Time
+}
+
+// NewWatcher returns a new component that watches the Osiris control
+// configmap. If a recorder is given, it will be used to record events on the
+// configmap when the freeze state changes.
+func NewWatcher(
+	config Config,
+	kubeClient kubernetes.Interface,
+	recorder record.EventRecorder,
+) Watcher {
+	w := &watcher{
+		config: config,
+		informer: k8s.ConfigMapsIndexInformer(
+			kubeClient,
+			config.ConfigMapNamespace,
+			fields.OneTermEqualSelector("metadata.name", config.ConfigMapName),
+			nil,
+			config.ResyncInterval,
+		),
+		recorder:  recorder,
+		startTime: time.Now(),
+	}
+	w.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: w.syncAddedConfigMap,
+		UpdateFunc: func(_, newObj interface{}) {
+			w.syncConfigMap(newObj, true)
+		},
+		DeleteFunc: w.syncDeletedConfigMap,
+	})
+	return w
+}
+
+func (w *watcher) Run(ctx context.Context) {
+	glog.Infof(
+		"Watching Osiris control configmap %s in namespace %s",
+		w.config.ConfigMapName,
+		w.config.ConfigMapNamespace,
+	)
+	w.informer.Run(ctx.Done())
+}
+
+func (w *watcher) State() State {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+	return w.state
+}
+
+// syncAddedConfigMap syncs a configmap that was either created after the
+// watcher started - a state change - or found on the initial sync, in which
+// case no events are recorded: otherwise each restart of an Osiris component
+// would record them again.
+func (w *watcher) syncAddedConfigMap(obj interface{}) {
+	cm, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return
+	}
+	w.syncConfigMap(cm, !cm.CreationTimestamp.Time.Before(w.startTime))
+}
+
+func (w *watcher) syncConfigMap(obj interface{}, recordEvents bool) {
+	cm, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return
+	}
+	state := parseState(cm)
+	w.stateLock.Lock()
+	previousState := w.state
+	w.state = state
+	w.stateLock.Unlock()
+	w.reportStateChange(cm, previousState, state, recordEvents)
+}
+
+// syncDeletedConfigMap ends the freeze, if any: without a configmap, Osiris
+// is not frozen. The events are recorded on the deleted configmap, which is
+// still a valid reference for them.
+func (w *watcher) syncDeletedConfigMap(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	cm, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return
+	}
+	w.stateLock.Lock()
+	previousState := w.state
+	w.state = State{}
+	w.stateLock.Unlock()
+	if previousState.Frozen || len(previousState.FrozenNamespaces) > 0 {
+		glog.Infof("Osiris control configmap has been deleted")
+	}
+	w.reportStateChange(cm, previousState, State{}, true)
+}
+
+// reportStateChange logs the changes between the previous and current
+// states, and records them as events on the configmap if recordEvents is
+// true.
+func (w *watcher) reportStateChange(
+	cm *corev1.ConfigMap,
+	previous State,
+	current State,
+	recordEvents bool,
+) {
+	recordEvent := func(reason, message string) {
+		if recordEvents {
+			w.recordEvent(cm, reason, message)
+		}
+	}
+	switch {
+	case current.Frozen && !previous.Frozen:
+		glog.Infof("Osiris is frozen: workloads won't be scaled down")
+		recordEvent("Frozen", "Osiris is frozen: workloads won't be scaled down")
+	case !current.Frozen && previous.Frozen:
+		glog.Infof("Osiris is no longer frozen")
+		recordEvent("Unfrozen", "Osiris is no longer frozen")
+	}
+	previousNamespaces := strings.Join(previous.FrozenNamespaces, ",")
+	currentNamespaces := strings.Join(current.FrozenNamespaces, ",")
+	if previousNamespaces != currentNamespaces {
+		glog.Infof("Osiris frozen namespaces are now: [%s]", currentNamespaces)
+		recordEvent(
+			"FrozenNamespacesChanged",
+			"Osiris frozen namespaces are now: ["+currentNamespaces+"]",
+		)
+	}
+}
+
+func (w *watcher) recordEvent(cm *corev1.ConfigMap, reason, message string) {
+	if w.recorder == nil {
+		return
+	}
+	w.recorder.Event(cm, corev1.EventTypeNormal, reason, message)
+}
+
+func parseState(cm *corev1.ConfigMap) State {
+	state := State{
+		Frozen:            k8s.BooleanValue(cm.Data, frozenKey),
+		ActivatorFailFast: k8s.BooleanValue(cm.Data, activatorFailFastKey),
+	}
+	for _, namespace := range strings.Split(cm.Data[frozenNamespacesKey], ",") {
+		namespace = strings.TrimSpace(namespace)
+		if len(namespace) > 0 {
+			state.FrozenNamespaces = append(state.FrozenNamespaces, namespace)
+		}
+	}
+	return state
+}
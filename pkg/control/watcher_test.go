@@ -0,0 +1,154 @@
+package control
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestParseState(t *testing.T) {
+	tests := []struct {
+		name             string
+		data             map[string]string
+		expectedState    State
+		frozenNamespaces []string
+		activeNamespaces []string
+	}{
+		{
+			name:             "empty configmap",
+			expectedState:    State{},
+			activeNamespaces: []string{"default", "my-ns"},
+		},
+		{
+			name: "globally frozen",
+			data: map[string]string{
+				frozenKey: "true",
+			},
+			expectedState:    State{Frozen: true},
+			frozenNamespaces: []string{"default", "my-ns"},
+		},
+		{
+			name: "frozen namespaces",
+			data: map[string]string{
+				frozenKey:           "false",
+				frozenNamespacesKey: " my-ns, other-ns ,",
+			},
+			expectedState: State{
+				FrozenNamespaces: []string{"my-ns", "other-ns"},
+			},
+			frozenNamespaces: []string{"my-ns", "other-ns"},
+			activeNamespaces: []string{"default"},
+		},
+		{
+			name: "frozen with activator failing fast",
+			data: map[string]string{
+				frozenKey:            "yes",
+				activatorFailFastKey: "on",
+			},
+			expectedState: State{
+				Frozen:            true,
+				ActivatorFailFast: true,
+			},
+			frozenNamespaces: []string{"default"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := parseState(&corev1.ConfigMap{Data: test.data})
+
+			assert.Equal(t, test.expectedState, actual)
+			for _, namespace := range test.frozenNamespaces {
+				assert.True(t, actual.IsFrozen(namespace), namespace)
+			}
+			for _, namespace := range test.activeNamespaces {
+				assert.False(t, actual.IsFrozen(namespace), namespace)
+			}
+		})
+	}
+}
+
+func TestWatcherEvents(t *testing.T) {
+	startTime := time.Now()
+	frozenData := map[string]string{frozenKey: "true"}
+	tests := []struct {
+		name           string
+		creationTime   time.Time
+		updatedData    map[string]string
+		deletedObj     func(cm *corev1.ConfigMap) interface{}
+		expectedEvents []string
+	}{
+		{
+			name:         "frozen configmap found on the initial sync",
+			creationTime: startTime.Add(-time.Hour),
+		},
+		{
+			name:           "frozen configmap created after the start",
+			creationTime:   startTime.Add(time.Second),
+			expectedEvents: []string{"Normal Frozen"},
+		},
+		{
+			name:           "configmap found on the initial sync and then unfrozen",
+			creationTime:   startTime.Add(-time.Hour),
+			updatedData:    map[string]string{frozenNamespacesKey: "my-ns"},
+			expectedEvents: []string{"Normal Unfrozen", "Normal FrozenNamespacesChanged"},
+		},
+		{
+			name:         "configmap found on the initial sync and then deleted",
+			creationTime: startTime.Add(-time.Hour),
+			deletedObj: func(cm *corev1.ConfigMap) interface{} {
+				return cm
+			},
+			expectedEvents: []string{"Normal Unfrozen"},
+		},
+		{
+			name:         "configmap deleted while the watch was down",
+			creationTime: startTime.Add(-time.Hour),
+			deletedObj: func(cm *corev1.ConfigMap) interface{} {
+				return cache.DeletedFinalStateUnknown{Key: "ns/osiris-control", Obj: cm}
+			},
+			expectedEvents: []string{"Normal Unfrozen"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			w := &watcher{
+				recorder:  recorder,
+				startTime: startTime,
+			}
+			cm := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					CreationTimestamp: metav1.NewTime(test.creationTime),
+				},
+				Data: frozenData,
+			}
+
+			w.syncAddedConfigMap(cm)
+			assert.True(t, w.State().Frozen)
+			if test.updatedData != nil {
+				updatedCM := cm.DeepCopy()
+				updatedCM.Data = test.updatedData
+				w.syncConfigMap(updatedCM, true)
+			}
+			if test.deletedObj != nil {
+				w.syncDeletedConfigMap(test.deletedObj(cm))
+				assert.False(t, w.State().Frozen)
+			}
+
+			close(recorder.Events)
+			var events []string
+			for event := range recorder.Events {
+				events = append(events, strings.Join(strings.Fields(event)[:2], " "))
+			}
+			assert.Equal(t, test.expectedEvents, events)
+		})
+	}
+}
@@ -2,18 +2,22 @@ package activator
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/golang/glog"
 	"github.com/hashicorp/go-multierror"
+	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	k8s_types "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"github.com/dailymotion-oss/osiris/pkg/kubernetes"
 )
 
+var errFrozen = errors.New("Osiris is frozen")
+
 func (a *activator) activate(
 	ctx context.Context,
 	app *app,
@@ -41,6 +45,8 @@ func (a *activator) activate(
 		appActivation, err = a.activateDeployment(ctx, app)
 	case appKindStatefulSet:
 		appActivation, err = a.activateStatefulSet(ctx, app)
+	case appKindDaemonSet:
+		appActivation, err = a.activateDaemonSet(ctx, app)
 	default:
 		return nil, fmt.Errorf("invalid app kind %s", app.Kind)
 	}
@@ -54,6 +60,111 @@ func (a *activator) activate(
 	return appActivation, nil
 }
 
+// getOrStartActivation returns the in-progress activation of the given app, or
+// starts a new one.
+func (a *activator) getOrStartActivation(app *app) (*appActivation, error) {
+	// Are we already activating the deployment/statefulset in question?
+	var err error
+	appKey := getKey(app.Namespace, app.Kind, app.Name)
+	a.appActivationsLock.RLock()
+	appActivation, ok := a.appActivations[appKey]
+	a.appActivationsLock.RUnlock()
+	if ok {
+		glog.Infof(
+			"Found activation in-progress for %s %s in namespace %s",
+			app.Kind,
+			app.Name,
+			app.Namespace,
+		)
+	} else {
+		if state := a.controlWatcher.State(); state.IsFrozen(app.Namespace) &&
+			state.ActivatorFailFast {
+			glog.Infof(
+				"Osiris is frozen; NOT activating %s %s in namespace %s",
+				app.Kind,
+				app.Name,
+				app.Namespace,
+			)
+			return nil, errFrozen
+		}
+		func() {
+			a.appActivationsLock.Lock()
+			defer a.appActivationsLock.Unlock()
+			// Some other goroutine could have initiated activation of this deployment/statefulset
+			// while we were waiting for the lock. Now that we have the lock, do we
+			// still need to do this?
+			appActivation, ok = a.appActivations[appKey]
+			if ok {
+				glog.Infof(
+					"Found activation in-progress for %s %s in namespace %s",
+					app.Kind,
+					app.Name,
+					app.Namespace,
+				)
+				return
+			}
+			glog.Infof(
+				"Found NO activation in-progress for %s %s in namespace %s",
+				app.Kind,
+				app.Name,
+				app.Namespace,
+			)
+			// Initiate activation (or discover that it may already have been started
+			// by another activator process)
+			ctx, cancelFunc := context.WithTimeout(context.Background(), a.activationTimeout)
+			defer cancelFunc()
+			appActivation, err = a.activate(ctx, app)
+			if err != nil {
+				glog.Errorf(
+					"%s activation for %s in namespace %s failed: %s",
+					app.Kind,
+					app.Name,
+					app.Namespace,
+					err,
+				)
+				return
+			}
+			// Add it to the index of in-flight activation
+			a.appActivations[appKey] = appActivation
+			activationsStarted.
+				WithLabelValues(app.Namespace, string(app.Kind), app.Name).
+				Inc()
+			// But remove it from that index when it's complete
+			go func() {
+				deleteActivation := func() {
+					a.appActivationsLock.Lock()
+					defer a.appActivationsLock.Unlock()
+					delete(a.appActivations, appKey)
+				}
+				select {
+				case <-appActivation.successCh:
+					activationsCompleted.
+						WithLabelValues(app.Namespace, string(app.Kind), app.Name).
+						Inc()
+					a.recordActivationDuration(appKey, appActivation)
+					deleteActivation()
+				case <-appActivation.timeoutCh:
+					activationsTimedOut.
+						WithLabelValues(app.Namespace, string(app.Kind), app.Name).
+						Inc()
+					deleteActivation()
+				}
+			}()
+		}()
+		if err != nil {
+			glog.Errorf(
+				"Error activating %s %s in namespace %s: %s",
+				app.Kind,
+				app.Name,
+				app.Namespace,
+				err,
+			)
+			return nil, err
+		}
+	}
+	return appActivation, nil
+}
+
 func (a *activator) activateDeployment(
 	ctx context.Context,
 	app *app,
@@ -67,42 +178,67 @@ func (a *activator) activateDeployment(
 	if err != nil {
 		return nil, err
 	}
-	da := &appActivation{
-		readyAppPodIPs: map[string]struct{}{},
-		successCh:      make(chan struct{}),
-		timeoutCh:      make(chan struct{}),
-	}
+	da := a.newWorkloadActivation(
+		deployment.Annotations,
+		targetReplicas(deployment.Spec.Replicas, deployment.Annotations),
+	)
+	da.scaledFromZero = deployment.Spec.Replicas != nil && *deployment.Spec.Replicas == 0
 	glog.Infof(
 		"Activating deployment %s in namespace %s",
 		app.Name,
 		app.Namespace,
 	)
-	go da.watchForCompletion(
-		a.kubeClient,
+	if !a.watchWorkloadActivation(
+		ctx,
 		app,
+		deployment,
+		da,
 		labels.Set(deployment.Spec.Selector.MatchLabels).AsSelector(),
-	)
+		func(ctx context.Context) error {
+			// the deployment may have been scaled by the previous owner
+			deployment, err := deploymentsClient.Get(ctx, app.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			return a.scaleUpDeployment(ctx, app, deployment)
+		},
+	) {
+		// Another activator replica owns the activation: it scales the deployment
+		return da, nil
+	}
+	return da, a.scaleUpDeployment(ctx, app, deployment)
+}
+
+// scaleUpDeployment scales up the given deployment, if it is scaled to zero.
+func (a *activator) scaleUpDeployment(
+	ctx context.Context,
+	app *app,
+	deployment *appsv1.Deployment,
+) error {
 	if deployment.Spec.Replicas == nil || *deployment.Spec.Replicas > 0 {
 		// We don't need to do this, as it turns out! Scaling is either already
 		// in progress-- perhaps initiated by another process-- or may even be
-		// completed already. Just return dr and allow the caller to move on to
+		// completed already. Just return and allow the caller to move on to
 		// verifying / waiting for this activation to be complete.
-		return da, nil
+		return nil
 	}
-	patches := []kubernetes.PatchOperation{{
-		Op:    "replace",
-		Path:  "/spec/replicas",
-		Value: kubernetes.GetMinReplicas(deployment.Annotations, 1),
-	}}
-	patchesBytes, _ := json.Marshal(patches)
-	_, err = deploymentsClient.Patch(
+	if kubernetes.WorkloadIsPaused(deployment.Annotations) {
+		// Osiris has been asked to leave the number of replicas untouched
+		glog.Infof(
+			"Deployment %s in namespace %s is paused; not scaling it",
+			app.Name,
+			app.Namespace,
+		)
+		return nil
+	}
+	_, err := a.kubeClient.AppsV1().Deployments(app.Namespace).Patch(
 		ctx,
 		app.Name,
-		k8s_types.JSONPatchType,
-		patchesBytes,
+		k8s_types.MergePatchType,
+		kubernetes.ScalePatch(kubernetes.GetMinReplicas(deployment.Annotations, 1)),
 		metav1.PatchOptions{},
 	)
-	return da, err
+	return err
 }
 
 func (a *activator) activateStatefulSet(
@@ -118,40 +254,188 @@ func (a *activator) activateStatefulSet(
 	if err != nil {
 		return nil, err
 	}
-	da := &appActivation{
-		readyAppPodIPs: map[string]struct{}{},
-		successCh:      make(chan struct{}),
-		timeoutCh:      make(chan struct{}),
-	}
+	da := a.newWorkloadActivation(
+		statefulSet.Annotations,
+		targetReplicas(statefulSet.Spec.Replicas, statefulSet.Annotations),
+	)
+	da.scaledFromZero = statefulSet.Spec.Replicas != nil && *statefulSet.Spec.Replicas == 0
 	glog.Infof(
 		"Activating statefulSet %s in namespace %s",
 		app.Name,
 		app.Namespace,
 	)
-	go da.watchForCompletion(
-		a.kubeClient,
+	if !a.watchWorkloadActivation(
+		ctx,
 		app,
+		statefulSet,
+		da,
 		labels.Set(statefulSet.Spec.Selector.MatchLabels).AsSelector(),
-	)
+		func(ctx context.Context) error {
+			// the statefulSet may have been scaled by the previous owner
+			statefulSet, err := statefulSetsClient.Get(ctx, app.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			return a.scaleUpStatefulSet(ctx, app, statefulSet)
+		},
+	) {
+		// Another activator replica owns the activation: it scales the statefulSet
+		return da, nil
+	}
+	return da, a.scaleUpStatefulSet(ctx, app, statefulSet)
+}
+
+// scaleUpStatefulSet scales up the given statefulSet, if it is scaled to zero.
+func (a *activator) scaleUpStatefulSet(
+	ctx context.Context,
+	app *app,
+	statefulSet *appsv1.StatefulSet,
+) error {
 	if statefulSet.Spec.Replicas == nil || *statefulSet.Spec.Replicas > 0 {
 		// We don't need to do this, as it turns out! Scaling is either already
 		// in progress-- perhaps initiated by another process-- or may even be
-		// completed already. Just return dr and allow the caller to move on to
+		// completed already. Just return and allow the caller to move on to
 		// verifying / waiting for this activation to be complete.
+		return nil
+	}
+	if kubernetes.WorkloadIsPaused(statefulSet.Annotations) {
+		// Osiris has been asked to leave the number of replicas untouched
+		glog.Infof(
+			"StatefulSet %s in namespace %s is paused; not scaling it",
+			app.Name,
+			app.Namespace,
+		)
+		return nil
+	}
+	_, err := a.kubeClient.AppsV1().StatefulSets(app.Namespace).Patch(
+		ctx,
+		app.Name,
+		k8s_types.MergePatchType,
+		kubernetes.ScalePatch(kubernetes.GetMinReplicas(statefulSet.Annotations, 1)),
+		metav1.PatchOptions{},
+	)
+	return err
+}
+
+func (a *activator) activateDaemonSet(
+	ctx context.Context,
+	app *app,
+) (*appActivation, error) {
+	daemonSetsClient := a.kubeClient.AppsV1().DaemonSets(app.Namespace)
+	daemonSet, err := daemonSetsClient.Get(
+		ctx,
+		app.Name,
+		metav1.GetOptions{},
+	)
+	if err != nil {
+		return nil, err
+	}
+	// the number of pods of a parked daemonSet is unknown until it is unparked
+	var daemonSetPods int32
+	if !kubernetes.DaemonSetIsParked(daemonSet.Spec.Template.Spec.NodeSelector) {
+		daemonSetPods = daemonSet.Status.DesiredNumberScheduled
+	}
+	da := a.newWorkloadActivation(daemonSet.Annotations, daemonSetPods)
+	da.scaledFromZero = kubernetes.DaemonSetIsParked(daemonSet.Spec.Template.Spec.NodeSelector)
+	glog.Infof(
+		"Activating daemonSet %s in namespace %s",
+		app.Name,
+		app.Namespace,
+	)
+	if !a.watchWorkloadActivation(
+		ctx,
+		app,
+		daemonSet,
+		da,
+		labels.Set(daemonSet.Spec.Selector.MatchLabels).AsSelector(),
+		func(ctx context.Context) error {
+			// the daemonSet may have been unparked by the previous owner
+			daemonSet, err := daemonSetsClient.Get(ctx, app.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			return a.unparkDaemonSet(ctx, app, daemonSet)
+		},
+	) {
+		// Another activator replica owns the activation: it unparks the daemonSet
 		return da, nil
 	}
-	patches := []kubernetes.PatchOperation{{
-		Op:    "replace",
-		Path:  "/spec/replicas",
-		Value: kubernetes.GetMinReplicas(statefulSet.Annotations, 1),
-	}}
-	patchesBytes, _ := json.Marshal(patches)
-	_, err = statefulSetsClient.Patch(
+	return da, a.unparkDaemonSet(ctx, app, daemonSet)
+}
+
+// unparkDaemonSet unparks the given daemonSet, if it is parked.
+func (a *activator) unparkDaemonSet(
+	ctx context.Context,
+	app *app,
+	daemonSet *appsv1.DaemonSet,
+) error {
+	if !kubernetes.DaemonSetIsParked(daemonSet.Spec.Template.Spec.NodeSelector) {
+		// Unparking is either already in progress-- perhaps initiated by another
+		// process-- or may even be completed already.
+		return nil
+	}
+	if kubernetes.WorkloadIsPaused(daemonSet.Annotations) {
+		// Osiris has been asked to leave the daemonSet untouched
+		glog.Infof(
+			"DaemonSet %s in namespace %s is paused; not unparking it",
+			app.Name,
+			app.Namespace,
+		)
+		return nil
+	}
+	patch, err := kubernetes.UnparkPatch(daemonSet.Annotations)
+	if err != nil {
+		return err
+	}
+	_, err = a.kubeClient.AppsV1().DaemonSets(app.Namespace).Patch(
 		ctx,
 		app.Name,
-		k8s_types.JSONPatchType,
-		patchesBytes,
+		k8s_types.MergePatchType,
+		patch,
 		metav1.PatchOptions{},
 	)
-	return da, err
+	return err
+}
+
+// newWorkloadActivation returns a new activation for a workload with the given
+// annotations, which will run the given number of replicas once activated - 0
+// if unknown.
+func (a *activator) newWorkloadActivation(
+	annotations map[string]string,
+	replicas int32,
+) *appActivation {
+	da := newAppActivation()
+	da.timeout = kubernetes.GetActivationTimeout(annotations, a.activationTimeout)
+	da.requiredReadyPods = requiredReadyPods(
+		kubernetes.GetActivationReadyPods(annotations),
+		replicas,
+	)
+	return da
+}
+
+// targetReplicas returns the number of replicas a deployment or statefulSet
+// will run once activated.
+func targetReplicas(replicas *int32, annotations map[string]string) int32 {
+	if replicas == nil {
+		return 1
+	}
+	if *replicas > 0 {
+		return *replicas
+	}
+	return kubernetes.GetMinReplicas(annotations, 1)
+}
+
+// requiredReadyPods returns the number of ready pods required to complete an
+// activation, from the osiris.dm.gg/activationReadyPods annotation value and
+// the number of replicas of the workload - 0 if unknown. It's at least 1, and
+// at most the number of replicas.
+func requiredReadyPods(readyPods intstr.IntOrString, replicas int32) int {
+	required, err := intstr.GetValueFromIntOrPercent(&readyPods, int(replicas), true)
+	if err != nil || required < 1 {
+		return 1
+	}
+	if replicas > 0 && required > int(replicas) {
+		return int(replicas)
+	}
+	return required
 }
@@ -0,0 +1,61 @@
+package activator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestRequiredReadyPods(t *testing.T) {
+	tests := []struct {
+		name           string
+		readyPods      intstr.IntOrString
+		replicas       int32
+		expectedResult int
+	}{
+		{
+			name:           "default",
+			readyPods:      intstr.FromInt(1),
+			replicas:       3,
+			expectedResult: 1,
+		},
+		{
+			name:           "quorum of a statefulset",
+			readyPods:      intstr.FromString("51%"),
+			replicas:       5,
+			expectedResult: 3,
+		},
+		{
+			name:           "all pods",
+			readyPods:      intstr.FromString("100%"),
+			replicas:       2,
+			expectedResult: 2,
+		},
+		{
+			name:           "more pods than replicas",
+			readyPods:      intstr.FromInt(5),
+			replicas:       2,
+			expectedResult: 2,
+		},
+		{
+			name:           "percentage of unknown replicas",
+			readyPods:      intstr.FromString("50%"),
+			replicas:       0,
+			expectedResult: 1,
+		},
+		{
+			name:           "number of unknown replicas",
+			readyPods:      intstr.FromInt(3),
+			replicas:       0,
+			expectedResult: 3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := requiredReadyPods(test.readyPods, test.replicas)
+			assert.Equal(t, test.expectedResult, actual)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package activator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const activationCheckAnnotationName = "osiris.dm.gg/activationCheck"
+
+// activationCheck is an application-level readiness check, run by the
+// activator through the service once the pods of an app are ready: the
+// pending requests are released only once it passes.
+type activationCheck struct {
+	// Path is the HTTP path to request
+	Path string `json:"path"`
+	// ExpectedStatus is the expected HTTP status code. Default to 200.
+	ExpectedStatus int `json:"expectedStatus"`
+	// Port is the service port to request. Default to the port the request
+	// being activated was sent to.
+	Port int `json:"port"`
+	// Interval is the interval between 2 checks, as a golang duration.
+	// Default to 1s.
+	Interval string `json:"interval"`
+
+	interval   time.Duration
+	httpClient *http.Client
+}
+
+// parseActivationCheck parses the activation check defined in the annotations
+// of a service, if any.
+func parseActivationCheck(annotations map[string]string) (*activationCheck, error) {
+	rawCheck, ok := annotations[activationCheckAnnotationName]
+	if !ok {
+		return nil, nil
+	}
+	check := &activationCheck{}
+	if err := json.Unmarshal([]byte(cleanAnnotationValue(rawCheck)), check); err != nil {
+		return nil, err
+	}
+	if len(check.Path) == 0 {
+		return nil, errors.New("missing path")
+	}
+	if check.ExpectedStatus == 0 {
+		check.ExpectedStatus = http.StatusOK
+	}
+	check.interval = time.Second
+	if len(check.Interval) > 0 {
+		interval, err := time.ParseDuration(check.Interval)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid interval %q", check.Interval)
+		}
+		check.interval = interval
+	}
+	check.httpClient = &http.Client{
+		Timeout: 2 * time.Second,
+		// a redirect is a valid answer
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return check, nil
+}
+
+func (c *activationCheck) url(app *app) string {
+	port := app.TargetURL.Port()
+	if c.Port > 0 {
+		port = fmt.Sprintf("%d", c.Port)
+	}
+	return fmt.Sprintf("%s://%s:%s%s", app.TargetURL.Scheme, app.TargetURL.Hostname(), port, c.Path)
+}
+
+// run runs the check once, and returns nil if it passed.
+func (c *activationCheck) run(app *app) error {
+	target := c.url(app)
+	resp, err := c.httpClient.Get(target)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != c.ExpectedStatus {
+		return fmt.Errorf(
+			"received HTTP status %d from %s instead of %d",
+			resp.StatusCode,
+			target,
+			c.ExpectedStatus,
+		)
+	}
+	return nil
+}
+
+// waitForSuccess runs the check until it passes - in which case it returns
+// true - or until the timeout, in which case it returns false.
+func (c *activationCheck) waitForSuccess(
+	app *app,
+	timeoutCh <-chan time.Time,
+) bool {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		err := c.run(app)
+		if err == nil {
+			return true
+		}
+		glog.Infof(
+			"Activation check of %s %s in namespace %s didn't pass yet: %s",
+			app.Kind,
+			app.Name,
+			app.Namespace,
+			err,
+		)
+		select {
+		case <-ticker.C:
+		case <-timeoutCh:
+			return false
+		}
+	}
+}
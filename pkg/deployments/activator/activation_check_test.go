@@ -0,0 +1,113 @@
+package activator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseActivationCheck(t *testing.T) {
+	tests := []struct {
+		name           string
+		annotations    map[string]string
+		expectedResult *activationCheck
+		expectedError  bool
+	}{
+		{
+			name: "no activation check",
+		},
+		{
+			name: "path only",
+			annotations: map[string]string{
+				activationCheckAnnotationName: `{"path": "/ready"}`,
+			},
+			expectedResult: &activationCheck{
+				Path:           "/ready",
+				ExpectedStatus: 200,
+				interval:       time.Second,
+			},
+		},
+		{
+			name: "full activation check",
+			annotations: map[string]string{
+				activationCheckAnnotationName: `{"path": "/warm", "expectedStatus": 204, "port": 8080, "interval": "5s"}`,
+			},
+			expectedResult: &activationCheck{
+				Path:           "/warm",
+				ExpectedStatus: 204,
+				Port:           8080,
+				Interval:       "5s",
+				interval:       5 * time.Second,
+			},
+		},
+		{
+			name: "missing path",
+			annotations: map[string]string{
+				activationCheckAnnotationName: `{"expectedStatus": 204}`,
+			},
+			expectedError: true,
+		},
+		{
+			name: "invalid interval",
+			annotations: map[string]string{
+				activationCheckAnnotationName: `{"path": "/ready", "interval": "5"}`,
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := parseActivationCheck(test.annotations)
+
+			if test.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if actual != nil {
+				actual.httpClient = nil
+			}
+			assert.Equal(t, test.expectedResult, actual)
+		})
+	}
+}
+
+func TestActivationCheckWaitForSuccess(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ready" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// the cache is warm after the third request
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	targetURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	app := &app{Namespace: "ns", Name: "my-app", Kind: appKindDeployment, TargetURL: targetURL}
+
+	check, err := parseActivationCheck(map[string]string{
+		activationCheckAnnotationName: `{"path": "/ready", "expectedStatus": 204, "interval": "10ms"}`,
+	})
+	require.NoError(t, err)
+	assert.True(t, check.waitForSuccess(app, time.After(5*time.Second)))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	check, err = parseActivationCheck(map[string]string{
+		activationCheckAnnotationName: `{"path": "/missing", "interval": "10ms"}`,
+	})
+	require.NoError(t, err)
+	assert.False(t, check.waitForSuccess(app, time.After(50*time.Millisecond)))
+}
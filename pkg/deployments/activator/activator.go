@@ -4,16 +4,24 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"os"
 	"sync"
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	uuid "github.com/satori/go.uuid"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 
+	"github.com/dailymotion-oss/osiris/pkg/control"
 	"github.com/dailymotion-oss/osiris/pkg/healthz"
 	k8s "github.com/dailymotion-oss/osiris/pkg/kubernetes"
 )
@@ -23,35 +31,68 @@ type Activator interface {
 }
 
 type activator struct {
-	kubeClient           kubernetes.Interface
-	servicesInformer     cache.SharedIndexInformer
-	nodeInformer         cache.SharedIndexInformer
-	deploymentsInformer  cache.SharedIndexInformer
-	statefulSetsInformer cache.SharedIndexInformer
-	services             map[string]*corev1.Service
-	deployments          map[string]*appsv1.Deployment
-	statefulSets         map[string]*appsv1.StatefulSet
-	nodeAddresses        map[string]struct{}
-	appsByHost           map[string]*app
-	indicesLock          sync.RWMutex
-	appActivations       map[string]*appActivation
-	appActivationsLock   sync.RWMutex
-	appActivationTimeout time.Duration
-	srv                  *http.Server
-	internalSrv          *http.Server
+	kubeClient              kubernetes.Interface
+	identity                string
+	servicesInformer        cache.SharedIndexInformer
+	nodeInformer            cache.SharedIndexInformer
+	deploymentsInformer     cache.SharedIndexInformer
+	statefulSetsInformer    cache.SharedIndexInformer
+	daemonSetsInformer      cache.SharedIndexInformer
+	ingressesInformer       cache.SharedIndexInformer
+	httpRoutesInformer      cache.SharedIndexInformer
+	referenceGrantsInformer cache.SharedIndexInformer
+	services                map[string]*corev1.Service
+	deployments             map[string]*appsv1.Deployment
+	statefulSets            map[string]*appsv1.StatefulSet
+	daemonSets              map[string]*appsv1.DaemonSet
+	ingresses               map[string]*networkingv1.Ingress
+	httpRoutes              map[string]*httpRoute
+	referenceGrants         map[string]*referenceGrant
+	nodeAddresses           map[string]struct{}
+	appsByHost              map[string]*app
+	tlsAppsByHost           map[string]*app
+	tcpAppsByPort           map[int32]*app
+	tcpPortsChangedCh       chan struct{}
+	discovery               discoveryState
+	indicesLock             sync.RWMutex
+	appActivations          map[string]*appActivation
+	appActivationsLock      sync.RWMutex
+	activationTimeout       time.Duration
+	activationDurations     map[string]time.Duration
+	maxQueuedRequests       int
+	maxRequestWait          time.Duration
+	controlWatcher          control.Watcher
+	wakingUpPageTemplates   *wakingUpPageTemplatesCache
+	srv                     *http.Server
+	internalSrv             *http.Server
+	tlsPassthroughAddr      string
 }
 
-func NewActivator(cfg Config, kubeClient kubernetes.Interface) Activator {
+func NewActivator(
+	cfg Config,
+	controlCfg control.Config,
+	kubeClient kubernetes.Interface,
+	dynamicClient dynamic.Interface,
+) Activator {
 	const (
-		port         = 5000
-		internalPort = 5002
+		port               = 5000
+		internalPort       = 5002
+		tlsPassthroughPort = 5003
 	)
 	var (
 		mux         = http.NewServeMux()
 		internalMux = http.NewServeMux()
 	)
+	// the identity of this activator replica, as the holder of the activation
+	// leases
+	hostname, err := os.Hostname()
+	if err != nil {
+		glog.Errorf("Error retrieving hostname: %s", err)
+	}
 	a := &activator{
-		kubeClient: kubeClient,
+		kubeClient:            kubeClient,
+		identity:              fmt.Sprintf("%s_%s", hostname, uuid.NewV4()),
+		wakingUpPageTemplates: newWakingUpPageTemplatesCache(kubeClient),
 		servicesInformer: k8s.ServicesIndexInformer(
 			kubeClient,
 			metav1.NamespaceAll,
@@ -80,21 +121,43 @@ func NewActivator(cfg Config, kubeClient kubernetes.Interface) Activator {
 			nil,
 			cfg.ResyncInterval,
 		),
-		services:      map[string]*corev1.Service{},
-		deployments:   map[string]*appsv1.Deployment{},
-		statefulSets:  map[string]*appsv1.StatefulSet{},
-		nodeAddresses: map[string]struct{}{},
+		daemonSetsInformer: k8s.DaemonSetsIndexInformer(
+			kubeClient,
+			metav1.NamespaceAll,
+			nil,
+			nil,
+			cfg.ResyncInterval,
+		),
+		services:        map[string]*corev1.Service{},
+		deployments:     map[string]*appsv1.Deployment{},
+		statefulSets:    map[string]*appsv1.StatefulSet{},
+		daemonSets:      map[string]*appsv1.DaemonSet{},
+		ingresses:       map[string]*networkingv1.Ingress{},
+		httpRoutes:      map[string]*httpRoute{},
+		referenceGrants: map[string]*referenceGrant{},
+		nodeAddresses:   map[string]struct{}{},
 		srv: &http.Server{
-			Addr:    fmt.Sprintf(":%d", port),
-			Handler: mux,
+			Addr: fmt.Sprintf(":%d", port),
+			// Accept HTTP/2 over cleartext (h2c) - for gRPC clients - in addition
+			// to HTTP/1.1
+			Handler: h2c.NewHandler(mux, &http2.Server{}),
 		},
 		internalSrv: &http.Server{
 			Addr:    fmt.Sprintf(":%d", internalPort),
 			Handler: internalMux,
 		},
-		appsByHost:           map[string]*app{},
-		appActivations:       map[string]*appActivation{},
-		appActivationTimeout: 5 * time.Minute,
+		tlsPassthroughAddr:  fmt.Sprintf(":%d", tlsPassthroughPort),
+		appsByHost:          map[string]*app{},
+		tlsAppsByHost:       map[string]*app{},
+		tcpAppsByPort:       map[int32]*app{},
+		tcpPortsChangedCh:   make(chan struct{}, 1),
+		appActivations:      map[string]*appActivation{},
+		activationTimeout:   cfg.ActivationTimeout,
+		activationDurations: map[string]time.Duration{},
+		maxQueuedRequests:   cfg.MaxQueuedRequests,
+		maxRequestWait:      cfg.MaxRequestWait,
+		// events about the freeze state are recorded by the zeroscaler
+		controlWatcher: control.NewWatcher(controlCfg, kubeClient, nil),
 	}
 	a.servicesInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: a.syncService,
@@ -124,9 +187,68 @@ func NewActivator(cfg Config, kubeClient kubernetes.Interface) Activator {
 		},
 		DeleteFunc: a.syncDeletedStatefulSet,
 	})
+	a.daemonSetsInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: a.syncDaemonSet,
+		UpdateFunc: func(_, newObj interface{}) {
+			a.syncDaemonSet(newObj)
+		},
+		DeleteFunc: a.syncDeletedDaemonSet,
+	})
+	if cfg.IngressDiscovery {
+		a.ingressesInformer = k8s.IngressesIndexInformer(
+			kubeClient,
+			metav1.NamespaceAll,
+			nil,
+			nil,
+			cfg.ResyncInterval,
+		)
+		a.ingressesInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: a.syncIngress,
+			UpdateFunc: func(_, newObj interface{}) {
+				a.syncIngress(newObj)
+			},
+			DeleteFunc: a.syncDeletedIngress,
+		})
+	}
+	if cfg.GatewayAPIDiscovery {
+		a.httpRoutesInformer = k8s.HTTPRoutesIndexInformer(
+			dynamicClient,
+			metav1.NamespaceAll,
+			nil,
+			nil,
+			cfg.ResyncInterval,
+		)
+		a.httpRoutesInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: a.syncHTTPRoute,
+			UpdateFunc: func(_, newObj interface{}) {
+				a.syncHTTPRoute(newObj)
+			},
+			DeleteFunc: a.syncDeletedHTTPRoute,
+		})
+		// the cross-namespace backends of the HTTPRoutes must be allowed by a
+		// ReferenceGrant in the namespace of the service
+		a.referenceGrantsInformer = k8s.ReferenceGrantsIndexInformer(
+			dynamicClient,
+			metav1.NamespaceAll,
+			nil,
+			nil,
+			cfg.ResyncInterval,
+		)
+		a.referenceGrantsInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: a.syncReferenceGrant,
+			UpdateFunc: func(_, newObj interface{}) {
+				a.syncReferenceGrant(newObj)
+			},
+			DeleteFunc: a.syncDeletedReferenceGrant,
+		})
+	}
 	mux.HandleFunc("/", a.handleRequest)
 	internalMux.HandleFunc("/", a.printInternalIndicesState)
 	internalMux.HandleFunc("/services", a.printInternalServicesState)
+	internalMux.HandleFunc("/control", a.printInternalControlState)
+	internalMux.HandleFunc("/queues", a.printInternalQueuesState)
+	internalMux.HandleFunc("/discovery", a.printInternalDiscoveryState)
+	internalMux.Handle("/metrics", promhttp.Handler())
 	return a
 }
 
@@ -153,6 +275,32 @@ func (a *activator) Run(ctx context.Context) {
 		a.statefulSetsInformer.Run(ctx.Done())
 		cancel()
 	}()
+	go func() {
+		a.daemonSetsInformer.Run(ctx.Done())
+		cancel()
+	}()
+	if a.ingressesInformer != nil {
+		go func() {
+			a.ingressesInformer.Run(ctx.Done())
+			cancel()
+		}()
+	}
+	if a.httpRoutesInformer != nil {
+		go func() {
+			a.httpRoutesInformer.Run(ctx.Done())
+			cancel()
+		}()
+	}
+	if a.referenceGrantsInformer != nil {
+		go func() {
+			a.referenceGrantsInformer.Run(ctx.Done())
+			cancel()
+		}()
+	}
+	go func() {
+		a.controlWatcher.Run(ctx)
+		cancel()
+	}()
 	go func() {
 		glog.Infof(
 			"Activator server is listening on %s, proxying all deactivated, Osiris-enabled applications",
@@ -163,6 +311,17 @@ func (a *activator) Run(ctx context.Context) {
 			cancel()
 		}
 	}()
+	go func() {
+		glog.Infof(
+			"Activator TLS passthrough server is listening on %s, proxying all deactivated, Osiris-enabled TLS applications",
+			a.tlsPassthroughAddr,
+		)
+		if err := a.runTLSPassthroughServer(ctx); err != nil {
+			glog.Errorf("TLS passthrough server error: %s", err)
+			cancel()
+		}
+	}()
+	go a.runTCPServers(ctx)
 	go func() {
 		glog.Infof("Activator internal server is listening on %s", a.internalSrv.Addr)
 		if err := a.runServer(ctx, a.internalSrv); err != nil {
@@ -272,3 +431,27 @@ func (a *activator) syncDeletedStatefulSet(obj interface{}) {
 	delete(a.statefulSets, statefulSetKey)
 	a.updateIndex()
 }
+
+func (a *activator) syncDaemonSet(obj interface{}) {
+	daemonSet, ok := obj.(*appsv1.DaemonSet)
+	if !ok {
+		return
+	}
+	daemonSetKey := getKey(daemonSet.Namespace, appKindDaemonSet, daemonSet.Name)
+	a.indicesLock.Lock()
+	defer a.indicesLock.Unlock()
+	a.daemonSets[daemonSetKey] = daemonSet
+	a.updateIndex()
+}
+
+func (a *activator) syncDeletedDaemonSet(obj interface{}) {
+	daemonSet, ok := obj.(*appsv1.DaemonSet)
+	if !ok {
+		return
+	}
+	daemonSetKey := getKey(daemonSet.Namespace, appKindDaemonSet, daemonSet.Name)
+	a.indicesLock.Lock()
+	defer a.indicesLock.Unlock()
+	delete(a.daemonSets, daemonSetKey)
+	a.updateIndex()
+}
@@ -3,6 +3,7 @@ package activator
 import (
 	"net/http/httputil"
 	"net/url"
+	"time"
 )
 
 type appKind string
@@ -10,14 +11,30 @@ type appKind string
 const (
 	appKindDeployment  appKind = "Deployment"
 	appKindStatefulSet appKind = "StatefulSet"
+	appKindDaemonSet   appKind = "DaemonSet"
 )
 
 type app struct {
-	Namespace           string
-	ServiceName         string
-	Name                string
-	Kind                appKind
-	Dependencies        []*app
-	TargetURL           *url.URL
+	Namespace    string
+	ServiceName  string
+	Name         string
+	Kind         appKind
+	Dependencies []*app
+	TargetURL    *url.URL
+	// MaxQueuedRequests is the maximum number of requests waiting for the
+	// activation of the app. 0 means no limit.
+	MaxQueuedRequests int
+	// MaxRequestWait is how long a request waits for the activation of the
+	// app, before being rejected. 0 means no limit.
+	MaxRequestWait time.Duration
+	// WakingUpPage enables answering the browser requests with a waking up
+	// page during the activation of the app.
+	WakingUpPage bool
+	// WakingUpPageTemplate is the name of the ConfigMap holding the template
+	// of the waking up page. Empty for the default template.
+	WakingUpPageTemplate string
+	// ActivationCheck is an optional HTTP check the app must pass before the
+	// requests are released.
+	ActivationCheck     *activationCheck
 	proxyRequestHandler *httputil.ReverseProxy
 }
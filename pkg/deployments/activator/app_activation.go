@@ -15,14 +15,46 @@ import (
 	k8s "github.com/dailymotion-oss/osiris/pkg/kubernetes"
 )
 
+// defaultActivationTimeout is how long an activation waits for the app to be
+// ready, when the app doesn't define its own timeout.
+const defaultActivationTimeout = 2 * time.Minute
+
 type appActivation struct {
-	readyAppPodIPs map[string]struct{}
-	endpoints      *corev1.Endpoints
-	lock           sync.Mutex
-	done           bool
-	successCh      chan struct{}
-	timeoutCh      chan struct{}
-	dependencies   []*appActivation
+	startTime      time.Time
+	queuedRequests int32
+	// timeout is how long to wait for the app to be ready
+	timeout time.Duration
+	// requiredReadyPods is the number of ready pods in the endpoints required
+	// to complete the activation
+	requiredReadyPods int
+	readyAppPodIPs    map[string]struct{}
+	endpoints         *corev1.Endpoints
+	lock              sync.Mutex
+	done              bool
+	// podsReadyCh is closed once enough ready pods are in service. The
+	// activation is complete - successCh is closed - once the app also passes
+	// its activation check, if any.
+	podsReadyCh  chan struct{}
+	successCh    chan struct{}
+	timeoutCh    chan struct{}
+	dependencies []*appActivation
+	// scaledFromZero is true if the app was scaled to zero - or parked - when
+	// the activation started, so that its first forward is a cold start
+	scaledFromZero bool
+	// firstForward records the cold start latency only once
+	firstForward sync.Once
+}
+
+func newAppActivation() *appActivation {
+	return &appActivation{
+		startTime:         time.Now(),
+		timeout:           defaultActivationTimeout,
+		requiredReadyPods: 1,
+		readyAppPodIPs:    map[string]struct{}{},
+		podsReadyCh:       make(chan struct{}),
+		successCh:         make(chan struct{}),
+		timeoutCh:         make(chan struct{}),
+	}
 }
 
 func (a *appActivation) watchForCompletion(
@@ -66,23 +98,53 @@ func (a *appActivation) watchForCompletion(
 	})
 	go podsInformer.Run(ctx.Done())
 	go endpointsInformer.Run(ctx.Done())
-	timer := time.NewTimer(2 * time.Minute)
+	timer := time.NewTimer(a.timeout)
 	defer timer.Stop()
-	for {
-		select {
-		case <-a.successCh:
-			return
-		case <-timer.C:
-			glog.Errorf(
-				"Activation of %s %s in namespace %s timed out",
-				app.Kind,
-				app.Name,
-				app.Namespace,
-			)
-			close(a.timeoutCh)
+	timedOut := func() {
+		glog.Errorf(
+			"Activation of %s %s in namespace %s timed out after %s",
+			app.Kind,
+			app.Name,
+			app.Namespace,
+			a.timeout,
+		)
+		close(a.timeoutCh)
+	}
+	select {
+	case <-a.podsReadyCh:
+	case <-timer.C:
+		timedOut()
+		return
+	}
+	podsReadyDuration := time.Since(a.startTime)
+	glog.Infof(
+		"Pods of %s %s in namespace %s are ready after %s",
+		app.Kind,
+		app.Name,
+		app.Namespace,
+		podsReadyDuration,
+	)
+	if app.ActivationCheck != nil {
+		if !app.ActivationCheck.waitForSuccess(app, timer.C) {
+			timedOut()
 			return
 		}
+		glog.Infof(
+			"Activation check of %s %s in namespace %s passed after %s",
+			app.Kind,
+			app.Name,
+			app.Namespace,
+			time.Since(a.startTime)-podsReadyDuration,
+		)
 	}
+	close(a.successCh)
+	glog.Infof(
+		"Activation of %s %s in namespace %s completed in %s",
+		app.Kind,
+		app.Name,
+		app.Namespace,
+		time.Since(a.startTime),
+	)
 }
 
 func (a *appActivation) syncPod(obj interface{}) {
@@ -115,18 +177,20 @@ func (a *appActivation) syncEndpoints(obj interface{}) {
 }
 
 func (a *appActivation) checkActivationComplete() {
-	if a.endpoints != nil {
-		for _, subset := range a.endpoints.Subsets {
-			for _, address := range subset.Addresses {
-				if _, ok := a.readyAppPodIPs[address.IP]; ok {
-					glog.Infof("App pod with ip %s is in service", address.IP)
-					if !a.done {
-						close(a.successCh)
-						a.done = true
-					}
-					return
-				}
+	if a.endpoints == nil || a.done {
+		return
+	}
+	var inService int
+	for _, subset := range a.endpoints.Subsets {
+		for _, address := range subset.Addresses {
+			if _, ok := a.readyAppPodIPs[address.IP]; ok {
+				glog.Infof("App pod with ip %s is in service", address.IP)
+				inService++
 			}
 		}
 	}
+	if inService >= a.requiredReadyPods {
+		close(a.podsReadyCh)
+		a.done = true
+	}
 }
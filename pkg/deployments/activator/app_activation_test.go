@@ -0,0 +1,77 @@
+package activator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestCheckActivationComplete(t *testing.T) {
+	endpoints := &corev1.Endpoints{
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: []corev1.EndpointAddress{
+				{IP: "10.0.0.1"},
+				{IP: "10.0.0.2"},
+				{IP: "10.0.0.3"},
+			},
+		}},
+	}
+
+	tests := []struct {
+		name              string
+		requiredReadyPods int
+		readyAppPodIPs    []string
+		endpoints         *corev1.Endpoints
+		expectedDone      bool
+	}{
+		{
+			name:              "no endpoints yet",
+			requiredReadyPods: 1,
+			readyAppPodIPs:    []string{"10.0.0.1"},
+			expectedDone:      false,
+		},
+		{
+			name:              "one ready pod in service",
+			requiredReadyPods: 1,
+			readyAppPodIPs:    []string{"10.0.0.1"},
+			endpoints:         endpoints,
+			expectedDone:      true,
+		},
+		{
+			name:              "not enough ready pods in service",
+			requiredReadyPods: 2,
+			readyAppPodIPs:    []string{"10.0.0.1", "10.0.0.4"},
+			endpoints:         endpoints,
+			expectedDone:      false,
+		},
+		{
+			name:              "quorum of ready pods in service",
+			requiredReadyPods: 2,
+			readyAppPodIPs:    []string{"10.0.0.1", "10.0.0.3"},
+			endpoints:         endpoints,
+			expectedDone:      true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			activation := newAppActivation()
+			activation.requiredReadyPods = test.requiredReadyPods
+			activation.endpoints = test.endpoints
+			for _, ip := range test.readyAppPodIPs {
+				activation.readyAppPodIPs[ip] = struct{}{}
+			}
+
+			activation.checkActivationComplete()
+
+			assert.Equal(t, test.expectedDone, activation.done)
+			select {
+			case <-activation.podsReadyCh:
+				assert.True(t, test.expectedDone)
+			default:
+				assert.False(t, test.expectedDone)
+			}
+		})
+	}
+}
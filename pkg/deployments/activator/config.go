@@ -11,7 +11,16 @@ const envconfigPrefix = "ACTIVATOR"
 // Config represents the configuration options for activator
 // nolint: lll
 type Config struct {
-	ResyncInterval time.Duration `envconfig:"INFORMERS_RESYNC_INTERVAL" required:"true"`
+	ResyncInterval    time.Duration `envconfig:"INFORMERS_RESYNC_INTERVAL" required:"true"`
+	MaxQueuedRequests int           `envconfig:"MAX_QUEUED_REQUESTS" default:"100"`
+	MaxRequestWait    time.Duration `envconfig:"MAX_REQUEST_WAIT" default:"0"`
+	ActivationTimeout time.Duration `envconfig:"ACTIVATION_TIMEOUT" default:"2m"`
+	// IngressDiscovery enables the discovery of the hosts of the services from
+	// the Ingresses
+	IngressDiscovery bool `envconfig:"INGRESS_DISCOVERY" default:"true"`
+	// GatewayAPIDiscovery enables the discovery of the hosts of the services
+	// from the Gateway API HTTPRoutes - which requires the Gateway API CRDs
+	GatewayAPIDiscovery bool `envconfig:"GATEWAY_API_DISCOVERY" default:"false"`
 }
 
 // NewConfigWithDefaults returns a Config object with default values already
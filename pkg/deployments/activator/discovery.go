@@ -0,0 +1,441 @@
+package activator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// httpRoute is the subset of a Gateway API HTTPRoute we need to discover the
+// hosts of the services
+type httpRoute struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		Hostnames []string `json:"hostnames"`
+		Rules     []struct {
+			BackendRefs []struct {
+				Group     *string `json:"group"`
+				Kind      *string `json:"kind"`
+				Name      string  `json:"name"`
+				Namespace *string `json:"namespace"`
+				Port      *int32  `json:"port"`
+			} `json:"backendRefs"`
+		} `json:"rules"`
+	} `json:"spec"`
+}
+
+// referenceGrant is the subset of a Gateway API ReferenceGrant we need to
+// allow the cross-namespace backends of the HTTPRoutes
+type referenceGrant struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		From []struct {
+			Group     string `json:"group"`
+			Kind      string `json:"kind"`
+			Namespace string `json:"namespace"`
+		} `json:"from"`
+		To []struct {
+			Group string  `json:"group"`
+			Kind  string  `json:"kind"`
+			Name  *string `json:"name"`
+		} `json:"to"`
+	} `json:"spec"`
+}
+
+// allowsHTTPRouteBackend returns true if the grant allows the HTTPRoutes of
+// the given namespace to reference the given service of its own namespace
+func (g *referenceGrant) allowsHTTPRouteBackend(routeNamespace string, service string) bool {
+	fromAllowed := false
+	for _, from := range g.Spec.From {
+		if from.Group == gatewayAPIGroup &&
+			from.Kind == "HTTPRoute" &&
+			from.Namespace == routeNamespace {
+			fromAllowed = true
+			break
+		}
+	}
+	if !fromAllowed {
+		return false
+	}
+	for _, to := range g.Spec.To {
+		if len(to.Group) == 0 &&
+			to.Kind == "Service" &&
+			(to.Name == nil || len(*to.Name) == 0 || *to.Name == service) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostBackend is a host routed to a service port by an Ingress or an
+// HTTPRoute
+type hostBackend struct {
+	host      string
+	source    string
+	namespace string
+	service   string
+	// port is the number or the name of the service port
+	port string
+}
+
+// discoveredRoute is a host routed to an Osiris-enabled service, discovered
+// from an Ingress or an HTTPRoute
+type discoveredRoute struct {
+	Host    string `json:"host"`
+	Source  string `json:"source"`
+	Service string `json:"service"`
+}
+
+// discoveryConflict is a discovered host that was not indexed, because it is
+// already routed to another service - either by an annotation, or by another
+// Ingress or HTTPRoute
+type discoveryConflict struct {
+	Host               string `json:"host"`
+	Source             string `json:"source"`
+	Service            string `json:"service"`
+	ConflictingService string `json:"conflictingService"`
+}
+
+// discoveryState is the result of the discovery of the hosts, as served by
+// the internal server
+type discoveryState struct {
+	Routes    []discoveredRoute   `json:"routes"`
+	Conflicts []discoveryConflict `json:"conflicts"`
+}
+
+const gatewayAPIGroup = "gateway.networking.k8s.io"
+
+func servicePortKey(namespace string, service string, port string) string {
+	return fmt.Sprintf("%s/%s:%s", namespace, service, port)
+}
+
+// indexDiscoveredHosts adds to the given index the hosts routed to
+// Osiris-enabled services by the Ingresses and the HTTPRoutes. The hosts
+// already indexed - from the annotations of the services - take precedence.
+// A host routed to several services - for example with different paths - is
+// ambiguous: it is not indexed at all, and its routes are reported as
+// conflicts.
+func (a *activator) indexDiscoveredHosts(
+	appsByHost map[string]*app,
+	appsByServicePort map[string]*app,
+) discoveryState {
+	state := discoveryState{
+		Routes:    []discoveredRoute{},
+		Conflicts: []discoveryConflict{},
+	}
+
+	type hostRoute struct {
+		backend hostBackend
+		service string
+		app     *app
+	}
+	hosts := []string{}
+	routesByHost := map[string][]hostRoute{}
+	for _, backend := range a.hostBackends() {
+		service := servicePortKey(backend.namespace, backend.service, backend.port)
+		app, ok := appsByServicePort[service]
+		if !ok {
+			// not an Osiris-enabled service
+			continue
+		}
+		if _, found := routesByHost[backend.host]; !found {
+			hosts = append(hosts, backend.host)
+		}
+		routesByHost[backend.host] = append(routesByHost[backend.host], hostRoute{
+			backend: backend,
+			service: service,
+			app:     app,
+		})
+	}
+
+	for _, host := range hosts {
+		routes := routesByHost[host]
+		// the service the host is routed to: the one of the annotation, or
+		// the one of the discovered routes, as long as they all agree
+		ownerApp, annotated := appsByHost[host]
+		if !annotated {
+			ownerApp = routes[0].app
+		}
+		ownerService := servicePortKey(
+			ownerApp.Namespace,
+			ownerApp.ServiceName,
+			ownerApp.TargetURL.Port(),
+		)
+		ambiguous := false
+		for _, route := range routes {
+			if route.app != ownerApp {
+				ambiguous = true
+				break
+			}
+		}
+		if !ambiguous {
+			appsByHost[host] = ownerApp
+			for _, route := range routes {
+				state.Routes = append(state.Routes, discoveredRoute{
+					Host:    host,
+					Source:  route.backend.source,
+					Service: route.service,
+				})
+			}
+			continue
+		}
+		for _, route := range routes {
+			conflictingService := ownerService
+			if route.app == ownerApp {
+				if annotated {
+					// consistent with the annotation, which is still used
+					state.Routes = append(state.Routes, discoveredRoute{
+						Host:    host,
+						Source:  route.backend.source,
+						Service: route.service,
+					})
+					continue
+				}
+				for _, other := range routes {
+					if other.app != ownerApp {
+						conflictingService = other.service
+						break
+					}
+				}
+			}
+			glog.Errorf(
+				"Host %s of %s is routed to service %s, but is also routed to service %s",
+				host,
+				route.backend.source,
+				route.service,
+				conflictingService,
+			)
+			state.Conflicts = append(state.Conflicts, discoveryConflict{
+				Host:               host,
+				Source:             route.backend.source,
+				Service:            route.service,
+				ConflictingService: conflictingService,
+			})
+		}
+	}
+	return state
+}
+
+// hostBackends returns the backends of all the Ingresses and HTTPRoutes, in a
+// stable order. The wildcard hosts are skipped, because the activator can't
+// index them.
+func (a *activator) hostBackends() []hostBackend {
+	backends := []hostBackend{}
+	validHost := func(host string) bool {
+		return len(host) > 0 && !strings.HasPrefix(host, "*")
+	}
+
+	ingressKeys := make([]string, 0, len(a.ingresses))
+	for key := range a.ingresses {
+		ingressKeys = append(ingressKeys, key)
+	}
+	sort.Strings(ingressKeys)
+	for _, key := range ingressKeys {
+		ingress := a.ingresses[key]
+		source := fmt.Sprintf("Ingress %s/%s", ingress.Namespace, ingress.Name)
+		for _, rule := range ingress.Spec.Rules {
+			host := strings.ToLower(rule.Host)
+			if !validHost(host) || rule.HTTP == nil {
+				continue
+			}
+			for _, path := range rule.HTTP.Paths {
+				if path.Backend.Service == nil {
+					continue
+				}
+				port := path.Backend.Service.Port.Name
+				if path.Backend.Service.Port.Number != 0 {
+					port = strconv.Itoa(int(path.Backend.Service.Port.Number))
+				}
+				backends = append(backends, hostBackend{
+					host:      host,
+					source:    source,
+					namespace: ingress.Namespace,
+					service:   path.Backend.Service.Name,
+					port:      port,
+				})
+			}
+		}
+	}
+
+	httpRouteKeys := make([]string, 0, len(a.httpRoutes))
+	for key := range a.httpRoutes {
+		httpRouteKeys = append(httpRouteKeys, key)
+	}
+	sort.Strings(httpRouteKeys)
+	for _, key := range httpRouteKeys {
+		route := a.httpRoutes[key]
+		source := fmt.Sprintf("HTTPRoute %s/%s", route.Namespace, route.Name)
+		for _, hostname := range route.Spec.Hostnames {
+			host := strings.ToLower(hostname)
+			if !validHost(host) {
+				continue
+			}
+			for _, rule := range route.Spec.Rules {
+				for _, backendRef := range rule.BackendRefs {
+					if (backendRef.Group != nil && len(*backendRef.Group) > 0) ||
+						(backendRef.Kind != nil && *backendRef.Kind != "Service") ||
+						backendRef.Port == nil {
+						continue
+					}
+					namespace := route.Namespace
+					if backendRef.Namespace != nil && len(*backendRef.Namespace) > 0 {
+						namespace = *backendRef.Namespace
+					}
+					if namespace != route.Namespace &&
+						!a.httpRouteBackendGranted(route.Namespace, namespace, backendRef.Name) {
+						glog.Warningf(
+							"Ignoring the backend %s/%s of %s: no ReferenceGrant allows it",
+							namespace,
+							backendRef.Name,
+							source,
+						)
+						continue
+					}
+					backends = append(backends, hostBackend{
+						host:      host,
+						source:    source,
+						namespace: namespace,
+						service:   backendRef.Name,
+						port:      strconv.Itoa(int(*backendRef.Port)),
+					})
+				}
+			}
+		}
+	}
+	return backends
+}
+
+// httpRouteBackendGranted returns true if a ReferenceGrant of the namespace
+// of the service allows the HTTPRoutes of the given namespace to reference it
+func (a *activator) httpRouteBackendGranted(
+	routeNamespace string,
+	serviceNamespace string,
+	service string,
+) bool {
+	for _, grant := range a.referenceGrants {
+		if grant.Namespace == serviceNamespace &&
+			grant.allowsHTTPRouteBackend(routeNamespace, service) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *activator) syncIngress(obj interface{}) {
+	ingress, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		return
+	}
+	ingressKey := getKey(ingress.Namespace, "Ingress", ingress.Name)
+	a.indicesLock.Lock()
+	defer a.indicesLock.Unlock()
+	a.ingresses[ingressKey] = ingress
+	a.updateIndex()
+}
+
+func (a *activator) syncDeletedIngress(obj interface{}) {
+	ingress, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		return
+	}
+	ingressKey := getKey(ingress.Namespace, "Ingress", ingress.Name)
+	a.indicesLock.Lock()
+	defer a.indicesLock.Unlock()
+	delete(a.ingresses, ingressKey)
+	a.updateIndex()
+}
+
+func (a *activator) syncHTTPRoute(obj interface{}) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	route := &httpRoute{}
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, route)
+	if err != nil {
+		glog.Errorf(
+			"Error parsing HTTPRoute %s in namespace %s: %s",
+			u.GetName(),
+			u.GetNamespace(),
+			err,
+		)
+		return
+	}
+	httpRouteKey := getKey(route.Namespace, "HTTPRoute", route.Name)
+	a.indicesLock.Lock()
+	defer a.indicesLock.Unlock()
+	a.httpRoutes[httpRouteKey] = route
+	a.updateIndex()
+}
+
+func (a *activator) syncDeletedHTTPRoute(obj interface{}) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	httpRouteKey := getKey(u.GetNamespace(), "HTTPRoute", u.GetName())
+	a.indicesLock.Lock()
+	defer a.indicesLock.Unlock()
+	delete(a.httpRoutes, httpRouteKey)
+	a.updateIndex()
+}
+
+func (a *activator) syncReferenceGrant(obj interface{}) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	grant := &referenceGrant{}
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, grant)
+	if err != nil {
+		glog.Errorf(
+			"Error parsing ReferenceGrant %s in namespace %s: %s",
+			u.GetName(),
+			u.GetNamespace(),
+			err,
+		)
+		return
+	}
+	grantKey := getKey(grant.Namespace, "ReferenceGrant", grant.Name)
+	a.indicesLock.Lock()
+	defer a.indicesLock.Unlock()
+	a.referenceGrants[grantKey] = grant
+	a.updateIndex()
+}
+
+func (a *activator) syncDeletedReferenceGrant(obj interface{}) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	grantKey := getKey(u.GetNamespace(), "ReferenceGrant", u.GetName())
+	a.indicesLock.Lock()
+	defer a.indicesLock.Unlock()
+	delete(a.referenceGrants, grantKey)
+	a.updateIndex()
+}
+
+func (a *activator) printInternalDiscoveryState(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	a.indicesLock.RLock()
+	state := a.discovery
+	a.indicesLock.RUnlock()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(state)
+	if err != nil {
+		glog.Errorf("Error encoding discovery state in json: %s", err)
+	}
+}
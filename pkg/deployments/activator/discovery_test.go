@@ -0,0 +1,165 @@
+package activator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTestService(name string, annotations map[string]string) *corev1.Service {
+	annotations["osiris.dm.gg/manageEndpoints"] = "true"
+	annotations["osiris.dm.gg/deployment"] = name
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "my-ns",
+			Name:        name,
+			Annotations: annotations,
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: "10.0.0.1",
+			Ports: []corev1.ServicePort{
+				{Name: "http", Port: 8080},
+			},
+		},
+	}
+}
+
+func newTestIngress(name string, host string, service string, port networkingv1.ServiceBackendPort) *networkingv1.Ingress {
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "my-ns", Name: name},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{
+				Host: host,
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{{
+							Path: "/",
+							Backend: networkingv1.IngressBackend{
+								Service: &networkingv1.IngressServiceBackend{
+									Name: service,
+									Port: port,
+								},
+							},
+						}},
+					},
+				},
+			}},
+		},
+	}
+}
+
+func TestIndexDiscoveredHosts(t *testing.T) {
+	a := &activator{
+		services: map[string]*corev1.Service{
+			"app": newTestService("app", map[string]string{
+				"osiris.dm.gg/ingressHostname": "explicit.example.com",
+			}),
+			"other-app": newTestService("other-app", map[string]string{}),
+		},
+		ingresses: map[string]*networkingv1.Ingress{
+			"a": newTestIngress("a", "app.example.com", "app", networkingv1.ServiceBackendPort{Number: 8080}),
+			"b": newTestIngress("b", "*.example.com", "app", networkingv1.ServiceBackendPort{Number: 8080}),
+			"c": newTestIngress("c", "explicit.example.com", "other-app", networkingv1.ServiceBackendPort{Name: "http"}),
+			"d": newTestIngress("d", "not-osiris.example.com", "not-osiris", networkingv1.ServiceBackendPort{Number: 80}),
+			"e": newTestIngress("e", "split.example.com", "app", networkingv1.ServiceBackendPort{Number: 8080}),
+			"f": newTestIngress("f", "split.example.com", "other-app", networkingv1.ServiceBackendPort{Number: 8080}),
+		},
+		httpRoutes:      map[string]*httpRoute{},
+		referenceGrants: map[string]*referenceGrant{},
+	}
+	newHTTPRoute := func(namespace string, name string, host string, backendNamespace string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "gateway.networking.k8s.io/v1",
+			"kind":       "HTTPRoute",
+			"metadata": map[string]interface{}{
+				"namespace": namespace,
+				"name":      name,
+			},
+			"spec": map[string]interface{}{
+				"hostnames": []interface{}{host},
+				"rules": []interface{}{
+					map[string]interface{}{
+						"backendRefs": []interface{}{
+							map[string]interface{}{
+								"name":      "other-app",
+								"namespace": backendNamespace,
+								"port":      int64(8080),
+							},
+						},
+					},
+				},
+			},
+		}}
+	}
+
+	// the HTTPRoutes are parsed from unstructured objects
+	a.syncHTTPRoute(newHTTPRoute("my-ns", "route", "Other.Example.com", ""))
+	// a cross-namespace backend requires a ReferenceGrant
+	a.syncHTTPRoute(newHTTPRoute("other-ns", "granted", "granted.example.com", "my-ns"))
+	a.syncHTTPRoute(newHTTPRoute("another-ns", "not-granted", "not-granted.example.com", "my-ns"))
+	a.syncReferenceGrant(&unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1beta1",
+		"kind":       "ReferenceGrant",
+		"metadata": map[string]interface{}{
+			"namespace": "my-ns",
+			"name":      "grant",
+		},
+		"spec": map[string]interface{}{
+			"from": []interface{}{
+				map[string]interface{}{
+					"group":     "gateway.networking.k8s.io",
+					"kind":      "HTTPRoute",
+					"namespace": "other-ns",
+				},
+			},
+			"to": []interface{}{
+				map[string]interface{}{"group": "", "kind": "Service"},
+			},
+		},
+	}})
+
+	require.Contains(t, a.appsByHost, "app.example.com")
+	assert.Equal(t, "app", a.appsByHost["app.example.com"].ServiceName)
+	require.Contains(t, a.appsByHost, "other.example.com")
+	assert.Equal(t, "other-app", a.appsByHost["other.example.com"].ServiceName)
+	// the annotation takes precedence
+	assert.Equal(t, "app", a.appsByHost["explicit.example.com"].ServiceName)
+	assert.NotContains(t, a.appsByHost, "*.example.com")
+	assert.NotContains(t, a.appsByHost, "not-osiris.example.com")
+	// a host routed to several services is not indexed at all
+	assert.NotContains(t, a.appsByHost, "split.example.com")
+	require.Contains(t, a.appsByHost, "granted.example.com")
+	assert.Equal(t, "other-app", a.appsByHost["granted.example.com"].ServiceName)
+	assert.NotContains(t, a.appsByHost, "not-granted.example.com")
+
+	assert.Equal(t, []discoveredRoute{
+		{Host: "app.example.com", Source: "Ingress my-ns/a", Service: "my-ns/app:8080"},
+		{Host: "other.example.com", Source: "HTTPRoute my-ns/route", Service: "my-ns/other-app:8080"},
+		{Host: "granted.example.com", Source: "HTTPRoute other-ns/granted", Service: "my-ns/other-app:8080"},
+	}, a.discovery.Routes)
+	assert.Equal(t, []discoveryConflict{
+		{
+			Host:               "explicit.example.com",
+			Source:             "Ingress my-ns/c",
+			Service:            "my-ns/other-app:http",
+			ConflictingService: "my-ns/app:8080",
+		},
+		{
+			Host:               "split.example.com",
+			Source:             "Ingress my-ns/e",
+			Service:            "my-ns/app:8080",
+			ConflictingService: "my-ns/other-app:8080",
+		},
+		{
+			Host:               "split.example.com",
+			Source:             "Ingress my-ns/f",
+			Service:            "my-ns/other-app:8080",
+			ConflictingService: "my-ns/app:8080",
+		},
+	}, a.discovery.Conflicts)
+}
@@ -2,12 +2,14 @@ package activator
 
 import (
 	"fmt"
-	"net/http/httputil"
 	"net/url"
 	"regexp"
 	"strings"
 
 	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+
+	k8s "github.com/dailymotion-oss/osiris/pkg/kubernetes"
 )
 
 // nolint: lll
@@ -17,16 +19,31 @@ var (
 )
 
 // updateIndex builds an index that maps all the possible ways a service can be
-// addressed to application info that encapsulates details like which deployment
-// or statefulSet to activate and where to relay requests to after successful
-// activation. The new index replaces any old/existing index.
+// addressed to application info that encapsulates details like which deployment,
+// statefulSet or daemonSet to activate and where to relay requests to after successful
+// activation. The new index replaces any old/existing index. The apps behind
+// TLS passthrough ports are indexed separately, by hostname only - as
+// available in the SNI of the TLS ClientHello. The apps behind raw TCP ports
+// are indexed by the port of their dedicated activator TCP listener. Finally,
+// the hosts routed to the services by the Ingresses and HTTPRoutes are added
+// to the index.
 func (a *activator) updateIndex() {
 	appsByHost := map[string]*app{}
+	// the apps of the HTTP ports, by service port number and name
+	appsByServicePort := map[string]*app{}
+	tlsAppsByHost := map[string]*app{}
+	tcpAppsByPort := map[int32]*app{}
+	services := make([]*corev1.Service, 0, len(a.services))
+	for _, svc := range a.services {
+		services = append(services, svc)
+	}
+	tcpPortAssignments := k8s.AssignActivatorTCPPorts(services)
 	for _, svc := range a.services {
 		var (
 			name                        string
 			kind                        appKind
 			dependenciesAnnotationValue string
+			workloadAnnotations         map[string]string
 		)
 		if deploymentName, ok :=
 			svc.Annotations["osiris.dm.gg/deployment"]; ok {
@@ -34,6 +51,7 @@ func (a *activator) updateIndex() {
 			kind = appKindDeployment
 			deployment := a.deployments[getKey(svc.Namespace, kind, name)]
 			if deployment != nil && deployment.Annotations != nil {
+				workloadAnnotations = deployment.Annotations
 				dependenciesAnnotationValue = cleanAnnotationValue(deployment.Annotations["osiris.dm.gg/dependencies"])
 			}
 		} else if statefulSetName, ok :=
@@ -42,8 +60,18 @@ func (a *activator) updateIndex() {
 			kind = appKindStatefulSet
 			statefulset := a.statefulSets[getKey(svc.Namespace, kind, name)]
 			if statefulset != nil && statefulset.Annotations != nil {
+				workloadAnnotations = statefulset.Annotations
 				dependenciesAnnotationValue = cleanAnnotationValue(statefulset.Annotations["osiris.dm.gg/dependencies"])
 			}
+		} else if daemonSetName, ok :=
+			svc.Annotations["osiris.dm.gg/daemonset"]; ok {
+			name = cleanAnnotationValue(daemonSetName)
+			kind = appKindDaemonSet
+			daemonSet := a.daemonSets[getKey(svc.Namespace, kind, name)]
+			if daemonSet != nil && daemonSet.Annotations != nil {
+				workloadAnnotations = daemonSet.Annotations
+				dependenciesAnnotationValue = cleanAnnotationValue(daemonSet.Annotations["osiris.dm.gg/dependencies"])
+			}
 		}
 		if len(name) == 0 {
 			continue
@@ -63,6 +91,8 @@ func (a *activator) updateIndex() {
 				depAppKind = appKindDeployment
 			case "statefulset":
 				depAppKind = appKindStatefulSet
+			case "daemonset":
+				depAppKind = appKindDaemonSet
 			default:
 				glog.Errorf("Error parsing dependencies annotations for service %s in namespace %s: invalid appKind %s for dependency %s", svc.Name, svc.Namespace, depKind, dependency)
 				continue
@@ -78,6 +108,16 @@ func (a *activator) updateIndex() {
 			})
 		}
 
+		activationCheck, err := parseActivationCheck(svc.Annotations)
+		if err != nil {
+			glog.Errorf(
+				"Error parsing activation check annotation for service %s in namespace %s: %s",
+				svc.Name,
+				svc.Namespace,
+				err,
+			)
+		}
+
 		svcDNSNames := []string{
 			fmt.Sprintf("%s.%s", svc.Name, svc.Namespace),
 			fmt.Sprintf("%s.%s.svc", svc.Name, svc.Namespace),
@@ -133,13 +173,68 @@ func (a *activator) updateIndex() {
 				continue
 			}
 			app := &app{
-				Namespace:           svc.Namespace,
-				ServiceName:         svc.Name,
-				Name:                name,
-				Kind:                kind,
-				Dependencies:        dependencies,
-				TargetURL:           targetURL,
-				proxyRequestHandler: httputil.NewSingleHostReverseProxy(targetURL),
+				Namespace:    svc.Namespace,
+				ServiceName:  svc.Name,
+				Name:         name,
+				Kind:         kind,
+				Dependencies: dependencies,
+				TargetURL:    targetURL,
+				MaxQueuedRequests: k8s.GetMaxQueuedRequests(
+					workloadAnnotations,
+					a.maxQueuedRequests,
+				),
+				MaxRequestWait: k8s.GetMaxRequestWait(
+					workloadAnnotations,
+					a.maxRequestWait,
+				),
+				WakingUpPage:    k8s.ServiceHasWakingUpPage(svc.Annotations),
+				ActivationCheck: activationCheck,
+				WakingUpPageTemplate: cleanAnnotationValue(
+					svc.Annotations[k8s.WakingUpPageTemplateAnnotationName],
+				),
+				proxyRequestHandler: newReverseProxy(
+					targetURL,
+					k8s.IsH2CPort(svc.Annotations, port),
+				),
+			}
+			if k8s.IsTCPPort(svc.Annotations, port.Name, port.Port) {
+				activatorPort, ok := tcpPortAssignments[k8s.ActivatorTCPPortKey(
+					svc.Namespace,
+					svc.Name,
+					port.Port,
+				)]
+				if !ok {
+					// the endpoints controller doesn't advertise this port either
+					glog.Errorf(
+						"TCP port %d of service %s in namespace %s has no activator port: "+
+							"it is missing, invalid, or already used by another service",
+						port.Port,
+						svc.Name,
+						svc.Namespace,
+					)
+					continue
+				}
+				tcpAppsByPort[activatorPort] = app
+				continue
+			}
+			if k8s.IsTLSPassthroughPort(svc.Annotations, port.Name, port.Port) {
+				// kube-dns names
+				for _, svcDNSName := range svcDNSNames {
+					tlsAppsByHost[svcDNSName] = app
+				}
+				// Honor all annotations of the form
+				// ^osiris\.dm\.gg/(loadBalancer|ingress)Hostname(?:-\d+)?$
+				for k, v := range svc.Annotations {
+					if loadBalancerHostnameAnnotationRegex.MatchString(k) ||
+						ingressHostnameAnnotationRegex.MatchString(k) {
+						tlsAppsByHost[cleanAnnotationValue(v)] = app
+					}
+				}
+				continue
+			}
+			appsByServicePort[servicePortKey(svc.Namespace, svc.Name, fmt.Sprintf("%d", port.Port))] = app
+			if len(port.Name) > 0 {
+				appsByServicePort[servicePortKey(svc.Namespace, svc.Name, port.Name)] = app
 			}
 			// If the port is 80, also index by hostname/IP sans port number...
 			if port.Port == 80 {
@@ -203,7 +298,15 @@ func (a *activator) updateIndex() {
 			}
 		}
 	}
+	a.discovery = a.indexDiscoveredHosts(appsByHost, appsByServicePort)
 	a.appsByHost = appsByHost
+	a.tlsAppsByHost = tlsAppsByHost
+	a.tcpAppsByPort = tcpAppsByPort
+	// let the TCP servers know about the new ports, without blocking
+	select {
+	case a.tcpPortsChangedCh <- struct{}{}:
+	default:
+	}
 }
 
 func cleanAnnotationValue(rawValue string) string {
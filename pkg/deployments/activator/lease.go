@@ -0,0 +1,445 @@
+package activator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+
+	k8s "github.com/dailymotion-oss/osiris/pkg/kubernetes"
+)
+
+// The state of the latest activation of an app is stored in an annotation of
+// its Lease, so that the activator replicas not owning the activation know
+// when it's over.
+const (
+	activationStateAnnotationName = "osiris.dm.gg/activationState"
+	activationStateActivating     = "activating"
+	activationStateCompleted      = "completed"
+	activationStateTimedOut       = "timedOut"
+)
+
+const (
+	// activationLeaseDuration is how long an activation Lease is held without
+	// being renewed - so that another activator replica can take over the
+	// activation if its owner goes away.
+	activationLeaseDuration = 30 * time.Second
+	// activationLeaseRenewInterval is how often the owner of an activation
+	// renews its Lease.
+	activationLeaseRenewInterval = 10 * time.Second
+	// activationLeaseLabelName is the label identifying the activation Leases
+	activationLeaseLabelName = "osiris.dm.gg/activationLease"
+	// activationLeaseKindLabelName is the label holding the kind of the
+	// workload of an activation Lease
+	activationLeaseKindLabelName = "osiris.dm.gg/workloadKind"
+	// activationLeaseWorkloadAnnotationName holds the name of the workload of
+	// an activation Lease - which may be too long for a label value.
+	activationLeaseWorkloadAnnotationName = "osiris.dm.gg/workloadName"
+	// maxActivationLeaseNameLength is the maximum length of an object name
+	maxActivationLeaseNameLength = 253
+)
+
+// activationLeaseName returns the name of the Lease coordinating the
+// activations of the given app across the activator replicas. Names too long
+// for an object name are truncated, and suffixed with a hash of the full name.
+func activationLeaseName(app *app) string {
+	name := fmt.Sprintf(
+		"osiris-activation-%s-%s",
+		strings.ToLower(string(app.Kind)),
+		app.Name,
+	)
+	if len(name) <= maxActivationLeaseNameLength {
+		return name
+	}
+	hash := sha256.Sum256([]byte(name))
+	suffix := hex.EncodeToString(hash[:])[:10]
+	return name[:maxActivationLeaseNameLength-len(suffix)-1] + "-" + suffix
+}
+
+// watchWorkloadActivation starts watching for the completion of the given
+// workload activation. Only one activator replica owns an activation - it
+// scales up the workload and watches its pods and endpoints - through the
+// Lease of the app, while the other replicas only watch the Lease - and take
+// the activation over, with the given scaleUp function, if its owner stops
+// renewing the Lease. It returns false if the activation is owned by another
+// replica.
+func (a *activator) watchWorkloadActivation(
+	ctx context.Context,
+	app *app,
+	workload metav1.Object,
+	activation *appActivation,
+	appPodSelector labels.Selector,
+	scaleUp func(context.Context) error,
+) bool {
+	owned, err := a.acquireActivationLease(ctx, app, workload)
+	if err != nil {
+		// Coordination issues should not prevent the app from being activated
+		glog.Errorf(
+			"Error acquiring activation lease of %s %s in namespace %s: %s",
+			app.Kind,
+			app.Name,
+			app.Namespace,
+			err,
+		)
+		go activation.watchForCompletion(a.kubeClient, app, appPodSelector)
+		return true
+	}
+	if !owned {
+		glog.Infof(
+			"Activation of %s %s in namespace %s is owned by another activator; "+
+				"watching for its completion",
+			app.Kind,
+			app.Name,
+			app.Namespace,
+		)
+		go a.watchForLeaseCompletion(
+			app,
+			workload,
+			activation,
+			appPodSelector,
+			scaleUp,
+		)
+		return false
+	}
+	go activation.watchForCompletion(a.kubeClient, app, appPodSelector)
+	go a.renewActivationLease(app, activation)
+	return true
+}
+
+// acquireActivationLease tries to take the Lease of the given app, to own its
+// activation. It returns false if another activator replica already owns an
+// activation in progress. The Lease is owned by the workload, so that it is
+// deleted with it.
+func (a *activator) acquireActivationLease(
+	ctx context.Context,
+	app *app,
+	workload metav1.Object,
+) (bool, error) {
+	leasesClient := a.kubeClient.CoordinationV1().Leases(app.Namespace)
+	name := activationLeaseName(app)
+	now := metav1.NowMicro()
+	lease, err := leasesClient.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: app.Namespace,
+				Name:      name,
+			},
+		}
+		a.holdActivationLease(lease, app, workload, now)
+		_, err = leasesClient.Create(ctx, lease, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			// another replica was faster
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+	if activationLeaseIsHeld(lease, now.Time) &&
+		*lease.Spec.HolderIdentity != a.identity {
+		return false, nil
+	}
+	a.holdActivationLease(lease, app, workload, now)
+	_, err = leasesClient.Update(ctx, lease, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		// another replica was faster
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// holdActivationLease sets this activator replica as the holder of the given
+// Lease, for an activation in progress of the given workload.
+func (a *activator) holdActivationLease(
+	lease *coordinationv1.Lease,
+	app *app,
+	workload metav1.Object,
+	now metav1.MicroTime,
+) {
+	if lease.Labels == nil {
+		lease.Labels = map[string]string{}
+	}
+	lease.Labels[activationLeaseLabelName] = "true"
+	lease.Labels[activationLeaseKindLabelName] = strings.ToLower(string(app.Kind))
+	lease.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: "apps/v1",
+		Kind:       string(app.Kind),
+		Name:       workload.GetName(),
+		UID:        workload.GetUID(),
+	}}
+	if lease.Annotations == nil {
+		lease.Annotations = map[string]string{}
+	}
+	lease.Annotations[activationStateAnnotationName] = activationStateActivating
+	lease.Annotations[activationLeaseWorkloadAnnotationName] = workload.GetName()
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != a.identity {
+		var transitions int32
+		if lease.Spec.LeaseTransitions != nil {
+			transitions = *lease.Spec.LeaseTransitions + 1
+		}
+		lease.Spec.LeaseTransitions = &transitions
+	}
+	identity := a.identity
+	durationSeconds := int32(math.Ceil(activationLeaseDuration.Seconds()))
+	lease.Spec.HolderIdentity = &identity
+	lease.Spec.LeaseDurationSeconds = &durationSeconds
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+}
+
+// activationLeaseIsHeld checks if the given Lease is held for an activation
+// in progress - which didn't outlive its duration.
+func activationLeaseIsHeld(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Annotations[activationStateAnnotationName] != activationStateActivating ||
+		lease.Spec.HolderIdentity == nil ||
+		lease.Spec.RenewTime == nil ||
+		lease.Spec.LeaseDurationSeconds == nil {
+		return false
+	}
+	duration := time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+	return now.Before(lease.Spec.RenewTime.Add(duration))
+}
+
+// renewActivationLease renews the Lease of the given app until the end of its
+// activation, and then records the outcome of the activation in the Lease -
+// so that the other activator replicas know it's over, and that the next
+// activation can take the Lease.
+func (a *activator) renewActivationLease(
+	app *app,
+	activation *appActivation,
+) {
+	ticker := time.NewTicker(activationLeaseRenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !a.updateActivationLease(app, activationStateActivating) {
+				// the lease expired, and was taken by another replica
+				return
+			}
+		case <-activation.successCh:
+			a.updateActivationLease(app, activationStateCompleted)
+			return
+		case <-activation.timeoutCh:
+			a.updateActivationLease(app, activationStateTimedOut)
+			return
+		}
+	}
+}
+
+// updateActivationLease renews the Lease of the given app with the given
+// activation state. It returns false if the Lease is not held by this
+// activator replica anymore.
+func (a *activator) updateActivationLease(app *app, state string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	leasesClient := a.kubeClient.CoordinationV1().Leases(app.Namespace)
+	lease, err := leasesClient.Get(ctx, activationLeaseName(app), metav1.GetOptions{})
+	if err != nil {
+		glog.Errorf(
+			"Error retrieving activation lease of %s %s in namespace %s: %s",
+			app.Kind,
+			app.Name,
+			app.Namespace,
+			err,
+		)
+		// retry on the next renewal
+		return true
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != a.identity {
+		return false
+	}
+	if lease.Annotations == nil {
+		lease.Annotations = map[string]string{}
+	}
+	lease.Annotations[activationStateAnnotationName] = state
+	now := metav1.NowMicro()
+	lease.Spec.RenewTime = &now
+	if _, err := leasesClient.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		glog.Errorf(
+			"Error updating activation lease of %s %s in namespace %s: %s",
+			app.Kind,
+			app.Name,
+			app.Namespace,
+			err,
+		)
+	}
+	return true
+}
+
+// watchForLeaseCompletion waits for the end of an activation owned by another
+// activator replica, by watching the Lease of the app. If the owner stops
+// renewing the Lease before the end of the activation, the activation is
+// taken over.
+func (a *activator) watchForLeaseCompletion(
+	app *app,
+	workload metav1.Object,
+	activation *appActivation,
+	appPodSelector labels.Selector,
+	scaleUp func(context.Context) error,
+) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	leasesInformer := k8s.LeasesIndexInformer(
+		a.kubeClient,
+		app.Namespace,
+		fields.OneTermEqualSelector(
+			"metadata.name",
+			activationLeaseName(app),
+		),
+		nil,
+		0,
+	)
+	leasesInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: activation.syncLease,
+		UpdateFunc: func(_, newObj interface{}) {
+			activation.syncLease(newObj)
+		},
+	})
+	go leasesInformer.Run(ctx.Done())
+	timer := time.NewTimer(activation.timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(activationLeaseRenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-activation.successCh:
+			glog.Infof(
+				"Activation of %s %s in namespace %s completed in %s",
+				app.Kind,
+				app.Name,
+				app.Namespace,
+				time.Since(activation.startTime),
+			)
+			return
+		case <-activation.timeoutCh:
+			glog.Errorf(
+				"Activation of %s %s in namespace %s timed out",
+				app.Kind,
+				app.Name,
+				app.Namespace,
+			)
+			return
+		case <-ticker.C:
+			obj, exists, err := leasesInformer.GetStore().GetByKey(
+				fmt.Sprintf("%s/%s", app.Namespace, activationLeaseName(app)),
+			)
+			if err != nil || !exists {
+				continue
+			}
+			if a.takeOverActivation(
+				app,
+				workload,
+				activation,
+				appPodSelector,
+				scaleUp,
+				obj.(*coordinationv1.Lease),
+			) {
+				return
+			}
+		case <-timer.C:
+			glog.Errorf(
+				"Activation of %s %s in namespace %s timed out after %s",
+				app.Kind,
+				app.Name,
+				app.Namespace,
+				activation.timeout,
+			)
+			activation.lock.Lock()
+			defer activation.lock.Unlock()
+			if !activation.done {
+				activation.done = true
+				close(activation.timeoutCh)
+			}
+			return
+		}
+	}
+}
+
+// takeOverActivation takes over the activation of the given app if its
+// owner - another activator replica - stopped renewing the given Lease before
+// the end of the activation. It then scales up and watches the workload, as
+// the owner of the activation. It returns true if the activation was taken
+// over.
+func (a *activator) takeOverActivation(
+	app *app,
+	workload metav1.Object,
+	activation *appActivation,
+	appPodSelector labels.Selector,
+	scaleUp func(context.Context) error,
+	lease *coordinationv1.Lease,
+) bool {
+	if lease.Annotations[activationStateAnnotationName] != activationStateActivating ||
+		activationLeaseIsHeld(lease, time.Now()) {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	owned, err := a.acquireActivationLease(ctx, app, workload)
+	if err != nil {
+		glog.Errorf(
+			"Error taking over the activation lease of %s %s in namespace %s: %s",
+			app.Kind,
+			app.Name,
+			app.Namespace,
+			err,
+		)
+		return false
+	}
+	if !owned {
+		// another replica was faster
+		return false
+	}
+	glog.Infof(
+		"Taking over the activation of %s %s in namespace %s, whose owner "+
+			"stopped renewing its lease",
+		app.Kind,
+		app.Name,
+		app.Namespace,
+	)
+	go activation.watchForCompletion(a.kubeClient, app, appPodSelector)
+	go a.renewActivationLease(app, activation)
+	if err := scaleUp(ctx); err != nil {
+		glog.Errorf(
+			"Error scaling up %s %s in namespace %s: %s",
+			app.Kind,
+			app.Name,
+			app.Namespace,
+			err,
+		)
+	}
+	return true
+}
+
+func (a *appActivation) syncLease(obj interface{}) {
+	lease, ok := obj.(*coordinationv1.Lease)
+	if !ok {
+		return
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.done {
+		return
+	}
+	switch lease.Annotations[activationStateAnnotationName] {
+	case activationStateCompleted:
+		a.done = true
+		close(a.successCh)
+	case activationStateTimedOut:
+		a.done = true
+		close(a.timeoutCh)
+	}
+}
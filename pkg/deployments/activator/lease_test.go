@@ -0,0 +1,265 @@
+package activator
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestLease(holder string, state string, renewTime time.Time) *coordinationv1.Lease {
+	duration := int32(60)
+	renew := metav1.NewMicroTime(renewTime)
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "my-ns",
+			Name:      "osiris-activation-deployment-my-app",
+			Annotations: map[string]string{
+				activationStateAnnotationName: state,
+			},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &duration,
+			RenewTime:            &renew,
+		},
+	}
+}
+
+func TestAcquireActivationLease(t *testing.T) {
+	tests := []struct {
+		name           string
+		existingLease  *coordinationv1.Lease
+		expectedResult bool
+	}{
+		{
+			name:           "no lease",
+			expectedResult: true,
+		},
+		{
+			name:           "activation in progress in another replica",
+			existingLease:  newTestLease("other", activationStateActivating, time.Now()),
+			expectedResult: false,
+		},
+		{
+			name:           "expired activation of another replica",
+			existingLease:  newTestLease("other", activationStateActivating, time.Now().Add(-time.Hour)),
+			expectedResult: true,
+		},
+		{
+			name:           "completed activation of another replica",
+			existingLease:  newTestLease("other", activationStateCompleted, time.Now()),
+			expectedResult: true,
+		},
+		{
+			name:           "activation in progress in this replica",
+			existingLease:  newTestLease("me", activationStateActivating, time.Now()),
+			expectedResult: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if test.existingLease != nil {
+				objects = append(objects, test.existingLease)
+			}
+			a := &activator{
+				kubeClient: fake.NewSimpleClientset(objects...),
+				identity:   "me",
+			}
+			leaseApp := &app{
+				Namespace: "my-ns",
+				Name:      "my-app",
+				Kind:      appKindDeployment,
+			}
+
+			workload := &metav1.ObjectMeta{Name: "my-app", UID: "my-app-uid"}
+
+			actual, err := a.acquireActivationLease(context.Background(), leaseApp, workload)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedResult, actual)
+
+			lease, err := a.kubeClient.CoordinationV1().Leases("my-ns").
+				Get(context.Background(), activationLeaseName(leaseApp), metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, activationStateActivating, lease.Annotations[activationStateAnnotationName])
+			if test.expectedResult {
+				assert.Equal(t, "me", *lease.Spec.HolderIdentity)
+				assert.Equal(t, "true", lease.Labels[activationLeaseLabelName])
+				assert.Equal(t, "deployment", lease.Labels[activationLeaseKindLabelName])
+				assert.Equal(t, "my-app", lease.Annotations[activationLeaseWorkloadAnnotationName])
+				assert.Equal(t, []metav1.OwnerReference{{
+					APIVersion: "apps/v1",
+					Kind:       "Deployment",
+					Name:       "my-app",
+					UID:        "my-app-uid",
+				}}, lease.OwnerReferences)
+			} else {
+				assert.Equal(t, "other", *lease.Spec.HolderIdentity)
+			}
+		})
+	}
+}
+
+func TestSyncLease(t *testing.T) {
+	tests := []struct {
+		name            string
+		state           string
+		expectedSuccess bool
+		expectedTimeout bool
+	}{
+		{
+			name:  "activation in progress",
+			state: activationStateActivating,
+		},
+		{
+			name:            "activation completed",
+			state:           activationStateCompleted,
+			expectedSuccess: true,
+		},
+		{
+			name:            "activation timed out",
+			state:           activationStateTimedOut,
+			expectedTimeout: true,
+		},
+	}
+
+	isClosed := func(ch chan struct{}) bool {
+		select {
+		case <-ch:
+			return true
+		default:
+			return false
+		}
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			activation := newAppActivation()
+
+			activation.syncLease(newTestLease("other", test.state, time.Now()))
+			// the state of the lease is only used once
+			activation.syncLease(newTestLease("other", test.state, time.Now()))
+
+			assert.Equal(t, test.expectedSuccess, isClosed(activation.successCh))
+			assert.Equal(t, test.expectedTimeout, isClosed(activation.timeoutCh))
+		})
+	}
+}
+
+func TestUpdateActivationLease(t *testing.T) {
+	renewTime := time.Now().Add(-time.Minute)
+	leaseApp := &app{
+		Namespace: "my-ns",
+		Name:      "my-app",
+		Kind:      appKindDeployment,
+	}
+
+	a := &activator{
+		kubeClient: fake.NewSimpleClientset(newTestLease("me", activationStateActivating, renewTime)),
+		identity:   "me",
+	}
+	assert.True(t, a.updateActivationLease(leaseApp, activationStateActivating))
+	lease, err := a.kubeClient.CoordinationV1().Leases("my-ns").
+		Get(context.Background(), activationLeaseName(leaseApp), metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.True(t, lease.Spec.RenewTime.After(renewTime))
+	assert.True(t, activationLeaseIsHeld(lease, time.Now()))
+
+	// the lease was taken by another replica
+	a = &activator{
+		kubeClient: fake.NewSimpleClientset(newTestLease("other", activationStateActivating, renewTime)),
+		identity:   "me",
+	}
+	assert.False(t, a.updateActivationLease(leaseApp, activationStateCompleted))
+	lease, err = a.kubeClient.CoordinationV1().Leases("my-ns").
+		Get(context.Background(), activationLeaseName(leaseApp), metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, activationStateActivating, lease.Annotations[activationStateAnnotationName])
+}
+
+func TestTakeOverActivation(t *testing.T) {
+	tests := []struct {
+		name             string
+		lease            *coordinationv1.Lease
+		expectedTakeOver bool
+	}{
+		{
+			name:             "owner renewing the lease",
+			lease:            newTestLease("other", activationStateActivating, time.Now()),
+			expectedTakeOver: false,
+		},
+		{
+			name:             "owner gone during the activation",
+			lease:            newTestLease("other", activationStateActivating, time.Now().Add(-time.Hour)),
+			expectedTakeOver: true,
+		},
+		{
+			name:             "activation completed by the owner",
+			lease:            newTestLease("other", activationStateCompleted, time.Now().Add(-time.Hour)),
+			expectedTakeOver: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &activator{
+				kubeClient: fake.NewSimpleClientset(test.lease),
+				identity:   "me",
+			}
+			leaseApp := &app{
+				Namespace:   "my-ns",
+				Name:        "my-app",
+				ServiceName: "my-app",
+				Kind:        appKindDeployment,
+			}
+			workload := &metav1.ObjectMeta{Name: "my-app", UID: "my-app-uid"}
+			activation := newAppActivation()
+			var scaledUp bool
+
+			actual := a.takeOverActivation(
+				leaseApp,
+				workload,
+				activation,
+				labels.Everything(),
+				func(context.Context) error {
+					scaledUp = true
+					return nil
+				},
+				test.lease,
+			)
+
+			assert.Equal(t, test.expectedTakeOver, actual)
+			assert.Equal(t, test.expectedTakeOver, scaledUp)
+			lease, err := a.kubeClient.CoordinationV1().Leases("my-ns").
+				Get(context.Background(), activationLeaseName(leaseApp), metav1.GetOptions{})
+			require.NoError(t, err)
+			if test.expectedTakeOver {
+				assert.Equal(t, "me", *lease.Spec.HolderIdentity)
+				assert.True(t, activationLeaseIsHeld(lease, time.Now()))
+			} else {
+				assert.Equal(t, "other", *lease.Spec.HolderIdentity)
+			}
+		})
+	}
+}
+
+func TestActivationLeaseName(t *testing.T) {
+	shortApp := &app{Name: "my-app", Kind: appKindStatefulSet}
+	assert.Equal(t, "osiris-activation-statefulset-my-app", activationLeaseName(shortApp))
+
+	longApp := &app{Name: strings.Repeat("a", 253), Kind: appKindDeployment}
+	otherLongApp := &app{Name: strings.Repeat("a", 252) + "b", Kind: appKindDeployment}
+	name := activationLeaseName(longApp)
+	assert.Len(t, name, maxActivationLeaseNameLength)
+	assert.True(t, strings.HasPrefix(name, "osiris-activation-deployment-aaa"))
+	assert.NotEqual(t, name, activationLeaseName(otherLongApp))
+}
@@ -0,0 +1,117 @@
+package activator
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricsNamespace = "osiris"
+	metricsSubsystem = "activator"
+
+	protocolHTTP = "http"
+	protocolTLS  = "tls"
+	protocolTCP  = "tcp"
+)
+
+var (
+	activationsStarted = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "activations_started_total",
+			Help:      "Number of activations started, by app.",
+		},
+		[]string{"namespace", "kind", "name"},
+	)
+	activationsCompleted = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "activations_completed_total",
+			Help:      "Number of activations completed, by app.",
+		},
+		[]string{"namespace", "kind", "name"},
+	)
+	activationsTimedOut = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "activations_timed_out_total",
+			Help:      "Number of activations timed out, by app.",
+		},
+		[]string{"namespace", "kind", "name"},
+	)
+	coldStartDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "cold_start_duration_seconds",
+			Help:      "Time between the first request of an activation and its forwarding to the app, by app.",
+			Buckets:   []float64{.5, 1, 2, 5, 10, 20, 30, 60, 120, 300},
+		},
+		[]string{"namespace", "kind", "name"},
+	)
+	queuedRequests = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "queued_requests",
+			Help:      "Number of requests waiting for an activation.",
+		},
+	)
+	inFlightRequests = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "in_flight_requests",
+			Help:      "Number of requests being proxied to the apps.",
+		},
+	)
+	unknownHostRequests = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "unknown_host_requests_total",
+			Help:      "Number of requests rejected with a 404 because no app matched their host.",
+		},
+	)
+	proxyErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "proxy_errors_total",
+			Help:      "Number of requests or connections that couldn't be proxied to the apps, by protocol.",
+		},
+		[]string{"protocol"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(
+		activationsStarted,
+		activationsCompleted,
+		activationsTimedOut,
+		coldStartDuration,
+		queuedRequests,
+		inFlightRequests,
+		unknownHostRequests,
+		proxyErrors,
+	)
+}
+
+// recordColdStart records the cold start latency of the given activation -
+// the time since its first request - the first time a request or connection
+// is forwarded to the app. Nothing is recorded if the app was already running
+// when the activation started.
+func recordColdStart(app *app, activation *appActivation) {
+	if !activation.scaledFromZero {
+		return
+	}
+	activation.firstForward.Do(func() {
+		coldStartDuration.
+			WithLabelValues(app.Namespace, string(app.Kind), app.Name).
+			Observe(time.Since(activation.startTime).Seconds())
+	})
+}
@@ -0,0 +1,56 @@
+package activator
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordColdStart(t *testing.T) {
+	tests := []struct {
+		name            string
+		scaledFromZero  bool
+		expectedSamples uint64
+	}{
+		{
+			name:            "app scaled from zero",
+			scaledFromZero:  true,
+			expectedSamples: 1,
+		},
+		{
+			name:            "app already running",
+			scaledFromZero:  false,
+			expectedSamples: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			coldStartDuration.Reset()
+			coldStartApp := &app{
+				Namespace: "my-ns",
+				Name:      "cold-start-app",
+				Kind:      appKindDeployment,
+			}
+			activation := newAppActivation()
+			activation.scaledFromZero = test.scaledFromZero
+
+			// only the first forwarded request is observed
+			recordColdStart(coldStartApp, activation)
+			recordColdStart(coldStartApp, activation)
+
+			var metric dto.Metric
+			observer, err := coldStartDuration.GetMetricWithLabelValues(
+				coldStartApp.Namespace,
+				string(coldStartApp.Kind),
+				coldStartApp.Name,
+			)
+			require.NoError(t, err)
+			require.NoError(t, observer.(prometheus.Histogram).Write(&metric))
+			assert.Equal(t, test.expectedSamples, metric.GetHistogram().GetSampleCount())
+		})
+	}
+}
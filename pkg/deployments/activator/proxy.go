@@ -0,0 +1,71 @@
+package activator
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/http2"
+)
+
+// h2cDialer dials the apps for the h2c transport, with the same timeout and
+// keep-alive as http.DefaultTransport - so that an unreachable app fails the
+// request instead of hanging it until the OS gives up.
+var h2cDialer = &net.Dialer{
+	Timeout:   30 * time.Second,
+	KeepAlive: 30 * time.Second,
+}
+
+// h2cTransport is an HTTP/2 transport over cleartext TCP (h2c), used to
+// proxy the HTTP/2 requests - such as the gRPC ones - to the apps. The dial is
+// shared by all the requests waiting for a connection to the same app, so it
+// is bounded by the dialer's timeout rather than by a request's context.
+var h2cTransport = &http2.Transport{
+	AllowHTTP: true,
+	DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+		return h2cDialer.Dial(network, addr)
+	},
+}
+
+// protocolTransport proxies the HTTP/2 requests with HTTP/2, and the others
+// with HTTP/1.1 - because gRPC backends only speak HTTP/2. It is only used for
+// the service ports accepting h2c.
+type protocolTransport struct {
+	http1 http.RoundTripper
+	http2 http.RoundTripper
+}
+
+func (t protocolTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.ProtoMajor == 2 {
+		return t.http2.RoundTrip(r)
+	}
+	return t.http1.RoundTrip(r)
+}
+
+// newReverseProxy returns a reverse proxy to the given target URL, which
+// flushes the responses immediately, to support streaming (such as
+// server-sent events) and trailers. If the target accepts h2c, the proxy keeps
+// the protocol of the requests - HTTP/1.1 or HTTP/2 over cleartext - otherwise
+// all the requests are sent with HTTP/1.1. Upgrade requests - such as
+// WebSocket handshakes - are sent with HTTP/1.1, and the upgraded connections
+// are spliced by the reverse proxy.
+func newReverseProxy(targetURL *url.URL, h2c bool) *httputil.ReverseProxy {
+	proxy := httputil.NewSingleHostReverseProxy(targetURL)
+	proxy.FlushInterval = -1
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		glog.Errorf("Error proxying request to %s: %s", targetURL, err)
+		proxyErrors.WithLabelValues(protocolHTTP).Inc()
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	if h2c {
+		proxy.Transport = protocolTransport{
+			http1: http.DefaultTransport,
+			http2: h2cTransport,
+		}
+	}
+	return proxy
+}
@@ -0,0 +1,113 @@
+package activator
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestProxyHTTP2AndHTTP1(t *testing.T) {
+	// a gRPC-like backend, which streams its response and sends trailers
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Header().Set("X-Proto", r.Proto)
+		w.Write([]byte("first message;")) // nolint: errcheck
+		w.(http.Flusher).Flush()
+		w.Write([]byte("second message")) // nolint: errcheck
+		w.Header().Set("Grpc-Status", "0")
+	}), &http2.Server{}))
+	defer backend.Close()
+	targetURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	// the activator, with an activation already completed
+	activation := newAppActivation()
+	close(activation.successCh)
+	proxiedApp := &app{
+		Namespace: "my-ns",
+		Name:      "my-app",
+		Kind:      appKindDeployment,
+		TargetURL: targetURL,
+	}
+	a := &activator{
+		appsByHost: map[string]*app{},
+		appActivations: map[string]*appActivation{
+			getKey(proxiedApp.Namespace, proxiedApp.Kind, proxiedApp.Name): activation,
+		},
+		activationDurations: map[string]time.Duration{},
+	}
+	activatorServer := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(a.handleRequest), &http2.Server{}))
+	defer activatorServer.Close()
+	activatorURL, err := url.Parse(activatorServer.URL)
+	require.NoError(t, err)
+	a.appsByHost[activatorURL.Host] = proxiedApp
+
+	h2cClient := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+	tests := []struct {
+		name          string
+		client        *http.Client
+		h2cBackend    bool
+		expectedProto string
+	}{
+		{
+			name:          "h2c prior knowledge to an h2c backend",
+			client:        h2cClient,
+			h2cBackend:    true,
+			expectedProto: "HTTP/2.0",
+		},
+		{
+			name:          "http/1.1 to an h2c backend",
+			client:        &http.Client{},
+			h2cBackend:    true,
+			expectedProto: "HTTP/1.1",
+		},
+		{
+			name:          "h2c prior knowledge to an http/1.1 backend",
+			client:        h2cClient,
+			h2cBackend:    false,
+			expectedProto: "HTTP/1.1",
+		},
+		{
+			name:          "http/1.1 to an http/1.1 backend",
+			client:        &http.Client{},
+			h2cBackend:    false,
+			expectedProto: "HTTP/1.1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxiedApp.proxyRequestHandler = newReverseProxy(targetURL, test.h2cBackend)
+			req, err := http.NewRequest(http.MethodPost, activatorServer.URL+"/my.Service/Method", nil)
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/grpc")
+			req.Header.Set("TE", "trailers")
+
+			resp, err := test.client.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, test.expectedProto, resp.Header.Get("X-Proto"))
+			assert.Equal(t, "first message;second message", string(body))
+			assert.Equal(t, "0", resp.Trailer.Get("Grpc-Status"))
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package activator
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// defaultExpectedActivationDuration is the expected duration of the
+// activation of an app that was never activated by this activator process.
+const defaultExpectedActivationDuration = 30 * time.Second
+
+// queueState is the state of the requests queued for an app activation, as
+// served by the internal server.
+type queueState struct {
+	QueuedRequests             int32     `json:"queuedRequests"`
+	ActivationStartTime        time.Time `json:"activationStartTime"`
+	ExpectedActivationDuration string    `json:"expectedActivationDuration"`
+}
+
+// enqueueRequest adds a request to the queue of requests waiting for the
+// activation, unless the queue already holds maxQueuedRequests requests - in
+// which case it returns false. A maxQueuedRequests of 0 means no limit.
+func (a *appActivation) enqueueRequest(maxQueuedRequests int) bool {
+	queued := atomic.AddInt32(&a.queuedRequests, 1)
+	if maxQueuedRequests > 0 && int(queued) > maxQueuedRequests {
+		atomic.AddInt32(&a.queuedRequests, -1)
+		return false
+	}
+	queuedRequests.Inc()
+	return true
+}
+
+func (a *appActivation) dequeueRequest() {
+	atomic.AddInt32(&a.queuedRequests, -1)
+	queuedRequests.Dec()
+}
+
+func (a *activator) expectedActivationDuration(appKey string) time.Duration {
+	a.appActivationsLock.RLock()
+	defer a.appActivationsLock.RUnlock()
+	if duration, ok := a.activationDurations[appKey]; ok {
+		return duration
+	}
+	return defaultExpectedActivationDuration
+}
+
+func (a *activator) recordActivationDuration(
+	appKey string,
+	activation *appActivation,
+) {
+	a.appActivationsLock.Lock()
+	defer a.appActivationsLock.Unlock()
+	a.activationDurations[appKey] = time.Since(activation.startTime)
+}
+
+// retryAfter returns the number of seconds a client should wait before
+// retrying a request rejected during the given activation: the expected
+// remaining time of the activation, based on the duration of the previous
+// activation of the same app. It's at least 1 second.
+func retryAfter(
+	activation *appActivation,
+	expectedDuration time.Duration,
+	now time.Time,
+) int {
+	remaining := expectedDuration - now.Sub(activation.startTime)
+	seconds := int(math.Ceil(remaining.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+func (a *activator) returnRetryAfter(
+	w http.ResponseWriter,
+	appKey string,
+	activation *appActivation,
+) {
+	w.Header().Set(
+		"Retry-After",
+		strconv.Itoa(retryAfter(
+			activation,
+			a.expectedActivationDuration(appKey),
+			time.Now(),
+		)),
+	)
+	a.returnError(w, http.StatusServiceUnavailable)
+}
+
+func (a *activator) printInternalQueuesState(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	a.appActivationsLock.RLock()
+	queues := make(map[string]queueState, len(a.appActivations))
+	for appKey, activation := range a.appActivations {
+		expectedDuration, ok := a.activationDurations[appKey]
+		if !ok {
+			expectedDuration = defaultExpectedActivationDuration
+		}
+		queues[appKey] = queueState{
+			QueuedRequests:             atomic.LoadInt32(&activation.queuedRequests),
+			ActivationStartTime:        activation.startTime,
+			ExpectedActivationDuration: expectedDuration.String(),
+		}
+	}
+	a.appActivationsLock.RUnlock()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(queues)
+	if err != nil {
+		glog.Errorf("Error encoding queues in json: %s", err)
+	}
+}
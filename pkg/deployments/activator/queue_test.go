@@ -0,0 +1,94 @@
+package activator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnqueueRequest(t *testing.T) {
+	tests := []struct {
+		name              string
+		maxQueuedRequests int
+		requests          int
+		expectedAccepted  int
+	}{
+		{
+			name:              "under the limit",
+			maxQueuedRequests: 5,
+			requests:          3,
+			expectedAccepted:  3,
+		},
+		{
+			name:              "over the limit",
+			maxQueuedRequests: 2,
+			requests:          5,
+			expectedAccepted:  2,
+		},
+		{
+			name:              "no limit",
+			maxQueuedRequests: 0,
+			requests:          50,
+			expectedAccepted:  50,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			activation := newAppActivation()
+			var accepted int
+			for i := 0; i < test.requests; i++ {
+				if activation.enqueueRequest(test.maxQueuedRequests) {
+					accepted++
+				}
+			}
+			assert.Equal(t, test.expectedAccepted, accepted)
+			assert.Equal(t, int32(test.expectedAccepted), activation.queuedRequests)
+
+			activation.dequeueRequest()
+			if test.maxQueuedRequests > 0 && test.requests > test.maxQueuedRequests {
+				assert.True(t, activation.enqueueRequest(test.maxQueuedRequests))
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name             string
+		elapsed          time.Duration
+		expectedDuration time.Duration
+		expectedResult   int
+	}{
+		{
+			name:             "activation just started",
+			expectedDuration: 30 * time.Second,
+			expectedResult:   30,
+		},
+		{
+			name:             "activation in progress",
+			elapsed:          12500 * time.Millisecond,
+			expectedDuration: 20 * time.Second,
+			expectedResult:   8,
+		},
+		{
+			name:             "activation slower than expected",
+			elapsed:          time.Minute,
+			expectedDuration: 20 * time.Second,
+			expectedResult:   1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			activation := newAppActivation()
+			activation.startTime = now.Add(-test.elapsed)
+
+			actual := retryAfter(activation, test.expectedDuration, now)
+			assert.Equal(t, test.expectedResult, actual)
+		})
+	}
+}
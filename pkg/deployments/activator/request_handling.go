@@ -1,11 +1,12 @@
 package activator
 
 import (
-	"context"
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/golang/glog"
+	"golang.org/x/net/http/httpguts"
 	corev1 "k8s.io/api/core/v1"
 )
 
@@ -26,10 +27,16 @@ func (a *activator) handleRequest(
 	a.indicesLock.RUnlock()
 	if !ok {
 		glog.Infof("No deployment/statefulset found for host %s", r.Host)
+		unknownHostRequests.Inc()
 		a.returnError(w, http.StatusNotFound)
 		return
 	}
 
+	if r.URL.Path == activationStatusPath {
+		a.serveActivationStatus(w, app)
+		return
+	}
+
 	glog.Infof(
 		"%s %s in namespace %s may require activation",
 		app.Kind,
@@ -37,99 +44,88 @@ func (a *activator) handleRequest(
 		app.Namespace,
 	)
 
-	// Are we already activating the deployment/statefulset in question?
-	var err error
 	appKey := getKey(app.Namespace, app.Kind, app.Name)
-	a.appActivationsLock.RLock()
-	appActivation, ok := a.appActivations[appKey]
-	a.appActivationsLock.RUnlock()
-	if ok {
-		glog.Infof(
-			"Found activation in-progress for %s %s in namespace %s",
-			app.Kind,
-			app.Name,
-			app.Namespace,
-		)
-	} else {
-		func() {
-			a.appActivationsLock.Lock()
-			defer a.appActivationsLock.Unlock()
-			// Some other goroutine could have initiated activation of this deployment/statefulset
-			// while we were waiting for the lock. Now that we have the lock, do we
-			// still need to do this?
-			appActivation, ok = a.appActivations[appKey]
-			if ok {
-				glog.Infof(
-					"Found activation in-progress for %s %s in namespace %s",
-					app.Kind,
-					app.Name,
-					app.Namespace,
-				)
-				return
-			}
-			glog.Infof(
-				"Found NO activation in-progress for %s %s in namespace %s",
-				app.Kind,
-				app.Name,
-				app.Namespace,
-			)
-			// Initiate activation (or discover that it may already have been started
-			// by another activator process)
-			ctx, cancelFunc := context.WithTimeout(context.Background(), a.appActivationTimeout)
-			defer cancelFunc()
-			appActivation, err = a.activate(ctx, app)
-			if err != nil {
-				glog.Errorf(
-					"%s activation for %s in namespace %s failed: %s",
-					app.Kind,
-					app.Name,
-					app.Namespace,
-					err,
-				)
-				return
-			}
-			// Add it to the index of in-flight activation
-			a.appActivations[appKey] = appActivation
-			// But remove it from that index when it's complete
-			go func() {
-				deleteActivation := func() {
-					a.appActivationsLock.Lock()
-					defer a.appActivationsLock.Unlock()
-					delete(a.appActivations, appKey)
-				}
-				select {
-				case <-appActivation.successCh:
-					deleteActivation()
-				case <-appActivation.timeoutCh:
-					deleteActivation()
-				}
-			}()
-		}()
-		if err != nil {
-			glog.Errorf(
-				"Error activating %s %s in namespace %s: %s",
-				app.Kind,
-				app.Name,
-				app.Namespace,
-				err,
-			)
-			a.returnError(w, http.StatusServiceUnavailable)
+	appActivation, err := a.getOrStartActivation(app)
+	if err != nil {
+		a.returnError(w, http.StatusServiceUnavailable)
+		return
+	}
+
+	// Browsers get a waking up page at once - which will reload once the
+	// activation is completed - if the service asked for it.
+	if app.WakingUpPage && acceptsHTML(r) && !isUpgradeRequest(r) {
+		select {
+		case <-appActivation.successCh:
+		default:
+			a.serveWakingUpPage(w, app, appActivation)
 			return
 		}
 	}
 
 	// Regardless of whether we just started an activation or found one already in
 	// progress, we need to wait for that activation to be completed... or fail...
-	// or time out.
+	// or time out. But we don't want an unbounded number of requests piling up
+	// during a slow activation.
+	if !appActivation.enqueueRequest(app.MaxQueuedRequests) {
+		glog.Infof(
+			"Too many requests waiting for the activation of %s %s in namespace %s; rejecting request",
+			app.Kind,
+			app.Name,
+			app.Namespace,
+		)
+		a.returnRetryAfter(w, appKey, appActivation)
+		return
+	}
+	// a nil channel blocks forever: no wait limit
+	var waitLimitCh <-chan time.Time
+	if app.MaxRequestWait > 0 {
+		timer := time.NewTimer(app.MaxRequestWait)
+		defer timer.Stop()
+		waitLimitCh = timer.C
+	}
 	select {
 	case <-appActivation.successCh:
-		glog.Infof("Passing request on to: %s", app.TargetURL)
+		appActivation.dequeueRequest()
+		if isUpgradeRequest(r) {
+			// The reverse proxy switches protocols - for example to WebSocket - and
+			// then copies the data both ways, until one side closes the connection
+			glog.Infof(
+				"Passing %s upgrade request on to: %s",
+				r.Header.Get("Upgrade"),
+				app.TargetURL,
+			)
+		} else {
+			glog.Infof("Passing request on to: %s", app.TargetURL)
+		}
+		recordColdStart(app, appActivation)
+		inFlightRequests.Inc()
+		defer inFlightRequests.Dec()
 		app.proxyRequestHandler.ServeHTTP(w, r)
 	case <-appActivation.timeoutCh:
+		appActivation.dequeueRequest()
 		a.returnError(w, http.StatusServiceUnavailable)
+	case <-waitLimitCh:
+		appActivation.dequeueRequest()
+		glog.Infof(
+			"Request waited more than %s for the activation of %s %s in namespace %s; rejecting request",
+			app.MaxRequestWait,
+			app.Kind,
+			app.Name,
+			app.Namespace,
+		)
+		a.returnRetryAfter(w, appKey, appActivation)
+	case <-r.Context().Done():
+		// the client is gone
+		appActivation.dequeueRequest()
 	}
 }
 
+// isUpgradeRequest checks if the request asks for a connection upgrade - such
+// as a WebSocket handshake.
+func isUpgradeRequest(r *http.Request) bool {
+	return httpguts.HeaderValuesContainsToken(r.Header["Connection"], "Upgrade")
+}
+
 func (a *activator) printInternalIndicesState(
 	w http.ResponseWriter,
 	r *http.Request,
@@ -168,6 +164,18 @@ func (a *activator) printInternalServicesState(
 	}
 }
 
+func (a *activator) printInternalControlState(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(a.controlWatcher.State())
+	if err != nil {
+		glog.Errorf("Error encoding control state in json: %s", err)
+	}
+}
+
 func (a *activator) returnError(w http.ResponseWriter, statusCode int) {
 	w.WriteHeader(statusCode)
 	if _, err := w.Write([]byte{}); err != nil {
@@ -0,0 +1,116 @@
+package activator
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+// newSleepingAppActivator returns an activator serving requests for the given
+// backend, with an activation in progress - completed after a short delay.
+func newSleepingAppActivator(t *testing.T, backendURL string) (*httptest.Server, func()) {
+	targetURL, err := url.Parse(backendURL)
+	require.NoError(t, err)
+	activation := newAppActivation()
+	sleepingApp := &app{
+		Namespace:           "my-ns",
+		Name:                "my-app",
+		Kind:                appKindDeployment,
+		TargetURL:           targetURL,
+		MaxRequestWait:      5 * time.Second,
+		proxyRequestHandler: newReverseProxy(targetURL, false),
+	}
+	a := &activator{
+		appsByHost: map[string]*app{},
+		appActivations: map[string]*appActivation{
+			getKey(sleepingApp.Namespace, sleepingApp.Kind, sleepingApp.Name): activation,
+		},
+		activationDurations: map[string]time.Duration{},
+	}
+	activatorServer := httptest.NewServer(http.HandlerFunc(a.handleRequest))
+	activatorURL, err := url.Parse(activatorServer.URL)
+	require.NoError(t, err)
+	a.appsByHost[activatorURL.Host] = sleepingApp
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(activation.successCh)
+	}()
+	return activatorServer, activatorServer.Close
+}
+
+func TestWebSocketThroughActivator(t *testing.T) {
+	// a WebSocket echo server
+	backend := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		var message string
+		for websocket.Message.Receive(ws, &message) == nil {
+			if err := websocket.Message.Send(ws, "echo: "+message); err != nil {
+				return
+			}
+		}
+	}))
+	defer backend.Close()
+	activatorServer, closeActivator := newSleepingAppActivator(t, backend.URL)
+	defer closeActivator()
+
+	// the very first request to the sleeping app opens a WebSocket
+	wsURL := "ws" + strings.TrimPrefix(activatorServer.URL, "http")
+	ws, err := websocket.Dial(wsURL, "", activatorServer.URL)
+	require.NoError(t, err)
+	defer ws.Close()
+
+	for _, message := range []string{"hello", "world"} {
+		require.NoError(t, websocket.Message.Send(ws, message))
+		var reply string
+		require.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+		require.NoError(t, websocket.Message.Receive(ws, &reply))
+		assert.Equal(t, "echo: "+message, reply)
+	}
+}
+
+func TestServerSentEventsThroughActivator(t *testing.T) {
+	// an event stream, which sends its second event only once the client
+	// received the first one
+	firstEventReceived := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-firstEventReceived:
+		case <-time.After(5 * time.Second):
+			return
+		}
+		fmt.Fprint(w, "data: second\n\n")
+	}))
+	defer backend.Close()
+	activatorServer, closeActivator := newSleepingAppActivator(t, backend.URL)
+	defer closeActivator()
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(activatorServer.URL + "/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "data: first\n", line)
+	close(firstEventReceived)
+
+	_, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	line, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "data: second\n", line)
+}
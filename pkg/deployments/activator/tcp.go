@@ -0,0 +1,207 @@
+package activator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// The listeners that couldn't be opened - for example because their port is
+// still held by a previous listener - are retried with an exponential backoff.
+const (
+	minTCPListenRetryDelay = time.Second
+	maxTCPListenRetryDelay = 30 * time.Second
+)
+
+// runTCPServers manages the TCP listeners of the apps behind raw TCP ports -
+// one listener per port, so that the app can be found from the port the
+// connection was received on. The listeners are opened and closed each time
+// the index changes, until the context is canceled.
+func (a *activator) runTCPServers(ctx context.Context) {
+	listeners := map[int32]net.Listener{}
+	retryDelay := minTCPListenRetryDelay
+	for {
+		var failedPorts int
+		a.indicesLock.RLock()
+		ports := make(map[int32]struct{}, len(a.tcpAppsByPort))
+		for port := range a.tcpAppsByPort {
+			ports[port] = struct{}{}
+		}
+		a.indicesLock.RUnlock()
+
+		for port, listener := range listeners {
+			if _, ok := ports[port]; !ok {
+				glog.Infof("No app is behind TCP port %d anymore; closing its listener", port)
+				listener.Close() // nolint: errcheck
+				delete(listeners, port)
+			}
+		}
+		for port := range ports {
+			if _, ok := listeners[port]; ok {
+				continue
+			}
+			listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+			if err != nil {
+				glog.Errorf("Error listening on TCP port %d: %s", port, err)
+				failedPorts++
+				continue
+			}
+			glog.Infof("Activator TCP server is listening on %s", listener.Addr())
+			listeners[port] = listener
+			go func(port int32) {
+				// serveTCP returns an error once the listener is closed
+				err := a.serveTCP(listener, port)
+				glog.Infof("Activator TCP server on port %d stopped: %s", port, err)
+			}(port)
+		}
+
+		var (
+			retryTimer *time.Timer
+			retryCh    <-chan time.Time
+		)
+		if failedPorts > 0 {
+			glog.Infof(
+				"Retrying to listen on %d TCP ports in %s",
+				failedPorts,
+				retryDelay,
+			)
+			retryTimer = time.NewTimer(retryDelay)
+			retryCh = retryTimer.C
+			retryDelay *= 2
+			if retryDelay > maxTCPListenRetryDelay {
+				retryDelay = maxTCPListenRetryDelay
+			}
+		} else {
+			retryDelay = minTCPListenRetryDelay
+		}
+
+		select {
+		case <-ctx.Done():
+			if retryTimer != nil {
+				retryTimer.Stop()
+			}
+			for _, listener := range listeners {
+				listener.Close() // nolint: errcheck
+			}
+			return
+		case <-a.tcpPortsChangedCh:
+		case <-retryCh:
+		}
+		if retryTimer != nil {
+			retryTimer.Stop()
+		}
+	}
+}
+
+func (a *activator) serveTCP(listener net.Listener, port int32) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go a.handleTCPConnection(conn, port)
+	}
+}
+
+func (a *activator) handleTCPConnection(conn net.Conn, port int32) {
+	defer conn.Close()
+
+	a.indicesLock.RLock()
+	app, ok := a.tcpAppsByPort[port]
+	a.indicesLock.RUnlock()
+	if !ok {
+		glog.Infof("No deployment/statefulset found for TCP port %d", port)
+		return
+	}
+	glog.Infof(
+		"TCP connection received on port %d for %s %s in namespace %s",
+		port,
+		app.Kind,
+		app.Name,
+		app.Namespace,
+	)
+	a.activateAndSplice(conn, conn, app, protocolTCP)
+}
+
+// activateAndSplice activates the given app - or joins its ongoing activation
+// - and waits for it to complete before splicing the client connection to the
+// app's service. The data from the client is read from clientReader, which
+// may replay bytes already read from the client connection.
+func (a *activator) activateAndSplice(
+	conn net.Conn,
+	clientReader io.Reader,
+	app *app,
+	protocol string,
+) {
+	protocolName := strings.ToUpper(protocol)
+	appActivation, err := a.getOrStartActivation(app)
+	if err != nil {
+		return
+	}
+	// a nil channel blocks forever: no wait limit
+	var waitLimitCh <-chan time.Time
+	if app.MaxRequestWait > 0 {
+		timer := time.NewTimer(app.MaxRequestWait)
+		defer timer.Stop()
+		waitLimitCh = timer.C
+	}
+	select {
+	case <-appActivation.successCh:
+	case <-appActivation.timeoutCh:
+		return
+	case <-waitLimitCh:
+		glog.Infof(
+			"%s connection waited more than %s for the activation of %s %s in namespace %s; closing it",
+			protocolName,
+			app.MaxRequestWait,
+			app.Kind,
+			app.Name,
+			app.Namespace,
+		)
+		return
+	}
+
+	glog.Infof("Passing %s connection on to: %s", protocolName, app.TargetURL.Host)
+	backendConn, err := net.DialTimeout("tcp", app.TargetURL.Host, 5*time.Second)
+	if err != nil {
+		glog.Errorf("Error connecting to %s: %s", app.TargetURL.Host, err)
+		proxyErrors.WithLabelValues(protocol).Inc()
+		return
+	}
+	defer backendConn.Close()
+	recordColdStart(app, appActivation)
+	splice(conn, clientReader, backendConn)
+}
+
+// splice copies the data between the client and the backend connections,
+// until both sides are done. The data from the client is read from
+// clientReader, which replays the bytes already read from the client
+// connection.
+func splice(clientConn net.Conn, clientReader io.Reader, backendConn net.Conn) {
+	done := make(chan struct{}, 2)
+	copyAndCloseWrite := func(dst net.Conn, src io.Reader) {
+		io.Copy(dst, src) // nolint: errcheck
+		// let the other side know we're done writing, if possible
+		if tcpConn, ok := dst.(*net.TCPConn); ok {
+			tcpConn.CloseWrite() // nolint: errcheck
+		} else {
+			dst.Close() // nolint: errcheck
+		}
+		done <- struct{}{}
+	}
+	go copyAndCloseWrite(backendConn, clientReader)
+	go copyAndCloseWrite(clientConn, backendConn)
+	<-done
+	<-done
+}
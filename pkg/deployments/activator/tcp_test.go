@@ -0,0 +1,207 @@
+package activator
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/dailymotion-oss/osiris/pkg/control"
+)
+
+// failFastWatcher is a control watcher for a frozen Osiris, with an
+// activator failing fast - so that no activation is ever started.
+type failFastWatcher struct{}
+
+func (failFastWatcher) Run(context.Context) {}
+
+func (failFastWatcher) State() control.State {
+	return control.State{Frozen: true, ActivatorFailFast: true}
+}
+
+// newEchoServer starts a TCP server that echoes back everything it receives
+func newEchoServer(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn) // nolint: errcheck
+			}()
+		}
+	}()
+	return listener
+}
+
+func TestTCPActivation(t *testing.T) {
+	const port = 25432
+	backend := newEchoServer(t)
+	defer backend.Close()
+
+	tcpApp := &app{
+		Namespace:      "my-ns",
+		Name:           "my-db",
+		Kind:           appKindStatefulSet,
+		TargetURL:      &url.URL{Host: backend.Addr().String()},
+		MaxRequestWait: 5 * time.Second,
+	}
+	activation := newAppActivation()
+	a := &activator{
+		tcpAppsByPort: map[int32]*app{port: tcpApp},
+		appActivations: map[string]*appActivation{
+			getKey(tcpApp.Namespace, tcpApp.Kind, tcpApp.Name): activation,
+		},
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go a.serveTCP(listener, port) // nolint: errcheck
+
+	// the app becomes ready a bit later
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(activation.successCh)
+	}()
+
+	// the client talks first, before the app is ready
+	conn, err := net.DialTimeout("tcp", listener.Addr().String(), 5*time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	_, err = conn.Write([]byte("PING\n"))
+	require.NoError(t, err)
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "PING\n", line)
+}
+
+func TestTCPUnknownPort(t *testing.T) {
+	a := &activator{
+		tcpAppsByPort:  map[int32]*app{},
+		appActivations: map[string]*appActivation{},
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go a.serveTCP(listener, 25432) // nolint: errcheck
+
+	conn, err := net.DialTimeout("tcp", listener.Addr().String(), 5*time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	// the connection is closed without any data
+	_, err = conn.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestRunTCPServers(t *testing.T) {
+	// find a free port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := int32(listener.Addr().(*net.TCPAddr).Port)
+	require.NoError(t, listener.Close())
+
+	a := &activator{
+		tcpAppsByPort:     map[int32]*app{port: {}},
+		tcpPortsChangedCh: make(chan struct{}, 1),
+		// the probe connections are closed without any activation
+		controlWatcher: failFastWatcher{},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.runTCPServers(ctx)
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, 5*time.Second, 10*time.Millisecond, "listener should be opened")
+
+	// the port is not used anymore
+	a.indicesLock.Lock()
+	a.tcpAppsByPort = map[int32]*app{}
+	a.indicesLock.Unlock()
+	a.tcpPortsChangedCh <- struct{}{}
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return true
+		}
+		conn.Close()
+		return false
+	}, 5*time.Second, 10*time.Millisecond, "listener should be closed")
+}
+
+func TestRunTCPServersRetry(t *testing.T) {
+	// the port is still held by a previous listener
+	busyListener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	port := int32(busyListener.Addr().(*net.TCPAddr).Port)
+
+	a := &activator{
+		tcpAppsByPort:     map[int32]*app{port: {}},
+		tcpPortsChangedCh: make(chan struct{}, 1),
+		// the probe connections are closed without any activation
+		controlWatcher: failFastWatcher{},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.runTCPServers(ctx)
+
+	// the listener is opened once the port is released, without any change of
+	// the index
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, busyListener.Close())
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, minTCPListenRetryDelay+5*time.Second, 10*time.Millisecond, "listener should be opened")
+}
+
+func TestIndexTCPPorts(t *testing.T) {
+	oldService := newTestService("old-db", map[string]string{
+		"osiris.dm.gg/tcpPorts": "http=25432",
+	})
+	oldService.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	newService := newTestService("new-db", map[string]string{
+		"osiris.dm.gg/tcpPorts": "http=25432",
+	})
+	newService.CreationTimestamp = metav1.NewTime(time.Now())
+	a := &activator{
+		services: map[string]*corev1.Service{
+			"old-db": oldService,
+			"new-db": newService,
+		},
+	}
+
+	a.updateIndex()
+
+	require.Contains(t, a.tcpAppsByPort, int32(25432))
+	assert.Equal(t, "old-db", a.tcpAppsByPort[25432].ServiceName)
+	assert.Len(t, a.tcpAppsByPort, 1)
+	// the TCP ports are never routed as HTTP
+	assert.NotContains(t, a.appsByHost, "new-db.my-ns:8080")
+}
@@ -0,0 +1,131 @@
+package activator
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// runTLSPassthroughServer accepts TLS connections for the apps behind TLS
+// passthrough ports. It reads the SNI of the TLS ClientHello to find the app,
+// activates it, and then splices the raw TCP stream to its service - without
+// terminating TLS.
+func (a *activator) runTLSPassthroughServer(ctx context.Context) error {
+	listener, err := net.Listen("tcp", a.tlsPassthroughAddr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		glog.Info("TLS passthrough server is shutting down")
+		listener.Close() // nolint: errcheck
+	}()
+	err = a.serveTLSPassthrough(listener)
+	if ctx.Err() != nil {
+		// the listener was closed on purpose
+		return nil
+	}
+	return err
+}
+
+func (a *activator) serveTLSPassthrough(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go a.handleTLSConnection(conn)
+	}
+}
+
+func (a *activator) handleTLSConnection(conn net.Conn) {
+	defer conn.Close()
+
+	// Don't wait forever for a ClientHello
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		glog.Errorf("Error setting read deadline on TLS connection: %s", err)
+		return
+	}
+	hello, clientReader, err := peekClientHello(conn)
+	if err != nil {
+		glog.Errorf(
+			"Error reading TLS ClientHello from %s: %s",
+			conn.RemoteAddr(),
+			err,
+		)
+		return
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		glog.Errorf("Error resetting read deadline on TLS connection: %s", err)
+		return
+	}
+
+	serverName := strings.ToLower(hello.ServerName)
+	glog.Infof("TLS connection received for server name %s", serverName)
+	a.indicesLock.RLock()
+	app, ok := a.tlsAppsByHost[serverName]
+	a.indicesLock.RUnlock()
+	if !ok {
+		glog.Infof("No deployment/statefulset found for server name %s", serverName)
+		return
+	}
+
+	a.activateAndSplice(conn, clientReader, app, protocolTLS)
+}
+
+// peekClientHello reads the TLS ClientHello from the given reader, without
+// answering it. It returns a reader that replays the bytes already read,
+// followed by the rest of the data.
+func peekClientHello(reader io.Reader) (*tls.ClientHelloInfo, io.Reader, error) {
+	peeked := &bytes.Buffer{}
+	hello, err := readClientHello(io.TeeReader(reader, peeked))
+	if err != nil {
+		return nil, nil, err
+	}
+	return hello, io.MultiReader(peeked, reader), nil
+}
+
+// readClientHello uses the TLS server implementation of the standard library
+// to parse a ClientHello, aborting the handshake as soon as it is parsed.
+func readClientHello(reader io.Reader) (*tls.ClientHelloInfo, error) {
+	var hello *tls.ClientHelloInfo
+	errHelloRead := errors.New("ClientHello read")
+	err := tls.Server(readOnlyConn{reader: reader}, &tls.Config{
+		GetConfigForClient: func(clientHello *tls.ClientHelloInfo) (*tls.Config, error) {
+			hello = &tls.ClientHelloInfo{}
+			*hello = *clientHello
+			return nil, errHelloRead
+		},
+	}).Handshake()
+	if hello == nil {
+		return nil, err
+	}
+	return hello, nil
+}
+
+// readOnlyConn is a net.Conn that can only be read from, used to parse a
+// ClientHello without writing anything to the client.
+type readOnlyConn struct {
+	reader io.Reader
+}
+
+func (c readOnlyConn) Read(p []byte) (int, error)         { return c.reader.Read(p) }
+func (c readOnlyConn) Write(p []byte) (int, error)        { return 0, io.ErrClosedPipe }
+func (c readOnlyConn) Close() error                       { return nil }
+func (c readOnlyConn) LocalAddr() net.Addr                { return nil }
+func (c readOnlyConn) RemoteAddr() net.Addr               { return nil }
+func (c readOnlyConn) SetDeadline(t time.Time) error      { return nil }
+func (c readOnlyConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c readOnlyConn) SetWriteDeadline(t time.Time) error { return nil }
@@ -0,0 +1,140 @@
+package activator
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCertificate generates a self-signed certificate for the given host
+func newTestCertificate(t *testing.T, host string) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: host},
+		DNSNames:              []string{host},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestPeekClientHello(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+	go func() {
+		// the handshake never completes: we only want the ClientHello
+		tls.Client(clientConn, &tls.Config{ServerName: "my-app.my-ns"}).Handshake() // nolint: errcheck
+	}()
+
+	hello, reader, err := peekClientHello(serverConn)
+	require.NoError(t, err)
+	assert.Equal(t, "my-app.my-ns", hello.ServerName)
+
+	// the ClientHello is replayed, starting with a TLS handshake record
+	header := make([]byte, 1)
+	_, err = reader.Read(header)
+	require.NoError(t, err)
+	assert.Equal(t, byte(0x16), header[0])
+}
+
+func TestTLSPassthrough(t *testing.T) {
+	const host = "my-app.my-ns"
+	cert, pool := newTestCertificate(t, host)
+
+	// the app terminates TLS itself
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello from " + r.TLS.ServerName)) // nolint: errcheck
+	}))
+	backend.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	backend.StartTLS()
+	defer backend.Close()
+	targetURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	tlsApp := &app{
+		Namespace:      "my-ns",
+		Name:           "my-app",
+		Kind:           appKindDeployment,
+		TargetURL:      targetURL,
+		MaxRequestWait: 5 * time.Second,
+	}
+	activation := newAppActivation()
+	a := &activator{
+		tlsAppsByHost: map[string]*app{host: tlsApp},
+		appActivations: map[string]*appActivation{
+			getKey(tlsApp.Namespace, tlsApp.Kind, tlsApp.Name): activation,
+		},
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go a.serveTLSPassthrough(listener) // nolint: errcheck
+
+	// the app becomes ready a bit later
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(activation.successCh)
+	}()
+
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool, ServerName: host},
+		},
+	}
+	resp, err := client.Get("https://" + listener.Addr().String())
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "hello from "+host, string(body))
+}
+
+func TestTLSPassthroughUnknownServerName(t *testing.T) {
+	_, pool := newTestCertificate(t, "unknown.my-ns")
+	a := &activator{
+		tlsAppsByHost:  map[string]*app{},
+		appActivations: map[string]*appActivation{},
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go a.serveTLSPassthrough(listener) // nolint: errcheck
+
+	conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{
+		RootCAs:    pool,
+		ServerName: "unknown.my-ns",
+	})
+	if err == nil {
+		conn.Close()
+	}
+	assert.Error(t, err)
+}
@@ -0,0 +1,199 @@
+package activator
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// activationStatusPath is the path of the activation status endpoint,
+	// polled by the waking up page. It is served by the activator for every
+	// app host - until the app is ready and serves its own requests.
+	activationStatusPath = "/.osiris/activation-status"
+	// wakingUpPageTemplateKey is the key of the template in the ConfigMap
+	// referenced by the osiris.dm.gg/wakingUpPageTemplate annotation.
+	wakingUpPageTemplateKey = "template.html"
+)
+
+// defaultWakingUpPageTemplate is used when the service doesn't reference a
+// ConfigMap, or when the template can't be retrieved.
+// nolint: lll
+var defaultWakingUpPageTemplate = template.Must(template.New("wakingUpPage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Name }} is waking up</title>
+<style>
+body { font-family: sans-serif; text-align: center; margin-top: 15%; color: #333; }
+progress { width: 300px; }
+</style>
+</head>
+<body>
+<h1>{{ .Name }} is waking up</h1>
+<p id="message">It was asleep to save resources. This page will reload once it is ready.</p>
+<progress id="progress" max="{{ .ExpectedSeconds }}" value="{{ .ElapsedSeconds }}"></progress>
+<script>
+(function() {
+  var progress = document.getElementById("progress");
+  var poll = function() {
+    fetch("{{ .StatusPath }}", { cache: "no-store" })
+      .then(function(resp) { return resp.json(); })
+      .then(function(status) {
+        if (status.ready) {
+          window.location.reload();
+          return;
+        }
+        if (status.failed) {
+          document.getElementById("message").textContent = "It failed to wake up. Please retry later.";
+          return;
+        }
+        progress.max = Math.max(status.expectedSeconds, status.elapsedSeconds + 1);
+        progress.value = status.elapsedSeconds;
+        setTimeout(poll, 1000);
+      })
+      // not a status response: the app itself is answering
+      .catch(function() { window.location.reload(); });
+  };
+  setTimeout(poll, 1000);
+})();
+</script>
+</body>
+</html>
+`))
+
+// wakingUpPageData is the data available to the waking up page templates
+type wakingUpPageData struct {
+	Namespace       string
+	Name            string
+	Kind            string
+	StatusPath      string
+	ElapsedSeconds  int
+	ExpectedSeconds int
+}
+
+// activationStatus is the response of the activation status endpoint
+type activationStatus struct {
+	Ready           bool `json:"ready"`
+	Failed          bool `json:"failed"`
+	ElapsedSeconds  int  `json:"elapsedSeconds"`
+	ExpectedSeconds int  `json:"expectedSeconds"`
+}
+
+// acceptsHTML checks if the request comes from a browser - which explicitly
+// accepts HTML responses.
+func acceptsHTML(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(mediaRange)
+			if err == nil && mediaType == "text/html" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serveActivationStatus serves the status of the activation of the given app.
+// When no activation is in progress, the app is considered ready: this
+// activator is still serving its requests only until the endpoints are
+// updated.
+func (a *activator) serveActivationStatus(w http.ResponseWriter, app *app) {
+	appKey := getKey(app.Namespace, app.Kind, app.Name)
+	a.appActivationsLock.RLock()
+	activation, ok := a.appActivations[appKey]
+	a.appActivationsLock.RUnlock()
+
+	status := activationStatus{Ready: true}
+	if ok {
+		status = activation.status(a.expectedActivationDuration(appKey), time.Now())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		glog.Errorf("Error encoding activation status in json: %s", err)
+	}
+}
+
+func (a *appActivation) status(
+	expectedDuration time.Duration,
+	now time.Time,
+) activationStatus {
+	status := activationStatus{
+		ElapsedSeconds:  int(now.Sub(a.startTime).Seconds()),
+		ExpectedSeconds: int(expectedDuration.Seconds()),
+	}
+	select {
+	case <-a.successCh:
+		status.Ready = true
+	case <-a.timeoutCh:
+		status.Failed = true
+	default:
+	}
+	return status
+}
+
+// serveWakingUpPage answers at once with the waking up page of the app,
+// instead of holding the request until the end of the activation.
+func (a *activator) serveWakingUpPage(
+	w http.ResponseWriter,
+	app *app,
+	activation *appActivation,
+) {
+	appKey := getKey(app.Namespace, app.Kind, app.Name)
+	expectedDuration := a.expectedActivationDuration(appKey)
+	status := activation.status(expectedDuration, time.Now())
+	data := wakingUpPageData{
+		Namespace:       app.Namespace,
+		Name:            app.Name,
+		Kind:            string(app.Kind),
+		StatusPath:      activationStatusPath,
+		ElapsedSeconds:  status.ElapsedSeconds,
+		ExpectedSeconds: status.ExpectedSeconds,
+	}
+
+	var page bytes.Buffer
+	if err := a.wakingUpPageTemplate(app).Execute(&page, data); err != nil {
+		glog.Errorf(
+			"Error rendering the waking up page of %s %s in namespace %s: %s",
+			app.Kind,
+			app.Name,
+			app.Namespace,
+			err,
+		)
+		page.Reset()
+		_ = defaultWakingUpPageTemplate.Execute(&page, data)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set(
+		"Retry-After",
+		strconv.Itoa(retryAfter(activation, expectedDuration, time.Now())),
+	)
+	w.WriteHeader(http.StatusServiceUnavailable)
+	if _, err := w.Write(page.Bytes()); err != nil {
+		glog.Errorf("Error writing response body: %s", err)
+	}
+}
+
+// wakingUpPageTemplate returns the template of the waking up page of the app:
+// the one from the ConfigMap referenced by the service, if any, or the
+// default one.
+func (a *activator) wakingUpPageTemplate(app *app) *template.Template {
+	if len(app.WakingUpPageTemplate) == 0 {
+		return defaultWakingUpPageTemplate
+	}
+	return a.wakingUpPageTemplates.get(app.Namespace, app.WakingUpPageTemplate)
+}
@@ -0,0 +1,109 @@
+package activator
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// wakingUpPageTemplatesCacheTTL is how long a waking up page template is
+// cached before its ConfigMap is retrieved again - so that the changes of the
+// template are eventually used.
+const wakingUpPageTemplatesCacheTTL = time.Minute
+
+type cachedWakingUpPageTemplate struct {
+	template *template.Template
+	// resourceVersion is the version of the ConfigMap the template was parsed
+	// from, so that it is parsed again only when changed
+	resourceVersion string
+	expiresAt       time.Time
+}
+
+// wakingUpPageTemplatesCache is a small cache of the parsed waking up page
+// templates, to avoid retrieving the same ConfigMaps on each browser request
+// during an activation. We don't use an informer here, because watching all
+// the ConfigMaps of the cluster would be way too expensive for the few we
+// need.
+type wakingUpPageTemplatesCache struct {
+	kubeClient kubernetes.Interface
+	templates  map[string]cachedWakingUpPageTemplate
+	lock       sync.Mutex
+}
+
+func newWakingUpPageTemplatesCache(
+	kubeClient kubernetes.Interface,
+) *wakingUpPageTemplatesCache {
+	return &wakingUpPageTemplatesCache{
+		kubeClient: kubeClient,
+		templates:  map[string]cachedWakingUpPageTemplate{},
+	}
+}
+
+// get returns the waking up page template of the given ConfigMap, or the
+// default one if it can't be retrieved or parsed. Failures are cached too, so
+// that a missing ConfigMap doesn't cause a request to the API server for each
+// browser request.
+func (c *wakingUpPageTemplatesCache) get(namespace, name string) *template.Template {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	cached, found := c.templates[key]
+	if found && time.Now().Before(cached.expiresAt) {
+		return cached.template
+	}
+	cached.expiresAt = time.Now().Add(wakingUpPageTemplatesCacheTTL)
+	defer func() {
+		c.templates[key] = cached
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	configMap, err := c.kubeClient.CoreV1().ConfigMaps(namespace).Get(
+		ctx,
+		name,
+		metav1.GetOptions{},
+	)
+	if err != nil {
+		glog.Errorf(
+			"Error retrieving waking up page configmap %s in namespace %s: %s",
+			name,
+			namespace,
+			err,
+		)
+		cached.template, cached.resourceVersion = defaultWakingUpPageTemplate, ""
+		return cached.template
+	}
+	if found && cached.resourceVersion == configMap.ResourceVersion {
+		return cached.template
+	}
+	cached.template = defaultWakingUpPageTemplate
+	cached.resourceVersion = configMap.ResourceVersion
+	rawTemplate, ok := configMap.Data[wakingUpPageTemplateKey]
+	if !ok {
+		glog.Errorf(
+			"Waking up page configmap %s in namespace %s has no %s key",
+			name,
+			namespace,
+			wakingUpPageTemplateKey,
+		)
+		return cached.template
+	}
+	tmpl, err := template.New("wakingUpPage").Parse(rawTemplate)
+	if err != nil {
+		glog.Errorf(
+			"Invalid waking up page template in configmap %s in namespace %s: %s",
+			name,
+			namespace,
+			err,
+		)
+		return cached.template
+	}
+	cached.template = tmpl
+	return cached.template
+}
@@ -0,0 +1,68 @@
+package activator
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWakingUpPageTemplatesCache(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "ns",
+			Name:            "waking-up",
+			ResourceVersion: "1",
+		},
+		Data: map[string]string{wakingUpPageTemplateKey: "first {{ .Name }}"},
+	})
+	cache := newWakingUpPageTemplatesCache(kubeClient)
+	render := func() string {
+		var page bytes.Buffer
+		require.NoError(t, cache.get("ns", "waking-up").Execute(&page, wakingUpPageData{Name: "my-app"}))
+		return page.String()
+	}
+	countGets := func() int {
+		var gets int
+		for _, action := range kubeClient.Actions() {
+			if action.GetVerb() == "get" {
+				gets++
+			}
+		}
+		return gets
+	}
+
+	// a burst of requests only retrieves the configmap once
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, "first my-app", render())
+	}
+	assert.Equal(t, 1, countGets())
+
+	// the configmap is retrieved again once the cached template has expired
+	_, err := kubeClient.CoreV1().ConfigMaps("ns").Update(context.Background(), &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "ns",
+			Name:            "waking-up",
+			ResourceVersion: "2",
+		},
+		Data: map[string]string{wakingUpPageTemplateKey: "second {{ .Name }}"},
+	}, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "first my-app", render())
+	cached := cache.templates["ns/waking-up"]
+	cached.expiresAt = time.Now().Add(-time.Second)
+	cache.templates["ns/waking-up"] = cached
+	assert.Equal(t, "second my-app", render())
+	assert.Equal(t, 2, countGets())
+
+	// the missing configmaps are cached too
+	assert.Equal(t, defaultWakingUpPageTemplate, cache.get("ns", "missing"))
+	assert.Equal(t, defaultWakingUpPageTemplate, cache.get("ns", "missing"))
+	assert.Equal(t, 3, countGets())
+}
@@ -0,0 +1,208 @@
+package activator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAcceptsHTML(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		accept         string
+		expectedResult bool
+	}{
+		{
+			name:           "browser",
+			method:         http.MethodGet,
+			accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			expectedResult: true,
+		},
+		{
+			name:           "api client",
+			method:         http.MethodGet,
+			accept:         "application/json",
+			expectedResult: false,
+		},
+		{
+			name:           "no accept header",
+			method:         http.MethodGet,
+			expectedResult: false,
+		},
+		{
+			name:           "form submission",
+			method:         http.MethodPost,
+			accept:         "text/html",
+			expectedResult: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, "/", nil)
+			if len(test.accept) > 0 {
+				r.Header.Set("Accept", test.accept)
+			}
+
+			assert.Equal(t, test.expectedResult, acceptsHTML(r))
+		})
+	}
+}
+
+func TestServeWakingUpPage(t *testing.T) {
+	tests := []struct {
+		name             string
+		templateName     string
+		configMaps       []*corev1.ConfigMap
+		expectedContains string
+	}{
+		{
+			name:             "default template",
+			expectedContains: "my-app is waking up",
+		},
+		{
+			name:         "custom template",
+			templateName: "waking-up",
+			configMaps: []*corev1.ConfigMap{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "waking-up"},
+				Data: map[string]string{
+					wakingUpPageTemplateKey: "<p>Please wait, {{ .Name }} starts in {{ .ExpectedSeconds }}s</p>",
+				},
+			}},
+			expectedContains: "<p>Please wait, my-app starts in 30s</p>",
+		},
+		{
+			name:             "missing configmap",
+			templateName:     "missing",
+			expectedContains: "my-app is waking up",
+		},
+		{
+			name:         "invalid template",
+			templateName: "invalid",
+			configMaps: []*corev1.ConfigMap{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "invalid"},
+				Data: map[string]string{
+					wakingUpPageTemplateKey: "{{ .Name ",
+				},
+			}},
+			expectedContains: "my-app is waking up",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kubeClient := fake.NewSimpleClientset()
+			for _, configMap := range test.configMaps {
+				_, err := kubeClient.CoreV1().ConfigMaps(configMap.Namespace).Create(
+					context.Background(),
+					configMap,
+					metav1.CreateOptions{},
+				)
+				require.NoError(t, err)
+			}
+			a := &activator{
+				kubeClient:            kubeClient,
+				activationDurations:   map[string]time.Duration{},
+				wakingUpPageTemplates: newWakingUpPageTemplatesCache(kubeClient),
+			}
+			app := &app{
+				Namespace:            "ns",
+				Name:                 "my-app",
+				Kind:                 appKindDeployment,
+				WakingUpPage:         true,
+				WakingUpPageTemplate: test.templateName,
+			}
+			w := httptest.NewRecorder()
+
+			a.serveWakingUpPage(w, app, newAppActivation())
+
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+			assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+			assert.Equal(t, "30", w.Header().Get("Retry-After"))
+			assert.True(
+				t,
+				strings.Contains(w.Body.String(), test.expectedContains),
+				w.Body.String(),
+			)
+		})
+	}
+}
+
+func TestServeActivationStatus(t *testing.T) {
+	app := &app{Namespace: "ns", Name: "my-app", Kind: appKindDeployment}
+	appKey := getKey(app.Namespace, app.Kind, app.Name)
+
+	inProgress := newAppActivation()
+	inProgress.startTime = time.Now().Add(-5 * time.Second)
+	succeeded := newAppActivation()
+	close(succeeded.successCh)
+	timedOut := newAppActivation()
+	close(timedOut.timeoutCh)
+
+	tests := []struct {
+		name           string
+		activation     *appActivation
+		expectedStatus activationStatus
+	}{
+		{
+			name:           "no activation in progress",
+			expectedStatus: activationStatus{Ready: true},
+		},
+		{
+			name:       "activation in progress",
+			activation: inProgress,
+			expectedStatus: activationStatus{
+				ElapsedSeconds:  5,
+				ExpectedSeconds: 20,
+			},
+		},
+		{
+			name:       "activation succeeded",
+			activation: succeeded,
+			expectedStatus: activationStatus{
+				Ready:           true,
+				ExpectedSeconds: 20,
+			},
+		},
+		{
+			name:       "activation timed out",
+			activation: timedOut,
+			expectedStatus: activationStatus{
+				Failed:          true,
+				ExpectedSeconds: 20,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &activator{
+				appActivations: map[string]*appActivation{},
+				activationDurations: map[string]time.Duration{
+					appKey: 20 * time.Second,
+				},
+			}
+			if test.activation != nil {
+				a.appActivations[appKey] = test.activation
+			}
+			w := httptest.NewRecorder()
+
+			a.serveActivationStatus(w, app)
+
+			var actual activationStatus
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &actual))
+			assert.Equal(t, test.expectedStatus, actual)
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package zeroscaler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	k8s "github.com/dailymotion-oss/osiris/pkg/kubernetes"
+)
+
+func (z *zeroscaler) syncNamespace(obj interface{}) {
+	namespace, ok := obj.(*corev1.Namespace)
+	if !ok {
+		return
+	}
+	z.enforceActiveWorkloadsBudget(namespace.Name)
+}
+
+// budgetWorkload is an active Osiris-enabled workload of a namespace with an
+// active workloads budget
+type budgetWorkload struct {
+	kind     string
+	name     string
+	replicas int32
+	// collector is the metrics collector of the workload, if it is running its
+	// minimum number of replicas - nil for the busier workloads
+	collector *metricsCollector
+}
+
+func (w budgetWorkload) key(namespace string) string {
+	return getKey(w.kind, namespace, w.name)
+}
+
+// enforceActiveWorkloadsBudget ensures that the number of active Osiris-enabled
+// workloads in the given namespace doesn't exceed the budget defined by the
+// osiris.dm.gg/maxActiveWorkloads annotation of the namespace. If it does, the
+// least recently active workloads are scaled to zero, even if they are not
+// idle yet. All the workloads not scaled to zero are counted, but the busier
+// ones - running more than their minimum number of replicas, without a
+// metrics collector - are scaled to zero last, and the paused ones never.
+func (z *zeroscaler) enforceActiveWorkloadsBudget(namespace string) {
+	obj, found, err := z.namespacesInformer.GetStore().GetByKey(namespace)
+	if err != nil || !found {
+		return
+	}
+	maxActiveWorkloads, ok :=
+		k8s.GetMaxActiveWorkloads(obj.(*corev1.Namespace).Annotations)
+	if !ok {
+		return
+	}
+	if z.controlWatcher.State().IsFrozen(namespace) {
+		return
+	}
+
+	workloads := z.activeWorkloads(namespace)
+	activeWorkloads := len(workloads)
+	if activeWorkloads <= maxActiveWorkloads {
+		return
+	}
+	z.collectorsLock.Lock()
+	var (
+		idleCandidates []*metricsCollector
+		busyCandidates []budgetWorkload
+	)
+	for _, workload := range workloads {
+		key := workload.key(namespace)
+		if _, paused := z.pauses[key]; paused {
+			continue
+		}
+		if collector, ok := z.collectors[key]; ok {
+			idleCandidates = append(idleCandidates, collector)
+		} else {
+			busyCandidates = append(busyCandidates, workload)
+		}
+	}
+	// the collectors can only be ranked once they all know whether their
+	// workload has been active - for example not right after a restart of the
+	// zeroscaler. The budget will be enforced on a later sync.
+	for _, collector := range idleCandidates {
+		if !collector.activityKnown() {
+			z.collectorsLock.Unlock()
+			glog.Infof(
+				"Namespace %s has %d active workloads for a budget of %d; "+
+					"waiting for the activity of %s %s to be known",
+				namespace,
+				activeWorkloads,
+				maxActiveWorkloads,
+				collector.config.appKind,
+				collector.config.appName,
+			)
+			return
+		}
+	}
+	var evicted []budgetWorkload
+	for _, collector := range leastRecentlyActiveCollectors(
+		idleCandidates,
+		activeWorkloads-maxActiveWorkloads,
+	) {
+		evicted = append(evicted, budgetWorkload{
+			kind:      collector.config.appKind,
+			name:      collector.config.appName,
+			collector: collector,
+		})
+	}
+	evicted = append(evicted, leastBusyWorkloads(
+		busyCandidates,
+		activeWorkloads-maxActiveWorkloads-len(evicted),
+	)...)
+	evictedKeys := make([]string, 0, len(evicted))
+	for _, workload := range evicted {
+		evictedKeys = append(evictedKeys, workload.key(namespace))
+		if workload.collector != nil {
+			// a new collector will be started if the workload is re-activated later
+			workload.collector.stop()
+			delete(z.collectors, workload.key(namespace))
+		}
+	}
+	z.collectorsLock.Unlock()
+
+	reason := fmt.Sprintf(
+		"least recently active workload of a namespace with %d active "+
+			"workloads for a budget of %d",
+		activeWorkloads,
+		maxActiveWorkloads,
+	)
+	for _, workload := range evicted {
+		glog.Infof(
+			"Namespace %s has %d active workloads for a budget of %d; "+
+				"scaling least recently active %s %s to zero",
+			namespace,
+			activeWorkloads,
+			maxActiveWorkloads,
+			workload.kind,
+			workload.name,
+		)
+		// the dependencies shared by the evicted workloads are scaled to zero
+		// with them. A failure is logged: the workload will be evicted again on
+		// a later sync if the namespace is still over budget
+		err := scaleToZeroWithDependencies(
+			z.ctx,
+			z.kubeClient,
+			workload.kind,
+			namespace,
+			workload.name,
+			func(depKind, depNamespace, depName string) bool {
+				return z.dependencyInUse(evictedKeys, depKind, depNamespace, depName)
+			},
+		)
+		if err != nil {
+			z.auditLog.record(
+				workload.kind,
+				namespace,
+				workload.name,
+				decisionScaleToZeroFailed,
+				fmt.Sprintf("%s; scaling to zero failed: %s", reason, err),
+			)
+			continue
+		}
+		z.auditLog.record(
+			workload.kind,
+			namespace,
+			workload.name,
+			decisionScaledToZero,
+			reason,
+		)
+	}
+}
+
+// activeWorkloads returns the Osiris-enabled workloads of the given namespace
+// which are not scaled to zero.
+func (z *zeroscaler) activeWorkloads(namespace string) []budgetWorkload {
+	var workloads []budgetWorkload
+	for _, obj := range z.deploymentsInformer.GetStore().List() {
+		deployment := obj.(*appsv1.Deployment)
+		if deployment.Namespace == namespace &&
+			k8s.WorkloadIsEligibleForAutoScaling(deployment.Annotations) &&
+			deployment.Spec.Replicas != nil && *deployment.Spec.Replicas > 0 {
+			workloads = append(workloads, budgetWorkload{
+				kind:     "Deployment",
+				name:     deployment.Name,
+				replicas: *deployment.Spec.Replicas,
+			})
+		}
+	}
+	for _, obj := range z.statefulSetsInformer.GetStore().List() {
+		statefulSet := obj.(*appsv1.StatefulSet)
+		if statefulSet.Namespace == namespace &&
+			k8s.WorkloadIsEligibleForAutoScaling(statefulSet.Annotations) &&
+			statefulSet.Spec.Replicas != nil && *statefulSet.Spec.Replicas > 0 {
+			workloads = append(workloads, budgetWorkload{
+				kind:     "StatefulSet",
+				name:     statefulSet.Name,
+				replicas: *statefulSet.Spec.Replicas,
+			})
+		}
+	}
+	for _, obj := range z.daemonSetsInformer.GetStore().List() {
+		daemonSet := obj.(*appsv1.DaemonSet)
+		if daemonSet.Namespace == namespace &&
+			k8s.WorkloadIsEligibleForAutoScaling(daemonSet.Annotations) &&
+			!k8s.DaemonSetIsParked(daemonSet.Spec.Template.Spec.NodeSelector) {
+			workloads = append(workloads, budgetWorkload{
+				kind:     "DaemonSet",
+				name:     daemonSet.Name,
+				replicas: daemonSet.Status.DesiredNumberScheduled,
+			})
+		}
+	}
+	return workloads
+}
+
+// dependencyInUse returns true if the given workload is a dependency of an
+// active Osiris-enabled workload - other than the given excluded dependents,
+// which are being scaled to zero - in which case it must not be scaled to
+// zero with them.
+func (z *zeroscaler) dependencyInUse(
+	excludedDependents []string,
+	kind string,
+	namespace string,
+	name string,
+) bool {
+	dependencyKey := getKey(strings.ToLower(kind), namespace, name)
+	isActiveDependent := func(key string, annotations map[string]string) bool {
+		for _, excluded := range excludedDependents {
+			if key == excluded {
+				return false
+			}
+		}
+		if !k8s.WorkloadIsEligibleForAutoScaling(annotations) {
+			return false
+		}
+		for _, dependency := range workloadDependencies(annotations) {
+			if dependency == dependencyKey {
+				return true
+			}
+		}
+		return false
+	}
+	for _, obj := range z.deploymentsInformer.GetStore().List() {
+		deployment := obj.(*appsv1.Deployment)
+		if (deployment.Spec.Replicas == nil || *deployment.Spec.Replicas > 0) &&
+			isActiveDependent(
+				getKey("Deployment", deployment.Namespace, deployment.Name),
+				deployment.Annotations,
+			) {
+			return true
+		}
+	}
+	for _, obj := range z.statefulSetsInformer.GetStore().List() {
+		statefulSet := obj.(*appsv1.StatefulSet)
+		if (statefulSet.Spec.Replicas == nil || *statefulSet.Spec.Replicas > 0) &&
+			isActiveDependent(
+				getKey("StatefulSet", statefulSet.Namespace, statefulSet.Name),
+				statefulSet.Annotations,
+			) {
+			return true
+		}
+	}
+	for _, obj := range z.daemonSetsInformer.GetStore().List() {
+		daemonSet := obj.(*appsv1.DaemonSet)
+		if !k8s.DaemonSetIsParked(daemonSet.Spec.Template.Spec.NodeSelector) &&
+			isActiveDependent(
+				getKey("DaemonSet", daemonSet.Namespace, daemonSet.Name),
+				daemonSet.Annotations,
+			) {
+			return true
+		}
+	}
+	return false
+}
+
+// workloadDependencies returns the keys - with a lower-case kind - of the
+// dependencies listed in the osiris.dm.gg/dependencies annotation
+func workloadDependencies(annotations map[string]string) []string {
+	var dependencies []string
+	value := cleanAnnotationValue(annotations["osiris.dm.gg/dependencies"])
+	for _, dependency := range strings.Split(value, ",") {
+		elems := strings.SplitN(dependency, ":", 2)
+		if len(elems) != 2 {
+			continue
+		}
+		kind := strings.ToLower(elems[0])
+		elems = strings.SplitN(elems[1], "/", 2)
+		if len(elems) != 2 {
+			continue
+		}
+		dependencies = append(dependencies, getKey(kind, elems[0], elems[1]))
+	}
+	return dependencies
+}
+
+// leastRecentlyActiveCollectors sorts the given collectors from the least
+// recently active to the most recently active one, and returns (at most) the
+// first count ones.
+func leastRecentlyActiveCollectors(
+	collectors []*metricsCollector,
+	count int,
+) []*metricsCollector {
+	sort.SliceStable(collectors, func(i, j int) bool {
+		return collectors[i].getLastActivityTime().Before(
+			collectors[j].getLastActivityTime(),
+		)
+	})
+	if count > len(collectors) {
+		count = len(collectors)
+	}
+	return collectors[:count]
+}
+
+// leastBusyWorkloads sorts the given workloads from the one running the
+// fewest replicas to the one running the most, and returns (at most) the
+// first count ones.
+func leastBusyWorkloads(workloads []budgetWorkload, count int) []budgetWorkload {
+	sort.SliceStable(workloads, func(i, j int) bool {
+		if workloads[i].replicas != workloads[j].replicas {
+			return workloads[i].replicas < workloads[j].replicas
+		}
+		return workloads[i].name < workloads[j].name
+	})
+	if count < 0 {
+		count = 0
+	}
+	if count > len(workloads) {
+		count = len(workloads)
+	}
+	return workloads[:count]
+}
@@ -0,0 +1,226 @@
+package zeroscaler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestLeastRecentlyActiveCollectors(t *testing.T) {
+	var (
+		now    = time.Now()
+		recent = &metricsCollector{
+			config:           metricsCollectorConfig{appName: "recent"},
+			lastActivityTime: now,
+		}
+		old = &metricsCollector{
+			config:           metricsCollectorConfig{appName: "old"},
+			lastActivityTime: now.Add(-1 * time.Hour),
+		}
+		older = &metricsCollector{
+			config:           metricsCollectorConfig{appName: "older"},
+			lastActivityTime: now.Add(-2 * time.Hour),
+		}
+	)
+
+	tests := []struct {
+		name          string
+		collectors    []*metricsCollector
+		count         int
+		expectedNames []string
+	}{
+		{
+			name:          "evict the least recently active one",
+			collectors:    []*metricsCollector{recent, older, old},
+			count:         1,
+			expectedNames: []string{"older"},
+		},
+		{
+			name:          "evict the 2 least recently active ones",
+			collectors:    []*metricsCollector{old, recent, older},
+			count:         2,
+			expectedNames: []string{"older", "old"},
+		},
+		{
+			name:          "not enough collectors",
+			collectors:    []*metricsCollector{recent, old},
+			count:         3,
+			expectedNames: []string{"old", "recent"},
+		},
+		{
+			name:          "no collectors",
+			count:         1,
+			expectedNames: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := leastRecentlyActiveCollectors(test.collectors, test.count)
+
+			actualNames := []string{}
+			for _, collector := range actual {
+				actualNames = append(actualNames, collector.config.appName)
+			}
+			assert.Equal(t, test.expectedNames, actualNames)
+		})
+	}
+}
+
+func TestWorkloadDependencies(t *testing.T) {
+	assert.Equal(t, []string{
+		"deployment:my-ns/db",
+		"statefulset:other-ns/cache",
+	}, workloadDependencies(map[string]string{
+		"osiris.dm.gg/dependencies": "'Deployment:my-ns/db,statefulset:other-ns/cache,invalid'",
+	}))
+	assert.Empty(t, workloadDependencies(map[string]string{}))
+}
+
+func TestDependencyInUse(t *testing.T) {
+	newDeployment := func(name string, replicas int32, dependencies string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "my-ns",
+				Name:      name,
+				Annotations: map[string]string{
+					"osiris.dm.gg/enableScaling": "true",
+					"osiris.dm.gg/dependencies":  dependencies,
+				},
+			},
+			Spec: appsv1.DeploymentSpec{Replicas: &replicas},
+		}
+	}
+	z := &zeroscaler{
+		deploymentsInformer:  cache.NewSharedInformer(nil, &appsv1.Deployment{}, 0),
+		statefulSetsInformer: cache.NewSharedInformer(nil, &appsv1.StatefulSet{}, 0),
+		daemonSetsInformer:   cache.NewSharedInformer(nil, &appsv1.DaemonSet{}, 0),
+	}
+	for _, deployment := range []*appsv1.Deployment{
+		newDeployment("evicted", 1, "deployment:my-ns/shared,deployment:my-ns/own"),
+		newDeployment("active", 1, "deployment:my-ns/shared"),
+		newDeployment("inactive", 0, "deployment:my-ns/own"),
+	} {
+		require.NoError(t, z.deploymentsInformer.GetStore().Add(deployment))
+	}
+
+	dependent := getKey("Deployment", "my-ns", "evicted")
+	assert.True(t, z.dependencyInUse([]string{dependent}, "deployment", "my-ns", "shared"))
+	assert.False(t, z.dependencyInUse([]string{dependent}, "deployment", "my-ns", "own"))
+	assert.False(t, z.dependencyInUse([]string{dependent}, "deployment", "other-ns", "shared"))
+}
+
+func TestEnforceActiveWorkloadsBudget(t *testing.T) {
+	newDeployment := func(name string, replicas int32, annotations map[string]string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "my-ns",
+				Name:        name,
+				Annotations: annotations,
+			},
+			Spec: appsv1.DeploymentSpec{Replicas: &replicas},
+		}
+	}
+	enabled := func(dependencies string) map[string]string {
+		return map[string]string{
+			"osiris.dm.gg/enableScaling": "true",
+			"osiris.dm.gg/dependencies":  dependencies,
+		}
+	}
+	deployments := []*appsv1.Deployment{
+		// at their minimum number of replicas, with a metrics collector
+		newDeployment("old", 1, enabled("deployment:my-ns/shared,deployment:my-ns/db")),
+		newDeployment("recent", 1, enabled("")),
+		newDeployment("paused", 1, enabled("")),
+		// running more than their minimum number of replicas
+		newDeployment("busy", 3, enabled("deployment:my-ns/shared")),
+		newDeployment("busier", 5, enabled("deployment:my-ns/db")),
+		// not counted
+		newDeployment("asleep", 0, enabled("")),
+		newDeployment("shared", 1, nil),
+		newDeployment("db", 1, nil),
+	}
+	var objects []runtime.Object
+	for _, deployment := range deployments {
+		objects = append(objects, deployment)
+	}
+	kubeClient := fake.NewSimpleClientset(objects...)
+	z := &zeroscaler{
+		kubeClient:           kubeClient,
+		deploymentsInformer:  cache.NewSharedInformer(nil, &appsv1.Deployment{}, 0),
+		statefulSetsInformer: cache.NewSharedInformer(nil, &appsv1.StatefulSet{}, 0),
+		daemonSetsInformer:   cache.NewSharedInformer(nil, &appsv1.DaemonSet{}, 0),
+		namespacesInformer:   cache.NewSharedInformer(nil, &corev1.Namespace{}, 0),
+		collectors:           map[string]*metricsCollector{},
+		pauses: map[string]time.Time{
+			getKey("Deployment", "my-ns", "paused"): time.Now().Add(time.Hour),
+		},
+		controlWatcher: staticWatcher{},
+		auditLog:       newAuditLog(10),
+		ctx:            context.Background(),
+	}
+	for _, deployment := range deployments {
+		require.NoError(t, z.deploymentsInformer.GetStore().Add(deployment))
+	}
+	require.NoError(t, z.namespacesInformer.GetStore().Add(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "my-ns",
+			Annotations: map[string]string{"osiris.dm.gg/maxActiveWorkloads": "2"},
+		},
+	}))
+	var stopped []string
+	for name, lastActivity := range map[string]time.Duration{
+		"old":    2 * time.Hour,
+		"recent": time.Minute,
+	} {
+		name := name
+		z.collectors[getKey("Deployment", "my-ns", name)] = &metricsCollector{
+			config: metricsCollectorConfig{
+				appKind:      "Deployment",
+				appNamespace: "my-ns",
+				appName:      name,
+			},
+			cancelFunc:       func() { stopped = append(stopped, name) },
+			lastActivityTime: time.Now().Add(-lastActivity),
+			scrapeCount:      2,
+		}
+	}
+
+	z.enforceActiveWorkloadsBudget("my-ns")
+
+	// 5 active workloads for a budget of 2: the idle ones are evicted first,
+	// and then the least busy ones - but never the paused ones
+	assert.ElementsMatch(t, []string{"old", "recent"}, stopped)
+	assert.Empty(t, z.collectors)
+	expectedReplicas := map[string]int32{
+		"old":    0,
+		"recent": 0,
+		"paused": 1,
+		"busy":   0,
+		"busier": 5,
+		"asleep": 0,
+		// only used by evicted workloads
+		"shared": 0,
+		// still used by an active workload
+		"db": 1,
+	}
+	for name, expected := range expectedReplicas {
+		deployment, err := kubeClient.AppsV1().Deployments("my-ns").Get(
+			context.Background(),
+			name,
+			metav1.GetOptions{},
+		)
+		require.NoError(t, err)
+		assert.Equal(t, expected, *deployment.Spec.Replicas, name)
+	}
+	assert.Len(t, z.auditLog.list(), 3)
+}
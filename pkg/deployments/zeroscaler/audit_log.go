@@ -0,0 +1,80 @@
+package zeroscaler
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	decisionScaledToZero      = "ScaledToZero"
+	decisionScaleToZeroFailed = "ScaleToZeroFailed"
+	decisionPostponed         = "Postponed"
+	decisionNoDecision        = "NoDecision"
+	decisionCollectionStopped = "CollectionStopped"
+)
+
+// auditEntry is a decision taken by the zeroscaler for a workload
+type auditEntry struct {
+	Time      time.Time `json:"time"`
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Decision  string    `json:"decision"`
+	Reason    string    `json:"reason"`
+}
+
+// auditLog is a bounded in-memory log of the recent decisions of the
+// zeroscaler. Once full, the oldest entries are dropped. A nil auditLog
+// doesn't record anything.
+type auditLog struct {
+	entries []auditEntry
+	// next is the index of the next entry to write in entries
+	next int
+	full bool
+	lock sync.RWMutex
+}
+
+func newAuditLog(size int) *auditLog {
+	if size <= 0 {
+		return nil
+	}
+	return &auditLog{
+		entries: make([]auditEntry, size),
+	}
+}
+
+func (l *auditLog) record(kind, namespace, name, decision, reason string) {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.entries[l.next] = auditEntry{
+		Time:      time.Now().UTC(),
+		Kind:      kind,
+		Namespace: namespace,
+		Name:      name,
+		Decision:  decision,
+		Reason:    reason,
+	}
+	l.next++
+	if l.next == len(l.entries) {
+		l.next = 0
+		l.full = true
+	}
+}
+
+// list returns the recorded entries, from the oldest to the most recent
+func (l *auditLog) list() []auditEntry {
+	if l == nil {
+		return []auditEntry{}
+	}
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if !l.full {
+		return append([]auditEntry{}, l.entries[:l.next]...)
+	}
+	entries := make([]auditEntry, 0, len(l.entries))
+	entries = append(entries, l.entries[l.next:]...)
+	return append(entries, l.entries[:l.next]...)
+}
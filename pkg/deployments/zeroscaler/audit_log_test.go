@@ -0,0 +1,115 @@
+package zeroscaler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAuditLog(t *testing.T) {
+	tests := []struct {
+		name              string
+		size              int
+		records           []string
+		expectedDecisions []string
+	}{
+		{
+			name:              "empty",
+			size:              3,
+			expectedDecisions: []string{},
+		},
+		{
+			name:              "not full",
+			size:              3,
+			records:           []string{"a", "b"},
+			expectedDecisions: []string{"a", "b"},
+		},
+		{
+			name:              "full",
+			size:              3,
+			records:           []string{"a", "b", "c"},
+			expectedDecisions: []string{"a", "b", "c"},
+		},
+		{
+			name:              "oldest entries dropped",
+			size:              3,
+			records:           []string{"a", "b", "c", "d", "e"},
+			expectedDecisions: []string{"c", "d", "e"},
+		},
+		{
+			name:              "disabled",
+			size:              0,
+			records:           []string{"a", "b"},
+			expectedDecisions: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			log := newAuditLog(test.size)
+			for _, decision := range test.records {
+				log.record("Deployment", "ns", "app", decision, "some reason")
+			}
+
+			decisions := []string{}
+			for _, entry := range log.list() {
+				decisions = append(decisions, entry.Decision)
+			}
+			assert.Equal(t, test.expectedDecisions, decisions)
+		})
+	}
+}
+
+func TestScaleToZeroAndAudit(t *testing.T) {
+	tests := []struct {
+		name             string
+		existing         bool
+		expectedError    bool
+		expectedDecision string
+	}{
+		{
+			name:             "scaled to zero",
+			existing:         true,
+			expectedDecision: decisionScaledToZero,
+		},
+		{
+			name:             "scaling failed",
+			expectedError:    true,
+			expectedDecision: decisionScaleToZeroFailed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if test.existing {
+				objects = append(objects, &appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "app"},
+				})
+			}
+			collector := &metricsCollector{
+				config: metricsCollectorConfig{
+					appKind:      "Deployment",
+					appNamespace: "ns",
+					appName:      "app",
+				},
+				kubeClient: fake.NewSimpleClientset(objects...),
+				auditLog:   newAuditLog(10),
+			}
+
+			err := collector.scaleToZeroAndAudit(context.Background(), "idle")
+			assert.Equal(t, test.expectedError, err != nil)
+
+			entries := collector.auditLog.list()
+			require.Len(t, entries, 1)
+			assert.Equal(t, test.expectedDecision, entries[0].Decision)
+			assert.Contains(t, entries[0].Reason, "idle")
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package zeroscaler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/dailymotion-oss/osiris/pkg/metrics"
+	"github.com/dailymotion-oss/osiris/pkg/metrics/plugin"
+)
+
+const (
+	compositeScraperName = "composite"
+
+	compositeRuleAny = "any"
+	compositeRuleAll = "all"
+)
+
+type compositeScraperConfig struct {
+	// Rule is either "any" - the workload is active if at least one of the
+	// collectors observed some activity - or "all" - the workload is active
+	// only if all the collectors observed some activity. Default to "any".
+	Rule       string                     `json:"rule"`
+	Collectors []compositeCollectorConfig `json:"collectors"`
+}
+
+type compositeCollectorConfig struct {
+	metricsScraperConfig
+	// Gauge means that the collected value is a gauge - such as a queue depth -
+	// instead of a counter: the workload is active while the value is non-zero.
+	Gauge bool `json:"gauge"`
+}
+
+type compositeMember struct {
+	scraper metricsScraper
+	gauge   bool
+	// the values of the previous scrape, by proxy ID - nil until the first
+	// scrape
+	lastValues map[string]uint64
+}
+
+// compositeScraper is a metrics scraper that combines the activity signals of
+// several scrapers, with an any/all rule. It keeps track of the values of each
+// scraper between 2 scrapes, and increments a single activity count each time
+// the rule says that the workload is active - so that the workload is
+// considered idle once the rule doesn't match for a whole metrics check
+// interval.
+type compositeScraper struct {
+	rule          string
+	members       []*compositeMember
+	activityCount uint64
+	lock          sync.Mutex
+}
+
+func newCompositeScraper(
+	config metricsScraperConfig,
+	clients scraperClients,
+) (*compositeScraper, error) {
+	var cfg compositeScraperConfig
+	if err := json.Unmarshal(config.Implementation, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid composite configuration: %s", err)
+	}
+
+	switch cfg.Rule {
+	case "":
+		cfg.Rule = compositeRuleAny
+	case compositeRuleAny, compositeRuleAll:
+	default:
+		return nil, fmt.Errorf("invalid composite rule %s: must be %s or %s", cfg.Rule, compositeRuleAny, compositeRuleAll)
+	}
+	if len(cfg.Collectors) == 0 {
+		return nil, errors.New("Composite metrics can't be scraped: missing collectors")
+	}
+
+	s := &compositeScraper{
+		rule: cfg.Rule,
+	}
+	for _, collectorConfig := range cfg.Collectors {
+		scraper, err := newMetricsScraper(collectorConfig.metricsScraperConfig, clients)
+		if err != nil {
+			return nil, fmt.Errorf("invalid composite collector %s: %s", collectorConfig.ScraperName, err)
+		}
+		s.members = append(s.members, &compositeMember{
+			scraper: scraper,
+			gauge:   collectorConfig.Gauge,
+		})
+	}
+	return s, nil
+}
+
+// Scrap considers the given pod as the whole workload. The metrics collector
+// uses ScrapWorkload instead.
+func (s *compositeScraper) Scrap(pod *corev1.Pod) *metrics.ProxyRequestCount {
+	prcs, err := s.ScrapWorkload(context.Background(), podWorkload(pod), []*corev1.Pod{pod})
+	if err != nil {
+		return nil
+	}
+	return prcs[0]
+}
+
+func (s *compositeScraper) ScrapWorkload(
+	ctx context.Context,
+	workload plugin.Workload,
+	pods []*corev1.Pod,
+) ([]*metrics.ProxyRequestCount, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var (
+		values = make([]map[string]uint64, len(s.members))
+		errs   = make([]error, len(s.members))
+		wg     sync.WaitGroup
+	)
+	for i, member := range s.members {
+		wg.Add(1)
+		go func(i int, member *compositeMember) {
+			defer wg.Done()
+			values[i], errs[i] = scrapValues(ctx, member.scraper, workload, pods)
+		}(i, member)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			// make sure not to decide on incomplete metrics
+			return nil, err
+		}
+	}
+
+	active := s.rule == compositeRuleAll
+	for i, member := range s.members {
+		memberActive := member.isActive(values[i])
+		member.lastValues = values[i]
+		if s.rule == compositeRuleAny {
+			active = active || memberActive
+		} else {
+			active = active && memberActive
+		}
+	}
+	if active {
+		s.activityCount++
+	}
+
+	return []*metrics.ProxyRequestCount{
+		{
+			ProxyID:      compositeScraperName,
+			RequestCount: s.activityCount,
+		},
+	}, nil
+}
+
+// forgetPod forwards the deletion of a pod to the scrapers keeping a state
+// for each pod.
+func (s *compositeScraper) forgetPod(pod *corev1.Pod) {
+	for _, member := range s.members {
+		if f, ok := member.scraper.(podForgetter); ok {
+			f.forgetPod(pod)
+		}
+	}
+}
+
+// isActive checks if the given values are a sign of activity. A gauge is
+// active while any of its values is non-zero. A counter is active if any of
+// its values increased since the previous scrape, or if a new proxy - such as
+// the one of a new pod - already counted something. A counter that decreased
+// has been reset - by a restart of the container - and is not a sign of
+// activity, no more than a proxy that disappeared with its pod.
+func (m *compositeMember) isActive(values map[string]uint64) bool {
+	if m.gauge {
+		for _, value := range values {
+			if value > 0 {
+				return true
+			}
+		}
+		return false
+	}
+	if m.lastValues == nil {
+		return true
+	}
+	for proxyID, value := range values {
+		lastValue, found := m.lastValues[proxyID]
+		if (!found && value > 0) || value > lastValue {
+			return true
+		}
+	}
+	return false
+}
+
+// scrapValues returns the values scraped by the given scraper for all the
+// given pods, by proxy ID.
+func scrapValues(
+	ctx context.Context,
+	scraper metricsScraper,
+	workload plugin.Workload,
+	pods []*corev1.Pod,
+) (map[string]uint64, error) {
+	var prcs []*metrics.ProxyRequestCount
+	if ws, ok := scraper.(workloadScraper); ok {
+		var err error
+		prcs, err = ws.ScrapWorkload(ctx, workload, pods)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		prcs = make([]*metrics.ProxyRequestCount, len(pods))
+		var wg sync.WaitGroup
+		for i, pod := range pods {
+			wg.Add(1)
+			go func(i int, pod *corev1.Pod) {
+				defer wg.Done()
+				prcs[i] = scraper.Scrap(pod)
+			}(i, pod)
+		}
+		wg.Wait()
+	}
+
+	values := make(map[string]uint64, len(prcs))
+	for i, prc := range prcs {
+		if prc == nil {
+			if i < len(pods) {
+				return nil, fmt.Errorf("no metrics for pod %s", pods[i].Name)
+			}
+			return nil, errors.New("incomplete metrics")
+		}
+		values[prc.ProxyID] += prc.RequestCount
+	}
+	return values, nil
+}
@@ -0,0 +1,233 @@
+package zeroscaler
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/dailymotion-oss/osiris/pkg/metrics"
+	"github.com/dailymotion-oss/osiris/pkg/metrics/plugin"
+)
+
+// stubScraper returns the next value of its values for each pod
+type stubScraper struct {
+	values []*uint64
+	index  int
+}
+
+func (s *stubScraper) Scrap(pod *corev1.Pod) *metrics.ProxyRequestCount {
+	value := s.values[s.index]
+	if value == nil {
+		return nil
+	}
+	return &metrics.ProxyRequestCount{
+		ProxyID:      string(pod.UID),
+		RequestCount: *value,
+	}
+}
+
+func (s *stubScraper) next() {
+	s.index++
+}
+
+func value(v uint64) *uint64 {
+	return &v
+}
+
+func TestNewCompositeScraper(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        string
+		expectedRule  string
+		expectedGauge []bool
+		expectedError bool
+	}{
+		{
+			name: "default rule",
+			config: `{"collectors": [
+				{"type": "osiris"},
+				{"type": "prometheus", "gauge": true, "implementation": {"port": 8080, "requestCountMetricName": "queue_depth"}}
+			]}`,
+			expectedRule:  compositeRuleAny,
+			expectedGauge: []bool{false, true},
+		},
+		{
+			name:          "all rule",
+			config:        `{"rule": "all", "collectors": [{"type": "osiris"}]}`,
+			expectedRule:  compositeRuleAll,
+			expectedGauge: []bool{false},
+		},
+		{
+			name:          "invalid rule",
+			config:        `{"rule": "some", "collectors": [{"type": "osiris"}]}`,
+			expectedError: true,
+		},
+		{
+			name:          "no collectors",
+			config:        `{"rule": "any"}`,
+			expectedError: true,
+		},
+		{
+			name:          "invalid collector",
+			config:        `{"collectors": [{"type": "prometheus"}]}`,
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := newCompositeScraper(metricsScraperConfig{
+				ScraperName:    compositeScraperName,
+				Implementation: json.RawMessage(test.config),
+			}, scraperClients{})
+
+			if test.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedRule, actual.rule)
+			gauges := []bool{}
+			for _, member := range actual.members {
+				gauges = append(gauges, member.gauge)
+			}
+			assert.Equal(t, test.expectedGauge, gauges)
+		})
+	}
+}
+
+func TestCompositeScraper(t *testing.T) {
+	tests := []struct {
+		name           string
+		rule           string
+		counter        []*uint64
+		gauge          []*uint64
+		expectedCounts []uint64
+		expectedError  []bool
+	}{
+		{
+			name:           "any: counter or gauge",
+			rule:           compositeRuleAny,
+			counter:        []*uint64{value(1), value(1), value(2), value(2), value(2)},
+			gauge:          []*uint64{value(0), value(3), value(0), value(0), value(1)},
+			expectedCounts: []uint64{1, 2, 3, 3, 4},
+		},
+		{
+			name:           "all: counter and gauge",
+			rule:           compositeRuleAll,
+			counter:        []*uint64{value(1), value(1), value(2), value(3), value(3)},
+			gauge:          []*uint64{value(0), value(3), value(1), value(0), value(1)},
+			expectedCounts: []uint64{0, 0, 1, 1, 1},
+		},
+		{
+			name:           "incomplete metrics",
+			rule:           compositeRuleAny,
+			counter:        []*uint64{value(1), nil, value(1)},
+			gauge:          []*uint64{value(0), value(0), value(0)},
+			expectedCounts: []uint64{1, 0, 1},
+			expectedError:  []bool{false, true, false},
+		},
+	}
+
+	pods := []*corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "pod", UID: "uid"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			counter := &stubScraper{values: test.counter}
+			gauge := &stubScraper{values: test.gauge}
+			scraper := &compositeScraper{
+				rule: test.rule,
+				members: []*compositeMember{
+					{scraper: counter},
+					{scraper: gauge, gauge: true},
+				},
+			}
+
+			for i, expectedCount := range test.expectedCounts {
+				prcs, err := scraper.ScrapWorkload(context.Background(), plugin.Workload{}, pods)
+				if test.expectedError != nil && test.expectedError[i] {
+					assert.Error(t, err, "scrape %d", i)
+				} else if assert.NoError(t, err, "scrape %d", i) {
+					assert.Equal(t, expectedCount, prcs[0].RequestCount, "scrape %d", i)
+				}
+				counter.next()
+				gauge.next()
+			}
+		})
+	}
+}
+
+func TestCompositeMemberIsActive(t *testing.T) {
+	tests := []struct {
+		name       string
+		gauge      bool
+		lastValues map[string]uint64
+		values     map[string]uint64
+		expected   bool
+	}{
+		{
+			name:     "first scrape",
+			values:   map[string]uint64{"a": 0},
+			expected: true,
+		},
+		{
+			name:       "unchanged counters",
+			lastValues: map[string]uint64{"a": 3, "b": 5},
+			values:     map[string]uint64{"a": 3, "b": 5},
+		},
+		{
+			name:       "increased counter",
+			lastValues: map[string]uint64{"a": 3, "b": 5},
+			values:     map[string]uint64{"a": 3, "b": 6},
+			expected:   true,
+		},
+		{
+			name:       "pod gone",
+			lastValues: map[string]uint64{"a": 3, "b": 5},
+			values:     map[string]uint64{"a": 3},
+		},
+		{
+			name:       "counter reset by a restart",
+			lastValues: map[string]uint64{"a": 3, "b": 5},
+			values:     map[string]uint64{"a": 3, "b": 1},
+		},
+		{
+			name:       "new proxy without requests",
+			lastValues: map[string]uint64{"a": 3},
+			values:     map[string]uint64{"a": 3, "c": 0},
+		},
+		{
+			name:       "new proxy with requests",
+			lastValues: map[string]uint64{"a": 3},
+			values:     map[string]uint64{"a": 3, "c": 2},
+			expected:   true,
+		},
+		{
+			name:       "idle gauge",
+			gauge:      true,
+			lastValues: map[string]uint64{"a": 4},
+			values:     map[string]uint64{"a": 0, "b": 0},
+		},
+		{
+			name:     "non-zero gauge",
+			gauge:    true,
+			values:   map[string]uint64{"a": 0, "b": 2},
+			expected: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			member := &compositeMember{
+				gauge:      test.gauge,
+				lastValues: test.lastValues,
+			}
+			assert.Equal(t, test.expected, member.isActive(test.values))
+		})
+	}
+}
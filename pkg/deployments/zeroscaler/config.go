@@ -11,8 +11,10 @@ const envconfigPrefix = "ZEROSCALER"
 // Config represents the configuration options for zeroscaler
 // nolint: lll
 type Config struct {
-	MetricsCheckInterval int           `envconfig:"METRICS_CHECK_INTERVAL" required:"true"`
-	ResyncInterval       time.Duration `envconfig:"INFORMERS_RESYNC_INTERVAL" required:"true"`
+	MetricsCheckInterval       int           `envconfig:"METRICS_CHECK_INTERVAL" required:"true"`
+	ResyncInterval             time.Duration `envconfig:"INFORMERS_RESYNC_INTERVAL" required:"true"`
+	ManualScalingPauseDuration time.Duration `envconfig:"MANUAL_SCALING_PAUSE_DURATION" default:"1h"`
+	AuditLogSize               int           `envconfig:"AUDIT_LOG_SIZE" default:"1000"`
 }
 
 // NewConfigWithDefaults returns a Config object with default values already
@@ -0,0 +1,112 @@
+package zeroscaler
+
+import (
+	"context"
+
+	"github.com/golang/glog"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	k8s "github.com/dailymotion-oss/osiris/pkg/kubernetes"
+)
+
+// DaemonSets have no replicas: instead of being scaled to zero, they are
+// "parked", with a node selector matching no node. See k8s.ParkPatch.
+
+func (z *zeroscaler) syncDaemonSet(obj interface{}) {
+	daemonSet := obj.(*appsv1.DaemonSet)
+	if !k8s.WorkloadIsEligibleForAutoScaling(daemonSet.Annotations) {
+		glog.Infof(
+			"Notified about new or updated non-Osiris-enabled daemonSet %s in "+
+				"namespace %s; ensuring NO metrics collection",
+			daemonSet.Name,
+			daemonSet.Namespace,
+		)
+		z.ensureNoMetricsCollection(
+			"DaemonSet",
+			daemonSet.Namespace,
+			daemonSet.Name,
+			"not Osiris-enabled",
+		)
+		return
+	}
+
+	glog.Infof(
+		"Notified about new or updated Osiris-enabled daemonSet %s in "+
+			"namespace %s",
+		daemonSet.Name,
+		daemonSet.Namespace,
+	)
+	if pausedUntil, manualScaling, paused := z.pausedUntil("DaemonSet", daemonSet, nil); paused {
+		z.pause("DaemonSet", daemonSet, nil, pausedUntil, manualScaling)
+		return
+	}
+	if k8s.DaemonSetIsParked(daemonSet.Spec.Template.Spec.NodeSelector) {
+		glog.Infof(
+			"Osiris-enabled daemonSet %s in namespace %s is parked; ensuring "+
+				"NO metrics collection",
+			daemonSet.Name,
+			daemonSet.Namespace,
+		)
+		z.ensureNoMetricsCollection(
+			"DaemonSet",
+			daemonSet.Namespace,
+			daemonSet.Name,
+			"parked",
+		)
+		return
+	}
+	glog.Infof(
+		"Osiris-enabled daemonSet %s in namespace %s is not parked; ensuring "+
+			"metrics collection",
+		daemonSet.Name,
+		daemonSet.Namespace,
+	)
+	z.ensureMetricsCollection(
+		"DaemonSet",
+		daemonSet.Namespace,
+		daemonSet.Name,
+		daemonSet.Annotations,
+		daemonSet.Spec.Selector,
+	)
+	z.enforceActiveWorkloadsBudget(daemonSet.Namespace)
+}
+
+func (z *zeroscaler) syncDeletedDaemonSet(obj interface{}) {
+	daemonSet, ok := obj.(*appsv1.DaemonSet)
+	if !ok {
+		return
+	}
+	glog.Infof(
+		"Notified about deleted daemonSet %s in namespace %s; ensuring NO "+
+			"metrics collection",
+		daemonSet.Name,
+		daemonSet.Namespace,
+	)
+	z.ensureNoMetricsCollection(
+		"DaemonSet",
+		daemonSet.Namespace,
+		daemonSet.Name,
+		"deleted",
+	)
+}
+
+// parkDaemonSet parks the given daemonSet, if it is not parked yet
+func parkDaemonSet(ctx context.Context, kubeClient kubernetes.Interface, namespace, name string) error {
+	daemonSet, err := kubeClient.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if k8s.DaemonSetIsParked(daemonSet.Spec.Template.Spec.NodeSelector) {
+		return nil
+	}
+	return patchWorkload(
+		ctx,
+		kubeClient,
+		"DaemonSet",
+		namespace,
+		name,
+		k8s.ParkPatch(daemonSet.Spec.Template.Spec.NodeSelector),
+	)
+}
@@ -0,0 +1,86 @@
+package zeroscaler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	k8s "github.com/dailymotion-oss/osiris/pkg/kubernetes"
+)
+
+func TestParkDaemonSet(t *testing.T) {
+	tests := []struct {
+		name                 string
+		nodeSelector         map[string]string
+		annotations          map[string]string
+		expectedNodeSelector map[string]string
+		expectedAnnotation   string
+	}{
+		{
+			name: "daemonset without node selector",
+			expectedNodeSelector: map[string]string{
+				k8s.ParkingNodeSelectorKey: "true",
+			},
+			expectedAnnotation: "{}",
+		},
+		{
+			name: "daemonset with a node selector",
+			nodeSelector: map[string]string{
+				"pool": "gpu",
+			},
+			expectedNodeSelector: map[string]string{
+				"pool":                     "gpu",
+				k8s.ParkingNodeSelectorKey: "true",
+			},
+			expectedAnnotation: `{"pool":"gpu"}`,
+		},
+		{
+			name: "already parked daemonset",
+			nodeSelector: map[string]string{
+				k8s.ParkingNodeSelectorKey: "true",
+			},
+			annotations: map[string]string{
+				k8s.ParkedNodeSelectorAnnotationName: `{"pool":"gpu"}`,
+			},
+			expectedNodeSelector: map[string]string{
+				k8s.ParkingNodeSelectorKey: "true",
+			},
+			expectedAnnotation: `{"pool":"gpu"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kubeClient := fake.NewSimpleClientset(&appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "ns",
+					Name:        "app",
+					Annotations: test.annotations,
+				},
+				Spec: appsv1.DaemonSetSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{NodeSelector: test.nodeSelector},
+					},
+				},
+			})
+
+			err := parkDaemonSet(context.Background(), kubeClient, "ns", "app")
+			require.NoError(t, err)
+
+			parked, err := kubeClient.AppsV1().DaemonSets("ns").Get(
+				context.Background(),
+				"app",
+				metav1.GetOptions{},
+			)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedNodeSelector, parked.Spec.Template.Spec.NodeSelector)
+			assert.Equal(t, test.expectedAnnotation, parked.Annotations[k8s.ParkedNodeSelectorAnnotationName])
+		})
+	}
+}
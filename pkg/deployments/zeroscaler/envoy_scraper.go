@@ -0,0 +1,152 @@
+package zeroscaler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/golang/glog"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/dailymotion-oss/osiris/pkg/metrics"
+)
+
+const (
+	envoyScraperName = "envoy"
+
+	envoyRequestCountMetricName    = "envoy_cluster_upstream_rq_total"
+	envoyConnectionCountMetricName = "envoy_cluster_upstream_cx_total"
+	envoyClusterNameLabel          = "cluster_name"
+)
+
+type envoyScraperConfig struct {
+	// Port is the port of the envoy stats endpoint. Default to the istio-proxy
+	// merged prometheus port.
+	Port int `json:"port"`
+	// Path is the path of the envoy stats endpoint, in the prometheus format.
+	Path string `json:"path"`
+	// InboundClusterPrefix is the prefix of the names of the envoy clusters
+	// that handle the inbound traffic of the pod.
+	InboundClusterPrefix string `json:"inboundClusterPrefix"`
+	// CountConnections enables counting the inbound TCP connections in
+	// addition to the HTTP requests - for non-HTTP workloads.
+	CountConnections bool `json:"countConnections"`
+}
+
+// envoyScraper is a metrics scraper that scraps the inbound requests (and
+// optionally connections) counters of an envoy sidecar - such as the one
+// injected by istio. It allows to use Osiris in a service mesh, without the
+// osiris proxy.
+type envoyScraper struct {
+	httpClient *http.Client
+	config     envoyScraperConfig
+}
+
+func newEnvoyScraper(config metricsScraperConfig) (*envoyScraper, error) {
+	var cfg envoyScraperConfig
+	if len(config.Implementation) > 0 {
+		if err := json.Unmarshal(config.Implementation, &cfg); err != nil {
+			return nil, fmt.Errorf("invalid envoy configuration: %s", err)
+		}
+	}
+
+	// default values
+	if cfg.Port == 0 {
+		cfg.Port = 15090
+	}
+	if len(cfg.Path) == 0 {
+		cfg.Path = "/stats/prometheus"
+	}
+	if len(cfg.InboundClusterPrefix) == 0 {
+		cfg.InboundClusterPrefix = "inbound|"
+	}
+
+	return &envoyScraper{
+		config: cfg,
+		httpClient: &http.Client{
+			Timeout: scrapeTimeout,
+		},
+	}, nil
+}
+
+func (s *envoyScraper) Scrap(pod *corev1.Pod) *metrics.ProxyRequestCount {
+	target := fmt.Sprintf("http://%s:%d%s", pod.Status.PodIP, s.config.Port, s.config.Path)
+
+	resp, err := s.httpClient.Get(target)
+	if err != nil {
+		glog.Errorf("Error requesting envoy stats from %s: %s", target, err)
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		glog.Errorf("Received unexpected HTTP response code %d when requesting envoy stats from %s", resp.StatusCode, target)
+		return nil
+	}
+
+	var (
+		decoder = expfmt.NewDecoder(resp.Body, expfmt.ResponseFormat(resp.Header))
+		prc     = metrics.ProxyRequestCount{
+			ProxyID: string(pod.UID),
+		}
+		found        bool
+		metricFamily io_prometheus_client.MetricFamily
+	)
+	for {
+		// the decoder decodes metricFamilies 1 by 1 and finishes with an io.EOF error
+		err = decoder.Decode(&metricFamily)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			glog.Errorf("Error decoding envoy stats from %s: %s", target, err)
+			return nil
+		}
+
+		switch metricFamily.GetName() {
+		case envoyRequestCountMetricName:
+			// HTTP requests are always counted
+		case envoyConnectionCountMetricName:
+			if !s.config.CountConnections {
+				continue
+			}
+		default:
+			continue
+		}
+		found = true
+		prc.RequestCount += s.sumInboundClustersValues(metricFamily)
+	}
+
+	if !found {
+		// make sure not to return a half-valid object
+		glog.Errorf("Envoy stats from %s are incomplete: %s metric is missing", target, envoyRequestCountMetricName)
+		return nil
+	}
+	return &prc
+}
+
+// sumInboundClustersValues returns the sum of the values of the metrics of the
+// given metricFamily for all the inbound envoy clusters.
+func (s *envoyScraper) sumInboundClustersValues(metricFamily io_prometheus_client.MetricFamily) uint64 {
+	var sum uint64
+	for _, metric := range metricFamily.GetMetric() {
+		var inbound bool
+		for _, label := range metric.GetLabel() {
+			if label.GetName() == envoyClusterNameLabel &&
+				strings.HasPrefix(label.GetValue(), s.config.InboundClusterPrefix) {
+				inbound = true
+				break
+			}
+		}
+		if !inbound {
+			continue
+		}
+		if value, found := extractPrometheusMetricValue(*metric, metricFamily, nil); found {
+			sum += value
+		}
+	}
+	return sum
+}
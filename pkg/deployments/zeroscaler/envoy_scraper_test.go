@@ -0,0 +1,79 @@
+package zeroscaler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const envoyStats = `# TYPE envoy_cluster_upstream_rq_total counter
+envoy_cluster_upstream_rq_total{cluster_name="inbound|8080||"} 12
+envoy_cluster_upstream_rq_total{cluster_name="inbound|9090||"} 3
+envoy_cluster_upstream_rq_total{cluster_name="outbound|80||other.default.svc.cluster.local"} 100
+# TYPE envoy_cluster_upstream_cx_total counter
+envoy_cluster_upstream_cx_total{cluster_name="inbound|5432||"} 7
+envoy_cluster_upstream_cx_total{cluster_name="outbound|80||other.default.svc.cluster.local"} 50
+`
+
+func TestEnvoyScraper(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/stats/prometheus" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, envoyStats)
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(serverURL.Port())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		implementation string
+		expectedCount  uint64
+	}{
+		{
+			name:           "inbound requests only",
+			implementation: fmt.Sprintf(`{"port": %d}`, port),
+			expectedCount:  15,
+		},
+		{
+			name:           "inbound requests and connections",
+			implementation: fmt.Sprintf(`{"port": %d, "countConnections": true}`, port),
+			expectedCount:  22,
+		},
+		{
+			name:           "custom inbound cluster prefix",
+			implementation: fmt.Sprintf(`{"port": %d, "inboundClusterPrefix": "inbound|8080|"}`, port),
+			expectedCount:  12,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scraper, err := newEnvoyScraper(metricsScraperConfig{
+				ScraperName:    envoyScraperName,
+				Implementation: []byte(test.implementation),
+			})
+			require.NoError(t, err)
+
+			prc := scraper.Scrap(&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{UID: "pod-uid"},
+				Status:     corev1.PodStatus{PodIP: serverURL.Hostname()},
+			})
+			require.NotNil(t, prc)
+			assert.Equal(t, "pod-uid", prc.ProxyID)
+			assert.Equal(t, test.expectedCount, prc.RequestCount)
+		})
+	}
+}
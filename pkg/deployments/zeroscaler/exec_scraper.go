@@ -0,0 +1,246 @@
+package zeroscaler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+
+	"github.com/dailymotion-oss/osiris/pkg/metrics"
+)
+
+const (
+	execScraperName = "exec"
+)
+
+var execOutputNumberRegex = regexp.MustCompile(`\d+`)
+
+type execScraperConfig struct {
+	// Container is the name of the container in which the command is run
+	Container string `json:"container"`
+	// Command is the command to run. Its output must be either a number, or a
+	// JSON ProxyRequestCount.
+	Command []string `json:"command"`
+}
+
+// execFunc runs a command in a container of a pod, and returns its output
+type execFunc func(
+	ctx context.Context,
+	pod *corev1.Pod,
+	container string,
+	command []string,
+) (string, error)
+
+// execScraper is a metrics scraper that runs a command in a container of the
+// pods - using the pods/exec API - to retrieve an activity counter. This is
+// useful for non-HTTP workloads with their own activity counters, such as
+// databases or message brokers.
+type execScraper struct {
+	config execScraperConfig
+	exec   execFunc
+}
+
+func newExecScraper(
+	config metricsScraperConfig,
+	clients scraperClients,
+) (*execScraper, error) {
+	var cfg execScraperConfig
+	if err := json.Unmarshal(config.Implementation, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid exec configuration: %s", err)
+	}
+
+	// check for missing values
+	if len(cfg.Container) == 0 {
+		return nil, errors.New("Exec metrics can't be scraped: missing container")
+	}
+	if len(cfg.Command) == 0 {
+		return nil, errors.New("Exec metrics can't be scraped: missing command")
+	}
+	if clients.kubeClient == nil || clients.restConfig == nil {
+		return nil, errors.New("Exec metrics can't be scraped: no kubernetes client")
+	}
+
+	return &execScraper{
+		config: cfg,
+		exec:   newPodExecFunc(clients),
+	}, nil
+}
+
+func (s *execScraper) Scrap(pod *corev1.Pod) *metrics.ProxyRequestCount {
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+
+	output, err := s.exec(ctx, pod, s.config.Container, s.config.Command)
+	if err != nil {
+		glog.Errorf(
+			"Error running metrics command in container %s of pod %s in namespace %s: %s",
+			s.config.Container,
+			pod.Name,
+			pod.Namespace,
+			err,
+		)
+		return nil
+	}
+
+	prc, err := parseExecOutput(output)
+	if err != nil {
+		glog.Errorf(
+			"Error parsing metrics command output from container %s of pod %s in namespace %s: %s",
+			s.config.Container,
+			pod.Name,
+			pod.Namespace,
+			err,
+		)
+		return nil
+	}
+	if len(prc.ProxyID) == 0 {
+		prc.ProxyID = string(pod.UID)
+	}
+	return prc
+}
+
+// parseExecOutput parses the output of a metrics command. It can either be a
+// JSON ProxyRequestCount, or any text containing a number - such as
+// "keyspace_hits:42". If the text contains multiple numbers, the
+// last one is used.
+func parseExecOutput(output string) (*metrics.ProxyRequestCount, error) {
+	output = strings.TrimSpace(output)
+	if strings.HasPrefix(output, "{") {
+		var prc metrics.ProxyRequestCount
+		if err := json.Unmarshal([]byte(output), &prc); err != nil {
+			return nil, err
+		}
+		return &prc, nil
+	}
+	numbers := execOutputNumberRegex.FindAllString(output, -1)
+	if len(numbers) == 0 {
+		return nil, fmt.Errorf("no number found in %q", output)
+	}
+	requestCount, err := strconv.ParseUint(numbers[len(numbers)-1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &metrics.ProxyRequestCount{RequestCount: requestCount}, nil
+}
+
+// newPodExecFunc returns an execFunc that uses the pods/exec API
+func newPodExecFunc(clients scraperClients) execFunc {
+	return func(
+		ctx context.Context,
+		pod *corev1.Pod,
+		container string,
+		command []string,
+	) (string, error) {
+		req := clients.kubeClient.CoreV1().RESTClient().Post().
+			Resource("pods").
+			Namespace(pod.Namespace).
+			Name(pod.Name).
+			SubResource("exec").
+			VersionedParams(&corev1.PodExecOptions{
+				Container: container,
+				Command:   command,
+				Stdout:    true,
+				Stderr:    true,
+			}, scheme.ParameterCodec)
+		transport, upgrader, err := spdy.RoundTripperFor(clients.restConfig)
+		if err != nil {
+			return "", err
+		}
+		// the executor has no notion of context, so we bind the upgrade request
+		// to ctx, and keep a handle on the upgraded connection to be able to
+		// close it - and release the stream - when ctx is done
+		closableUpgrader := &closableUpgrader{Upgrader: upgrader}
+		executor, err := remotecommand.NewSPDYExecutorForTransports(
+			&contextRoundTripper{ctx: ctx, RoundTripper: transport},
+			closableUpgrader,
+			"POST",
+			req.URL(),
+		)
+		if err != nil {
+			return "", err
+		}
+
+		var (
+			stdout, stderr bytes.Buffer
+			errCh          = make(chan error, 1)
+		)
+		go func() {
+			errCh <- executor.Stream(remotecommand.StreamOptions{
+				Stdout: &stdout,
+				Stderr: &stderr,
+			})
+		}()
+		select {
+		case err = <-errCh:
+		case <-ctx.Done():
+			closableUpgrader.Close()
+			return "", ctx.Err()
+		}
+		if err != nil {
+			return "", fmt.Errorf("%s (stderr: %s)", err, strings.TrimSpace(stderr.String()))
+		}
+		return stdout.String(), nil
+	}
+}
+
+// contextRoundTripper binds every request it sends to a context,
+// so that dialing and negotiating the upgrade are aborted when it is done
+type contextRoundTripper struct {
+	http.RoundTripper
+	ctx context.Context
+}
+
+func (rt *contextRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return rt.RoundTripper.RoundTrip(req.WithContext(rt.ctx))
+}
+
+// closableUpgrader keeps track of the connections it upgrades,
+// so that they can be closed from outside of the executor
+type closableUpgrader struct {
+	spdy.Upgrader
+
+	lock   sync.Mutex
+	conns  []httpstream.Connection
+	closed bool
+}
+
+func (u *closableUpgrader) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	conn, err := u.Upgrader.NewConnection(resp)
+	if err != nil {
+		return nil, err
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if u.closed {
+		conn.Close()
+		return nil, errors.New("connection closed")
+	}
+	u.conns = append(u.conns, conn)
+	return conn, nil
+}
+
+// Close closes all the connections upgraded so far, and any later one
+func (u *closableUpgrader) Close() {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.closed = true
+	for _, conn := range u.conns {
+		if err := conn.Close(); err != nil {
+			glog.Warningf("Failed to close exec connection: %s", err)
+		}
+	}
+	u.conns = nil
+}
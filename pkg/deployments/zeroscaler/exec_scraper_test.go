@@ -0,0 +1,153 @@
+package zeroscaler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+
+	"github.com/dailymotion-oss/osiris/pkg/metrics"
+)
+
+func TestParseExecOutput(t *testing.T) {
+	tests := []struct {
+		name           string
+		output         string
+		expectedResult *metrics.ProxyRequestCount
+		expectedError  bool
+	}{
+		{
+			name:           "single number",
+			output:         "42\n",
+			expectedResult: &metrics.ProxyRequestCount{RequestCount: 42},
+		},
+		{
+			name:           "redis info line",
+			output:         "keyspace_hits:1234\r\n",
+			expectedResult: &metrics.ProxyRequestCount{RequestCount: 1234},
+		},
+		{
+			name:   "json proxy request count",
+			output: `{"proxyId": "some-id", "requestCount": 7}`,
+			expectedResult: &metrics.ProxyRequestCount{
+				ProxyID:      "some-id",
+				RequestCount: 7,
+			},
+		},
+		{
+			name:          "invalid json",
+			output:        `{"requestCount": "7"}`,
+			expectedError: true,
+		},
+		{
+			name:          "no number",
+			output:        "ERR unknown command",
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := parseExecOutput(test.output)
+
+			if test.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedResult, actual)
+		})
+	}
+}
+
+func TestExecScraper(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod", UID: "pod-uid"},
+	}
+
+	tests := []struct {
+		name           string
+		exec           execFunc
+		expectedResult *metrics.ProxyRequestCount
+	}{
+		{
+			name: "successful command",
+			exec: func(_ context.Context, _ *corev1.Pod, container string, command []string) (string, error) {
+				if container != "redis" || len(command) != 3 {
+					return "", errors.New("unexpected command")
+				}
+				return "12\n", nil
+			},
+			expectedResult: &metrics.ProxyRequestCount{
+				ProxyID:      "pod-uid",
+				RequestCount: 12,
+			},
+		},
+		{
+			name: "failed command",
+			exec: func(context.Context, *corev1.Pod, string, []string) (string, error) {
+				return "", errors.New("command terminated with exit code 1")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scraper := &execScraper{
+				config: execScraperConfig{
+					Container: "redis",
+					Command: []string{
+						"sh",
+						"-c",
+						"redis-cli info all | awk -F '[:=,]' '/^total_commands_processed:/ {t=$2} /^cmdstat_info:/ {i=$3} END {print t-i}'",
+					},
+				},
+				exec: test.exec,
+			}
+
+			actual := scraper.Scrap(pod)
+			assert.Equal(t, test.expectedResult, actual)
+		})
+	}
+}
+
+type fakeConnection struct {
+	httpstream.Connection
+	closed bool
+}
+
+func (c *fakeConnection) Close() error {
+	c.closed = true
+	return nil
+}
+
+type fakeUpgrader struct {
+	conns []*fakeConnection
+}
+
+func (u *fakeUpgrader) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	conn := &fakeConnection{}
+	u.conns = append(u.conns, conn)
+	return conn, nil
+}
+
+func TestClosableUpgrader(t *testing.T) {
+	upgrader := &fakeUpgrader{}
+	closable := &closableUpgrader{Upgrader: upgrader}
+
+	_, err := closable.NewConnection(nil)
+	assert.NoError(t, err)
+	closable.Close()
+	assert.True(t, upgrader.conns[0].closed)
+
+	// a connection upgraded after the close is closed right away
+	conn, err := closable.NewConnection(nil)
+	assert.Error(t, err)
+	assert.Nil(t, conn)
+	assert.True(t, upgrader.conns[1].closed)
+}
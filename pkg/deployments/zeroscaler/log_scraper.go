@@ -0,0 +1,197 @@
+package zeroscaler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s_types "k8s.io/apimachinery/pkg/types"
+
+	"github.com/dailymotion-oss/osiris/pkg/metrics"
+)
+
+const (
+	logScraperName = "log"
+
+	// logScraperLimitBytes is the maximum number of bytes of logs read on each
+	// scrape. The next scrape continues where the previous one stopped.
+	logScraperLimitBytes = 5 * 1024 * 1024
+)
+
+type logScraperConfig struct {
+	// Container is the name of the container whose logs are read
+	Container string `json:"container"`
+	// Regex is the regular expression that log lines must match to be
+	// considered as activity
+	Regex string `json:"regex"`
+}
+
+// logsFunc streams the logs of a container of a pod
+type logsFunc func(
+	ctx context.Context,
+	pod *corev1.Pod,
+	options *corev1.PodLogOptions,
+) (io.ReadCloser, error)
+
+// logScraper is a metrics scraper that counts the new log lines of a
+// container matching a regex - such as access logs - using the pods/log API.
+// This is useful for workloads that can't be instrumented or proxied, but
+// that log every request.
+type logScraper struct {
+	config logScraperConfig
+	regex  *regexp.Regexp
+	logs   logsFunc
+	// the number of matching log lines of each pod, by pod UID
+	activityCounts map[k8s_types.UID]uint64
+	// the timestamp of the latest log line read for each pod, by pod UID
+	lastLogTimes map[k8s_types.UID]time.Time
+	lock         sync.Mutex
+}
+
+func newLogScraper(
+	config metricsScraperConfig,
+	clients scraperClients,
+) (*logScraper, error) {
+	var cfg logScraperConfig
+	if err := json.Unmarshal(config.Implementation, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid log configuration: %s", err)
+	}
+
+	// check for missing values
+	if len(cfg.Container) == 0 {
+		return nil, errors.New("Log metrics can't be scraped: missing container")
+	}
+	if len(cfg.Regex) == 0 {
+		return nil, errors.New("Log metrics can't be scraped: missing regex")
+	}
+	regex, err := regexp.Compile(cfg.Regex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log regex %s: %s", cfg.Regex, err)
+	}
+	if clients.kubeClient == nil {
+		return nil, errors.New("Log metrics can't be scraped: no kubernetes client")
+	}
+
+	return &logScraper{
+		config: cfg,
+		regex:  regex,
+		logs: func(ctx context.Context, pod *corev1.Pod, options *corev1.PodLogOptions) (io.ReadCloser, error) {
+			return clients.kubeClient.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, options).Stream(ctx)
+		},
+		activityCounts: map[k8s_types.UID]uint64{},
+		lastLogTimes:   map[k8s_types.UID]time.Time{},
+	}, nil
+}
+
+func (s *logScraper) Scrap(pod *corev1.Pod) *metrics.ProxyRequestCount {
+	s.lock.Lock()
+	lastLogTime, found := s.lastLogTimes[pod.UID]
+	s.lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+
+	limitBytes := int64(logScraperLimitBytes)
+	options := &corev1.PodLogOptions{
+		Container:  s.config.Container,
+		Timestamps: true,
+		LimitBytes: &limitBytes,
+	}
+	if !found {
+		// first scrape of this pod: only count the lines logged after the latest
+		// existing one - using the timestamps of the node, not our clock
+		tailLines := int64(1)
+		options.TailLines = &tailLines
+	} else if !lastLogTime.IsZero() {
+		// sinceTime has a precision of a second, so we may read some lines
+		// twice: the timestamps are used to skip them.
+		options.SinceTime = &metav1.Time{Time: lastLogTime}
+	}
+	stream, err := s.logs(ctx, pod, options)
+	if err != nil {
+		glog.Errorf("Error streaming logs of container %s of pod %s in namespace %s: %s", s.config.Container, pod.Name, pod.Namespace, err)
+		return nil
+	}
+	defer stream.Close()
+
+	count, newLastLogTime, err := countMatchingLogLines(stream, s.regex, lastLogTime)
+	if err != nil {
+		glog.Errorf("Error reading logs of container %s of pod %s in namespace %s: %s", s.config.Container, pod.Name, pod.Namespace, err)
+		return nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.lastLogTimes[pod.UID] = newLastLogTime
+	if found {
+		s.activityCounts[pod.UID] += count
+	}
+	return &metrics.ProxyRequestCount{
+		ProxyID:      string(pod.UID),
+		RequestCount: s.activityCounts[pod.UID],
+	}
+}
+
+// forgetPod forgets about the state of a deleted pod
+func (s *logScraper) forgetPod(pod *corev1.Pod) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.activityCounts, pod.UID)
+	delete(s.lastLogTimes, pod.UID)
+}
+
+// countMatchingLogLines counts the log lines - prefixed by their timestamp -
+// logged after the given time and matching the given regex. It returns the
+// count and the timestamp of the latest line read.
+func countMatchingLogLines(
+	logs io.Reader,
+	regex *regexp.Regexp,
+	after time.Time,
+) (uint64, time.Time, error) {
+	var (
+		count    uint64
+		lastTime = after
+		scanner  = bufio.NewScanner(logs)
+	)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		rawTimestamp, line := splitTimestampedLogLine(scanner.Text())
+		timestamp, err := time.Parse(time.RFC3339Nano, rawTimestamp)
+		if err != nil {
+			// not a timestamped line - such as the end of a line truncated by the
+			// limit of bytes
+			continue
+		}
+		if !timestamp.After(after) {
+			continue
+		}
+		if timestamp.After(lastTime) {
+			lastTime = timestamp
+		}
+		if regex.MatchString(line) {
+			count++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, after, err
+	}
+	return count, lastTime, nil
+}
+
+func splitTimestampedLogLine(line string) (string, string) {
+	idx := strings.IndexByte(line, ' ')
+	if idx < 0 {
+		return line, ""
+	}
+	return line[:idx], line[idx+1:]
+}
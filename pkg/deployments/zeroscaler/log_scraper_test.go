@@ -0,0 +1,149 @@
+package zeroscaler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s_types "k8s.io/apimachinery/pkg/types"
+
+	"github.com/dailymotion-oss/osiris/pkg/metrics"
+)
+
+func TestCountMatchingLogLines(t *testing.T) {
+	after := time.Date(2021, 1, 1, 10, 0, 0, 500000000, time.UTC)
+	tests := []struct {
+		name             string
+		logs             string
+		expectedCount    uint64
+		expectedLastTime time.Time
+	}{
+		{
+			name:             "no logs",
+			expectedLastTime: after,
+		},
+		{
+			name: "skip lines already read",
+			logs: "2021-01-01T10:00:00.1Z GET /index.html 200\n" +
+				"2021-01-01T10:00:00.5Z GET /index.html 200\n" +
+				"2021-01-01T10:00:01.2Z GET /index.html 200\n" +
+				"2021-01-01T10:00:02.3Z starting background job\n" +
+				"2021-01-01T10:00:03.4Z POST /api 201\n",
+			expectedCount:    2,
+			expectedLastTime: time.Date(2021, 1, 1, 10, 0, 3, 400000000, time.UTC),
+		},
+		{
+			name: "truncated line",
+			logs: "2021-01-01T10:00:01Z GET /index.html 200\n" +
+				"GET /inde",
+			expectedCount:    1,
+			expectedLastTime: time.Date(2021, 1, 1, 10, 0, 1, 0, time.UTC),
+		},
+	}
+
+	regex := regexp.MustCompile(`^(GET|POST) `)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			count, lastTime, err := countMatchingLogLines(strings.NewReader(test.logs), regex, after)
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedCount, count)
+			assert.True(t, test.expectedLastTime.Equal(lastTime), "expected %s, got %s", test.expectedLastTime, lastTime)
+		})
+	}
+}
+
+func TestLogScraper(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod", UID: "pod-uid"},
+	}
+	var (
+		logs    []string
+		options *corev1.PodLogOptions
+		err     error
+	)
+	scraper := &logScraper{
+		config: logScraperConfig{Container: "app"},
+		regex:  regexp.MustCompile(`GET `),
+		logs: func(_ context.Context, _ *corev1.Pod, opts *corev1.PodLogOptions) (io.ReadCloser, error) {
+			options = opts
+			if err != nil {
+				return nil, err
+			}
+			return ioutil.NopCloser(strings.NewReader(strings.Join(logs, "\n"))), nil
+		},
+		activityCounts: map[k8s_types.UID]uint64{},
+		lastLogTimes:   map[k8s_types.UID]time.Time{},
+	}
+	line := func(offset time.Duration, msg string) string {
+		return time.Now().Add(offset).UTC().Format(time.RFC3339Nano) + " " + msg
+	}
+
+	// first scrape: the existing logs are ignored, and the timestamp of the
+	// latest one is used as a starting point
+	logs = []string{line(-time.Minute, "GET /existing")}
+	assert.Equal(t, &metrics.ProxyRequestCount{ProxyID: "pod-uid"}, scraper.Scrap(pod))
+	require.NotNil(t, options.TailLines)
+	assert.Equal(t, int64(1), *options.TailLines)
+	assert.Nil(t, options.SinceTime)
+
+	logs = []string{
+		line(-time.Hour, "GET /old"),
+		line(time.Second, "GET /"),
+		line(2*time.Second, "healthy"),
+		line(3*time.Second, "GET /about"),
+	}
+	assert.Equal(t, &metrics.ProxyRequestCount{ProxyID: "pod-uid", RequestCount: 2}, scraper.Scrap(pod))
+	assert.Equal(t, "app", options.Container)
+	assert.True(t, options.Timestamps)
+	assert.NotNil(t, options.SinceTime)
+
+	// the same lines are not counted twice
+	assert.Equal(t, &metrics.ProxyRequestCount{ProxyID: "pod-uid", RequestCount: 2}, scraper.Scrap(pod))
+
+	err = errors.New("container not found")
+	assert.Nil(t, scraper.Scrap(pod))
+
+	// the state of the deleted pods is forgotten
+	scraper.forgetPod(pod)
+	assert.Empty(t, scraper.activityCounts)
+	assert.Empty(t, scraper.lastLogTimes)
+}
+
+func TestLogScraperFirstScrapeWithoutLogs(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod", UID: "pod-uid"},
+	}
+	var (
+		logs    []string
+		options *corev1.PodLogOptions
+	)
+	scraper := &logScraper{
+		config: logScraperConfig{Container: "app"},
+		regex:  regexp.MustCompile(`GET `),
+		logs: func(_ context.Context, _ *corev1.Pod, opts *corev1.PodLogOptions) (io.ReadCloser, error) {
+			options = opts
+			return ioutil.NopCloser(strings.NewReader(strings.Join(logs, "\n"))), nil
+		},
+		activityCounts: map[k8s_types.UID]uint64{},
+		lastLogTimes:   map[k8s_types.UID]time.Time{},
+	}
+
+	assert.Equal(t, &metrics.ProxyRequestCount{ProxyID: "pod-uid"}, scraper.Scrap(pod))
+
+	// without any existing line, all the lines logged since are new - whatever
+	// the clock of the node
+	logs = []string{time.Now().Add(-time.Hour).UTC().Format(time.RFC3339Nano) + " GET /"}
+	assert.Equal(t, &metrics.ProxyRequestCount{ProxyID: "pod-uid", RequestCount: 1}, scraper.Scrap(pod))
+	assert.Nil(t, options.SinceTime)
+	assert.Nil(t, options.TailLines)
+}
@@ -0,0 +1,152 @@
+package zeroscaler
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	appsv1 "k8s.io/api/apps/v1"
+
+	k8s "github.com/dailymotion-oss/osiris/pkg/kubernetes"
+)
+
+const (
+	metricsNamespace = "osiris"
+	metricsSubsystem = "zeroscaler"
+
+	outcomeScaledToZero      = "scaled_to_zero"
+	outcomeScaleToZeroFailed = "scale_to_zero_failed"
+	outcomeActive            = "active"
+	outcomePostponed         = "postponed"
+	outcomeUndecidable       = "undecidable"
+)
+
+var (
+	scrapeDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "scrape_duration_seconds",
+			Help:      "Duration of the metrics checks of the workloads, by collector type.",
+			Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2, 3, 5},
+		},
+		[]string{"type"},
+	)
+	scrapeErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "scrape_errors_total",
+			Help:      "Number of failed scrapes, by collector type.",
+		},
+		[]string{"type"},
+	)
+	decisions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "decisions_total",
+			Help:      "Number of decisions taken after a metrics check, by outcome.",
+		},
+		[]string{"outcome"},
+	)
+	lastDecisionTime = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "last_decision_timestamp_seconds",
+			Help:      "Time of the latest decision taken after a metrics check, in seconds since epoch.",
+		},
+	)
+	scaleFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "scale_failures_total",
+			Help:      "Number of failed attempts to scale a workload to zero, by kind.",
+		},
+		[]string{"kind"},
+	)
+
+	collectorsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, metricsSubsystem, "collectors"),
+		"Number of active metrics collectors, by collector type.",
+		[]string{"type"},
+		nil,
+	)
+	workloadsAtZeroDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, metricsSubsystem, "workloads_at_zero"),
+		"Number of Osiris-enabled workloads scaled to zero, by namespace.",
+		[]string{"namespace"},
+		nil,
+	)
+)
+
+func init() {
+	prometheus.MustRegister(
+		scrapeDuration,
+		scrapeErrors,
+		decisions,
+		lastDecisionTime,
+		scaleFailures,
+	)
+}
+
+func recordDecision(outcome string) {
+	decisions.WithLabelValues(outcome).Inc()
+	lastDecisionTime.Set(float64(time.Now().Unix()))
+}
+
+// zeroscalerMetricsCollector is a prometheus collector for the metrics
+// computed from the current state of the zeroscaler.
+type zeroscalerMetricsCollector struct {
+	z *zeroscaler
+}
+
+func (c zeroscalerMetricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collectorsDesc
+	ch <- workloadsAtZeroDesc
+}
+
+func (c zeroscalerMetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	collectorsByType := map[string]int{}
+	c.z.collectorsLock.Lock()
+	for _, collector := range c.z.collectors {
+		collectorsByType[collector.config.scraperConfig.ScraperName]++
+	}
+	c.z.collectorsLock.Unlock()
+	for scraperType, count := range collectorsByType {
+		ch <- prometheus.MustNewConstMetric(collectorsDesc, prometheus.GaugeValue, float64(count), scraperType)
+	}
+
+	for namespace, count := range c.z.countWorkloadsAtZero() {
+		ch <- prometheus.MustNewConstMetric(workloadsAtZeroDesc, prometheus.GaugeValue, float64(count), namespace)
+	}
+}
+
+// countWorkloadsAtZero returns the number of Osiris-enabled deployments and
+// statefulSets running zero replicas - and of parked daemonSets - by namespace.
+func (z *zeroscaler) countWorkloadsAtZero() map[string]int {
+	counts := map[string]int{}
+	for _, obj := range z.deploymentsInformer.GetStore().List() {
+		deployment := obj.(*appsv1.Deployment)
+		if k8s.WorkloadIsEligibleForAutoScaling(deployment.Annotations) &&
+			deployment.Spec.Replicas != nil && *deployment.Spec.Replicas == 0 {
+			counts[deployment.Namespace]++
+		}
+	}
+	for _, obj := range z.statefulSetsInformer.GetStore().List() {
+		statefulSet := obj.(*appsv1.StatefulSet)
+		if k8s.WorkloadIsEligibleForAutoScaling(statefulSet.Annotations) &&
+			statefulSet.Spec.Replicas != nil && *statefulSet.Spec.Replicas == 0 {
+			counts[statefulSet.Namespace]++
+		}
+	}
+	for _, obj := range z.daemonSetsInformer.GetStore().List() {
+		daemonSet := obj.(*appsv1.DaemonSet)
+		if k8s.WorkloadIsEligibleForAutoScaling(daemonSet.Annotations) &&
+			k8s.DaemonSetIsParked(daemonSet.Spec.Template.Spec.NodeSelector) {
+			counts[daemonSet.Namespace]++
+		}
+	}
+	return counts
+}
@@ -2,7 +2,6 @@ package zeroscaler
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"strings"
 	"sync"
@@ -12,11 +11,12 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
-	k8s_types "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 
+	"github.com/dailymotion-oss/osiris/pkg/control"
 	k8s "github.com/dailymotion-oss/osiris/pkg/kubernetes"
+	"github.com/dailymotion-oss/osiris/pkg/metrics/plugin"
 )
 
 type metricsCollectorConfig struct {
@@ -30,35 +30,60 @@ type metricsCollectorConfig struct {
 }
 
 type metricsCollector struct {
-	config       metricsCollectorConfig
-	scraper      metricsScraper
-	kubeClient   kubernetes.Interface
-	podsInformer cache.SharedIndexInformer
-	appPods      map[string]*corev1.Pod
-	appPodsLock  sync.Mutex
-	cancelFunc   func()
+	config         metricsCollectorConfig
+	scraper        metricsScraper
+	kubeClient     kubernetes.Interface
+	controlWatcher control.Watcher
+	podsInformer   cache.SharedIndexInformer
+	appPods        map[string]*corev1.Pod
+	appPodsLock    sync.Mutex
+	cancelFunc     func()
+	// lastActivityTime is the last time the collector observed some activity
+	// for the workload - or the time it started collecting metrics.
+	lastActivityTime     time.Time
+	lastActivityTimeLock sync.RWMutex
+	auditLog             *auditLog
+	// dependencyInUse returns true if a dependency of the workload is still
+	// used by another active workload
+	dependencyInUse func(kind, namespace, name string) bool
+	// the state of the collector, for the status API
+	startTime             time.Time
+	lastScrapeTime        time.Time
+	scrapeCount           int
+	lastScrapeResults     []scrapeResult
+	lastTotalRequestCount uint64
+	idle                  bool
+	statusLock            sync.RWMutex
 }
 
 func newMetricsCollector(
-	kubeClient kubernetes.Interface,
+	clients scraperClients,
+	controlWatcher control.Watcher,
+	auditLog *auditLog,
+	dependencyInUse func(kind, namespace, name string) bool,
 	config metricsCollectorConfig,
 ) (*metricsCollector, error) {
-	s, err := newMetricsScraper(config.scraperConfig)
+	s, err := newMetricsScraper(config.scraperConfig, clients)
 	if err != nil {
 		return nil, err
 	}
 	m := &metricsCollector{
-		config:     config,
-		scraper:    s,
-		kubeClient: kubeClient,
+		config:         config,
+		scraper:        s,
+		kubeClient:     clients.kubeClient,
+		controlWatcher: controlWatcher,
 		podsInformer: k8s.PodsIndexInformer(
-			kubeClient,
+			clients.kubeClient,
 			config.appNamespace,
 			nil,
 			config.selector,
 			config.informerRefreshInterval,
 		),
-		appPods: map[string]*corev1.Pod{},
+		appPods:          map[string]*corev1.Pod{},
+		lastActivityTime: time.Now(),
+		auditLog:         auditLog,
+		dependencyInUse:  dependencyInUse,
+		startTime:        time.Now(),
 	}
 	m.podsInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: m.syncAppPod,
@@ -109,6 +134,9 @@ func (m *metricsCollector) syncDeletedAppPod(obj interface{}) {
 	defer m.appPodsLock.Unlock()
 	pod := obj.(*corev1.Pod)
 	delete(m.appPods, pod.Name)
+	if f, ok := m.scraper.(podForgetter); ok {
+		f.forgetPod(pod)
+	}
 }
 
 func (m *metricsCollector) collectMetrics(ctx context.Context) {
@@ -126,27 +154,78 @@ func (m *metricsCollector) collectMetrics(ctx context.Context) {
 			var (
 				mustNotDecide bool
 				scrapeWG      sync.WaitGroup
+				scrapeTime    = time.Now()
+				scrapeResults []scrapeResult
 			)
 			// An aggressively small timeout. We make the decision fast or not at
 			// all.
 			timer := time.NewTimer(3 * time.Second)
-			for _, pod := range m.appPods {
+			if ws, ok := m.scraper.(workloadScraper); ok {
+				// scrap all the pods at once
+				pods := make([]*corev1.Pod, 0, len(m.appPods))
+				for _, pod := range m.appPods {
+					pods = append(pods, pod)
+				}
 				scrapeWG.Add(1)
-				go func(pod *corev1.Pod) {
+				go func() {
 					defer scrapeWG.Done()
-					// Get the results
-					prc := m.scraper.Scrap(pod)
-					if prc == nil {
+					prcs, err := ws.ScrapWorkload(ctx, m.workload(), pods)
+					requestCountsByProxyLock.Lock()
+					defer requestCountsByProxyLock.Unlock()
+					if err != nil {
+						glog.Errorf(
+							"Error scraping metrics of %s %s in namespace %s: %s",
+							m.config.appKind,
+							m.config.appName,
+							m.config.appNamespace,
+							err,
+						)
 						mustNotDecide = true
-					} else {
-						requestCountsByProxyLock.Lock()
+						scrapeErrors.WithLabelValues(m.config.scraperConfig.ScraperName).Inc()
+						scrapeResults = append(scrapeResults, scrapeResult{Error: err.Error()})
+						return
+					}
+					for _, prc := range prcs {
 						requestCountsByProxy[prc.ProxyID] = prc.RequestCount
-						requestCountsByProxyLock.Unlock()
+						requestCount := prc.RequestCount
+						scrapeResults = append(scrapeResults, scrapeResult{
+							ProxyID:      prc.ProxyID,
+							RequestCount: &requestCount,
+						})
 					}
-				}(pod)
+				}()
+			} else {
+				for _, pod := range m.appPods {
+					scrapeWG.Add(1)
+					go func(pod *corev1.Pod) {
+						defer scrapeWG.Done()
+						// Get the results
+						prc := m.scraper.Scrap(pod)
+						requestCountsByProxyLock.Lock()
+						defer requestCountsByProxyLock.Unlock()
+						if prc == nil {
+							mustNotDecide = true
+							scrapeErrors.WithLabelValues(m.config.scraperConfig.ScraperName).Inc()
+							scrapeResults = append(scrapeResults, scrapeResult{
+								Pod:   pod.Name,
+								Error: "metrics scraping failed, see the zeroscaler logs for details",
+							})
+						} else {
+							requestCountsByProxy[prc.ProxyID] = prc.RequestCount
+							requestCount := prc.RequestCount
+							scrapeResults = append(scrapeResults, scrapeResult{
+								Pod:          pod.Name,
+								ProxyID:      prc.ProxyID,
+								RequestCount: &requestCount,
+							})
+						}
+					}(pod)
+				}
 			}
 			m.appPodsLock.Unlock()
 			scrapeWG.Wait()
+			scrapeDuration.WithLabelValues(m.config.scraperConfig.ScraperName).
+				Observe(time.Since(scrapeTime).Seconds())
 			var totalRequestCount uint64
 			for _, requestCount := range requestCountsByProxy {
 				totalRequestCount += requestCount
@@ -154,13 +233,65 @@ func (m *metricsCollector) collectMetrics(ctx context.Context) {
 			select {
 			case <-timer.C:
 				mustNotDecide = true
+				recordDecision(outcomeUndecidable)
+				m.auditLog.record(
+					m.config.appKind,
+					m.config.appNamespace,
+					m.config.appName,
+					decisionNoDecision,
+					"metrics collection timed out",
+				)
 			case <-ctx.Done():
 				return
 			default:
+				if mustNotDecide {
+					recordDecision(outcomeUndecidable)
+					m.auditLog.record(
+						m.config.appKind,
+						m.config.appNamespace,
+						m.config.appName,
+						decisionNoDecision,
+						"metrics are incomplete",
+					)
+				}
 			}
 			timer.Stop()
-			if !mustNotDecide && totalRequestCount == lastTotalRequestCount {
-				m.scaleToZero(context.TODO())
+			idle := !mustNotDecide && totalRequestCount == lastTotalRequestCount
+			m.setScrapeStatus(scrapeTime, scrapeResults, totalRequestCount, idle)
+			if !mustNotDecide {
+				if idle {
+					if postpone, reason := m.mustPostponeScaleToZero(ctx); postpone {
+						glog.Infof(
+							"Postponing scale to zero of %s %s in namespace %s: %s",
+							m.config.appKind,
+							m.config.appName,
+							m.config.appNamespace,
+							reason,
+						)
+						recordDecision(outcomePostponed)
+						m.auditLog.record(
+							m.config.appKind,
+							m.config.appNamespace,
+							m.config.appName,
+							decisionPostponed,
+							reason,
+						)
+					} else {
+						err := m.scaleToZeroAndAudit(context.TODO(), fmt.Sprintf(
+							"no activity since %s (total request count %d)",
+							m.getLastActivityTime().UTC().Format(time.RFC3339),
+							totalRequestCount,
+						))
+						if err != nil {
+							recordDecision(outcomeScaleToZeroFailed)
+						} else {
+							recordDecision(outcomeScaledToZero)
+						}
+					}
+				} else {
+					recordDecision(outcomeActive)
+					m.setLastActivityTime(time.Now())
+				}
 			}
 			lastTotalRequestCount = totalRequestCount
 		case <-ctx.Done():
@@ -169,31 +300,144 @@ func (m *metricsCollector) collectMetrics(ctx context.Context) {
 	}
 }
 
-func (m *metricsCollector) scaleToZero(ctx context.Context) {
+func (m *metricsCollector) workload() plugin.Workload {
+	return plugin.Workload{
+		Kind:      m.config.appKind,
+		Namespace: m.config.appNamespace,
+		Name:      m.config.appName,
+	}
+}
+
+func (m *metricsCollector) getLastActivityTime() time.Time {
+	m.lastActivityTimeLock.RLock()
+	defer m.lastActivityTimeLock.RUnlock()
+	return m.lastActivityTime
+}
+
+func (m *metricsCollector) setLastActivityTime(t time.Time) {
+	m.lastActivityTimeLock.Lock()
+	defer m.lastActivityTimeLock.Unlock()
+	m.lastActivityTime = t
+}
+
+// activityKnown returns true once the collector has compared the metrics of
+// 2 scrapes, and thus knows if the workload has been active since it started
+func (m *metricsCollector) activityKnown() bool {
+	m.statusLock.RLock()
+	defer m.statusLock.RUnlock()
+	return m.scrapeCount >= 2
+}
+
+// mustPostponeScaleToZero checks if Osiris is frozen for the workload, or if
+// the workload is being rolled out (or paused), in which case it should not
+// be scaled down yet.
+func (m *metricsCollector) mustPostponeScaleToZero(ctx context.Context) (bool, string) {
+	if m.controlWatcher.State().IsFrozen(m.config.appNamespace) {
+		return true, "Osiris is frozen"
+	}
+	switch strings.ToLower(m.config.appKind) {
+	case "deployment":
+		deployment, err := m.kubeClient.AppsV1().Deployments(m.config.appNamespace).Get(ctx, m.config.appName, metav1.GetOptions{})
+		if err != nil {
+			return true, fmt.Sprintf("error retrieving deployment: %s", err)
+		}
+		return deploymentRolloutInProgress(deployment)
+	case "statefulset":
+		statefulSet, err := m.kubeClient.AppsV1().StatefulSets(m.config.appNamespace).Get(ctx, m.config.appName, metav1.GetOptions{})
+		if err != nil {
+			return true, fmt.Sprintf("error retrieving statefulset: %s", err)
+		}
+		return statefulSetRolloutInProgress(statefulSet)
+	}
+	return false, ""
+}
+
+// scaleToZeroAndAudit scales the workload to zero, and records the decision -
+// or its failure - in the audit log once the result is known.
+func (m *metricsCollector) scaleToZeroAndAudit(ctx context.Context, reason string) error {
+	if err := m.scaleToZero(ctx); err != nil {
+		m.auditLog.record(
+			m.config.appKind,
+			m.config.appNamespace,
+			m.config.appName,
+			decisionScaleToZeroFailed,
+			fmt.Sprintf("%s; scaling to zero failed: %s", reason, err),
+		)
+		return err
+	}
+	m.auditLog.record(
+		m.config.appKind,
+		m.config.appNamespace,
+		m.config.appName,
+		decisionScaledToZero,
+		reason,
+	)
+	return nil
+}
+
+// scaleToZero scales the workload to zero, and then its dependencies. It
+// returns an error if the workload itself could not be scaled to zero - in
+// which case its dependencies are left untouched.
+func (m *metricsCollector) scaleToZero(ctx context.Context) error {
+	return scaleToZeroWithDependencies(
+		ctx,
+		m.kubeClient,
+		m.config.appKind,
+		m.config.appNamespace,
+		m.config.appName,
+		m.dependencyInUse,
+	)
+}
+
+// scaleToZeroWithDependencies scales the given workload to zero, and then its
+// dependencies - except the ones still used by other active workloads,
+// according to the given dependencyInUse function. It returns an error if the
+// workload itself could not be scaled to zero - in which case its
+// dependencies are left untouched.
+func scaleToZeroWithDependencies(
+	ctx context.Context,
+	kubeClient kubernetes.Interface,
+	kind string,
+	namespace string,
+	name string,
+	dependencyInUse func(kind, namespace, name string) bool,
+) error {
 	// scale the main app to zero first
-	scaleToZero(ctx, m.kubeClient, m.config.appKind, m.config.appNamespace, m.config.appName)
+	err := scaleToZero(ctx, kubeClient, kind, namespace, name)
+	if err != nil {
+		return err
+	}
 
 	// and then the dependencies - if any
 	var dependenciesAnnotationValue string
-	switch strings.ToLower(m.config.appKind) {
+	switch strings.ToLower(kind) {
 	case "deployment":
-		deployment, err := m.kubeClient.AppsV1().Deployments(m.config.appNamespace).Get(ctx, m.config.appName, metav1.GetOptions{})
+		deployment, err := kubeClient.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
 		if err != nil {
-			glog.Errorf("Error retrieving deployment %s in namespace %s: %s", m.config.appName, m.config.appNamespace, err)
-			return
+			glog.Errorf("Error retrieving deployment %s in namespace %s: %s", name, namespace, err)
+			return nil
 		}
 		if deployment.Annotations != nil {
 			dependenciesAnnotationValue = cleanAnnotationValue(deployment.Annotations["osiris.dm.gg/dependencies"])
 		}
 	case "statefulset":
-		statefulset, err := m.kubeClient.AppsV1().StatefulSets(m.config.appNamespace).Get(ctx, m.config.appName, metav1.GetOptions{})
+		statefulset, err := kubeClient.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
 		if err != nil {
-			glog.Errorf("Error retrieving statefulset %s in namespace %s: %s", m.config.appName, m.config.appNamespace, err)
-			return
+			glog.Errorf("Error retrieving statefulset %s in namespace %s: %s", name, namespace, err)
+			return nil
 		}
 		if statefulset.Annotations != nil {
 			dependenciesAnnotationValue = cleanAnnotationValue(statefulset.Annotations["osiris.dm.gg/dependencies"])
 		}
+	case "daemonset":
+		daemonSet, err := kubeClient.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			glog.Errorf("Error retrieving daemonset %s in namespace %s: %s", name, namespace, err)
+			return nil
+		}
+		if daemonSet.Annotations != nil {
+			dependenciesAnnotationValue = cleanAnnotationValue(daemonSet.Annotations["osiris.dm.gg/dependencies"])
+		}
 	}
 
 	for _, dependency := range strings.Split(dependenciesAnnotationValue, ",") {
@@ -205,46 +449,39 @@ func (m *metricsCollector) scaleToZero(ctx context.Context) {
 		elems = strings.SplitN(elems[1], "/", 2)
 		depNamespace := elems[0]
 		depName := elems[1]
-		scaleToZero(ctx, m.kubeClient, depKind, depNamespace, depName)
+		if dependencyInUse != nil && dependencyInUse(depKind, depNamespace, depName) {
+			glog.Infof(
+				"Not scaling %s %s in namespace %s to zero: it is a dependency of another active workload",
+				depKind,
+				depName,
+				depNamespace,
+			)
+			continue
+		}
+		// a failure is logged, and doesn't prevent the other dependencies from
+		// being scaled to zero
+		_ = scaleToZero(ctx, kubeClient, depKind, depNamespace, depName)
 	}
+	return nil
 }
 
-func scaleToZero(ctx context.Context, kubeClient kubernetes.Interface, kind, namespace, name string) {
+func scaleToZero(ctx context.Context, kubeClient kubernetes.Interface, kind, namespace, name string) error {
 	glog.Infof("Scale to zero starting for %s %s in namespace %s", kind, name, namespace)
 
-	patches := []k8s.PatchOperation{{
-		Op:    "replace",
-		Path:  "/spec/replicas",
-		Value: 0,
-	}}
-	patchesBytes, _ := json.Marshal(patches)
 	var err error
-	switch strings.ToLower(kind) {
-	case "deployment":
-		_, err = kubeClient.AppsV1().Deployments(namespace).Patch(
-			ctx,
-			name,
-			k8s_types.JSONPatchType,
-			patchesBytes,
-			metav1.PatchOptions{},
-		)
-	case "statefulset":
-		_, err = kubeClient.AppsV1().StatefulSets(namespace).Patch(
-			ctx,
-			name,
-			k8s_types.JSONPatchType,
-			patchesBytes,
-			metav1.PatchOptions{},
-		)
-	default:
-		err = fmt.Errorf("unknown kind '%s'", kind)
+	if strings.ToLower(kind) == "daemonset" {
+		err = parkDaemonSet(ctx, kubeClient, namespace, name)
+	} else {
+		err = patchWorkload(ctx, kubeClient, kind, namespace, name, k8s.ScalePatch(0))
 	}
 	if err != nil {
 		glog.Errorf("Error scaling %s %s in namespace %s to zero: %s", kind, name, namespace, err)
-		return
+		scaleFailures.WithLabelValues(kind).Inc()
+		return err
 	}
 
 	glog.Infof("Scaled %s %s in namespace %s to zero", kind, name, namespace)
+	return nil
 }
 
 func cleanAnnotationValue(rawValue string) string {
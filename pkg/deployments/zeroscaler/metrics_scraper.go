@@ -3,31 +3,69 @@ package zeroscaler
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	metricsclientset "k8s.io/metrics/pkg/client/clientset/versioned"
 
 	"github.com/dailymotion-oss/osiris/pkg/metrics"
 )
 
+// scrapeTimeout is the timeout of the scraping of the metrics of a pod - or of
+// a whole workload. A very aggressive timeout: when collecting metrics, we want
+// to do it very quickly to minimize the possibility that some pods we've
+// checked on have been active while we've been checking on OTHER pods.
+const scrapeTimeout = 2 * time.Second
+
 type metricsScraperConfig struct {
 	ScraperName    string          `json:"type"`
 	Implementation json.RawMessage `json:"implementation"`
 }
 
+// scraperClients are the clients available to the metrics scrapers
+type scraperClients struct {
+	kubeClient    kubernetes.Interface
+	metricsClient metricsclientset.Interface
+	restConfig    *rest.Config
+}
+
 type metricsScraper interface {
 	Scrap(pod *corev1.Pod) *metrics.ProxyRequestCount
 }
 
-func newMetricsScraper(config metricsScraperConfig) (metricsScraper, error) {
+// podForgetter is implemented by the metrics scrapers which keep a state for
+// each pod, to forget about the deleted pods.
+type podForgetter interface {
+	forgetPod(pod *corev1.Pod)
+}
+
+func newMetricsScraper(
+	config metricsScraperConfig,
+	clients scraperClients,
+) (metricsScraper, error) {
 	var (
 		scraper metricsScraper
 		err     error
 	)
 	switch config.ScraperName {
 	case prometheusScraperName:
-		scraper, err = newPrometheusScraper(config)
+		scraper, err = newPrometheusScraper(config, clients)
 	case osirisScraperName:
 		scraper = newOsirisScraper()
+	case envoyScraperName:
+		scraper, err = newEnvoyScraper(config)
+	case execScraperName:
+		scraper, err = newExecScraper(config, clients)
+	case logScraperName:
+		scraper, err = newLogScraper(config, clients)
+	case pluginScraperName:
+		scraper, err = newPluginScraper(config)
+	case resourceScraperName:
+		scraper, err = newResourceScraper(config, clients)
+	case compositeScraperName:
+		scraper, err = newCompositeScraper(config, clients)
 	default:
 		return nil, fmt.Errorf("unknown scraper %s", config.ScraperName)
 	}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"time"
 
 	"github.com/golang/glog"
 	corev1 "k8s.io/api/core/v1"
@@ -30,11 +29,8 @@ type osirisScraper struct {
 
 func newOsirisScraper() *osirisScraper {
 	return &osirisScraper{
-		// A very aggressive timeout. When collecting metrics, we want to do it very
-		// quickly to minimize the possibility that some pods we've checked on have
-		// served requests while we've been checking on OTHER pods.
 		httpClient: &http.Client{
-			Timeout: 2 * time.Second,
+			Timeout: scrapeTimeout,
 		},
 	}
 }
@@ -0,0 +1,337 @@
+package zeroscaler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8s_types "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	k8s "github.com/dailymotion-oss/osiris/pkg/kubernetes"
+)
+
+// workload is a deployment or a statefulSet
+type workload interface {
+	metav1.Object
+	runtime.Object
+}
+
+// frozenPause is the pause of a workload manually scaled while Osiris is
+// frozen, kept in memory until the end of the freeze.
+type frozenPause struct {
+	until time.Time
+	// replicas is the acknowledged number of replicas
+	replicas int32
+}
+
+// hpaTargetIndexName is the name of the index of the HPAs by target
+const hpaTargetIndexName = "target"
+
+// hpaTargetIndexFunc indexes the HPAs by the key of the workload they scale
+func hpaTargetIndexFunc(obj interface{}) ([]string, error) {
+	hpa, ok := obj.(*autoscalingv1.HorizontalPodAutoscaler)
+	if !ok {
+		return nil, nil
+	}
+	return []string{getKey(
+		hpa.Spec.ScaleTargetRef.Kind,
+		hpa.Namespace,
+		hpa.Spec.ScaleTargetRef.Name,
+	)}, nil
+}
+
+// scaledByHPA checks if the given workload is scaled by an HPA - in which case
+// its scale ups are not manual scalings.
+func (z *zeroscaler) scaledByHPA(kind, namespace, name string) bool {
+	if z.hpasInformer == nil {
+		return false
+	}
+	hpas, err := z.hpasInformer.GetIndexer().ByIndex(
+		hpaTargetIndexName,
+		getKey(kind, namespace, name),
+	)
+	return err == nil && len(hpas) > 0
+}
+
+// pausedUntil checks if the zeroscaler should leave the number of replicas of
+// the given workload untouched, and until when. This is the case if the
+// workload has been paused with the osiris.dm.gg/pausedUntil annotation, or if
+// it has been scaled up by someone else than Osiris - a manual scaling, in
+// which case it is paused for the configured duration. Manual scalings are
+// detected against the latest number of replicas acknowledged by Osiris - in
+// the osiris.dm.gg/scaledReplicas annotation, or in memory while frozen - and
+// never for the workloads scaled by an HPA.
+func (z *zeroscaler) pausedUntil(
+	kind string,
+	w workload,
+	replicas *int32,
+) (until time.Time, manualScaling bool, paused bool) {
+	annotations := w.GetAnnotations()
+	if pausedUntil, ok := k8s.GetPausedUntil(annotations); ok &&
+		time.Now().Before(pausedUntil) {
+		return pausedUntil, false, true
+	}
+
+	if z.cfg.ManualScalingPauseDuration <= 0 || replicas == nil ||
+		z.scaledByHPA(kind, w.GetNamespace(), w.GetName()) {
+		return time.Time{}, false, false
+	}
+	z.collectorsLock.Lock()
+	frozenPause, frozenPaused := z.frozenPauses[w.GetUID()]
+	z.collectorsLock.Unlock()
+	if frozenPaused && time.Now().Before(frozenPause.until) {
+		return frozenPause.until, true, true
+	}
+	scaledReplicas, ok := k8s.GetScaledReplicas(annotations)
+	if frozenPaused && (!ok || frozenPause.replicas > scaledReplicas) {
+		scaledReplicas, ok = frozenPause.replicas, true
+	}
+	if !ok || *replicas <= scaledReplicas {
+		return time.Time{}, false, false
+	}
+	return time.Now().Add(z.cfg.ManualScalingPauseDuration).UTC(), true, true
+}
+
+// ensureScaledReplicasBaseline records the current number of replicas of the
+// given workload in its osiris.dm.gg/scaledReplicas annotation if it's
+// missing - the workload was never scaled by Osiris - if the workload has
+// been scaled down by someone else than Osiris, or if a manual scaling has
+// been acknowledged while frozen. This is the baseline against which the
+// manual scalings are detected. Nothing is recorded while frozen.
+func (z *zeroscaler) ensureScaledReplicasBaseline(
+	kind string,
+	w workload,
+	replicas *int32,
+) {
+	if z.cfg.ManualScalingPauseDuration <= 0 || replicas == nil ||
+		z.controlWatcher.State().IsFrozen(w.GetNamespace()) ||
+		z.scaledByHPA(kind, w.GetNamespace(), w.GetName()) {
+		return
+	}
+	z.collectorsLock.Lock()
+	_, frozenPaused := z.frozenPauses[w.GetUID()]
+	z.collectorsLock.Unlock()
+	scaledReplicas, ok := k8s.GetScaledReplicas(w.GetAnnotations())
+	if ok && *replicas >= scaledReplicas && !frozenPaused {
+		return
+	}
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				k8s.ScaledReplicasAnnotationName: strconv.Itoa(int(*replicas)),
+			},
+		},
+	})
+	if err := patchWorkload(
+		z.ctx,
+		z.kubeClient,
+		kind,
+		w.GetNamespace(),
+		w.GetName(),
+		patch,
+	); err != nil {
+		glog.Errorf(
+			"Error recording the number of replicas of %s %s in namespace %s: %s",
+			strings.ToLower(kind),
+			w.GetName(),
+			w.GetNamespace(),
+			err,
+		)
+		return
+	}
+	z.forgetFrozenPause(w.GetUID())
+}
+
+// forgetFrozenPause forgets the in-memory pause of the given workload
+func (z *zeroscaler) forgetFrozenPause(uid k8s_types.UID) {
+	z.collectorsLock.Lock()
+	defer z.collectorsLock.Unlock()
+	delete(z.frozenPauses, uid)
+}
+
+// pause stops the metrics collection of the given workload until the end of
+// its pause. A manual scaling is recorded in the annotations of the workload,
+// so that the workload stays paused even if the zeroscaler restarts - or in
+// memory while Osiris is frozen, until the end of the freeze.
+func (z *zeroscaler) pause(
+	kind string,
+	w workload,
+	replicas *int32,
+	pausedUntil time.Time,
+	manualScaling bool,
+) {
+	if manualScaling {
+		scaledReplicas, _ := k8s.GetScaledReplicas(w.GetAnnotations())
+		z.collectorsLock.Lock()
+		_, frozenPaused := z.frozenPauses[w.GetUID()]
+		z.collectorsLock.Unlock()
+		if !frozenPaused {
+			glog.Infof(
+				"Osiris-enabled %s %s in namespace %s has been scaled from %d to %d "+
+					"replicas by someone else than Osiris; pausing it until %s",
+				strings.ToLower(kind),
+				w.GetName(),
+				w.GetNamespace(),
+				scaledReplicas,
+				*replicas,
+				pausedUntil.Format(time.RFC3339),
+			)
+		}
+		if z.controlWatcher.State().IsFrozen(w.GetNamespace()) {
+			if !frozenPaused {
+				glog.Infof(
+					"Osiris is frozen; keeping the pause of %s %s in namespace %s "+
+						"in memory until the end of the freeze",
+					strings.ToLower(kind),
+					w.GetName(),
+					w.GetNamespace(),
+				)
+			}
+			z.collectorsLock.Lock()
+			z.frozenPauses[w.GetUID()] = frozenPause{
+				until:    pausedUntil,
+				replicas: *replicas,
+			}
+			z.collectorsLock.Unlock()
+		} else if err := z.recordManualScalingPause(kind, w, *replicas, pausedUntil); err != nil {
+			glog.Errorf(
+				"Error pausing %s %s in namespace %s: %s",
+				strings.ToLower(kind),
+				w.GetName(),
+				w.GetNamespace(),
+				err,
+			)
+		} else {
+			z.forgetFrozenPause(w.GetUID())
+			z.recorder.Eventf(
+				w,
+				corev1.EventTypeNormal,
+				"ScaleDownPaused",
+				"Scaled from %d to %d replicas by someone else than Osiris; "+
+					"scale down paused until %s",
+				scaledReplicas,
+				*replicas,
+				pausedUntil.Format(time.RFC3339),
+			)
+		}
+	} else {
+		glog.Infof(
+			"Osiris-enabled %s %s in namespace %s is paused until %s",
+			strings.ToLower(kind),
+			w.GetName(),
+			w.GetNamespace(),
+			pausedUntil.Format(time.RFC3339),
+		)
+	}
+	// make sure we'll get notified once the pause is over
+	z.resyncAfter(kind, w.GetNamespace(), w.GetName(), time.Until(pausedUntil))
+	z.ensurePausedMetricsCollection(kind, w.GetNamespace(), w.GetName(), pausedUntil)
+}
+
+// recordManualScalingPause sets the pause of a manually scaled workload in its
+// annotations.
+func (z *zeroscaler) recordManualScalingPause(
+	kind string,
+	w workload,
+	replicas int32,
+	pausedUntil time.Time,
+) error {
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				k8s.PausedUntilAnnotationName: pausedUntil.Format(time.RFC3339),
+				// acknowledge the new number of replicas, so that we don't pause it
+				// again and again
+				k8s.ScaledReplicasAnnotationName: strconv.Itoa(int(replicas)),
+			},
+		},
+	})
+	return patchWorkload(
+		z.ctx,
+		z.kubeClient,
+		kind,
+		w.GetNamespace(),
+		w.GetName(),
+		patch,
+	)
+}
+
+// resyncAfter re-syncs the given workload after the given duration. Only the
+// latest requested re-sync of a workload is kept.
+func (z *zeroscaler) resyncAfter(kind, namespace, name string, d time.Duration) {
+	z.resyncTimersLock.Lock()
+	defer z.resyncTimersLock.Unlock()
+	key := getKey(kind, namespace, name)
+	if timer, ok := z.resyncTimers[key]; ok {
+		timer.Stop()
+	}
+	z.resyncTimers[key] = time.AfterFunc(d, func() {
+		z.resyncTimersLock.Lock()
+		delete(z.resyncTimers, key)
+		z.resyncTimersLock.Unlock()
+		storeKey := fmt.Sprintf("%s/%s", namespace, name)
+		switch strings.ToLower(kind) {
+		case "deployment":
+			if obj, found, _ := z.deploymentsInformer.GetStore().GetByKey(storeKey); found {
+				z.syncDeployment(obj)
+			}
+		case "statefulset":
+			if obj, found, _ := z.statefulSetsInformer.GetStore().GetByKey(storeKey); found {
+				z.syncStatefulSet(obj)
+			}
+		case "daemonset":
+			if obj, found, _ := z.daemonSetsInformer.GetStore().GetByKey(storeKey); found {
+				z.syncDaemonSet(obj)
+			}
+		}
+	})
+}
+
+// patchWorkload applies the given merge patch to a deployment, statefulSet or
+// daemonSet
+func patchWorkload(
+	ctx context.Context,
+	kubeClient kubernetes.Interface,
+	kind, namespace, name string,
+	patch []byte,
+) error {
+	var err error
+	switch strings.ToLower(kind) {
+	case "deployment":
+		_, err = kubeClient.AppsV1().Deployments(namespace).Patch(
+			ctx,
+			name,
+			k8s_types.MergePatchType,
+			patch,
+			metav1.PatchOptions{},
+		)
+	case "statefulset":
+		_, err = kubeClient.AppsV1().StatefulSets(namespace).Patch(
+			ctx,
+			name,
+			k8s_types.MergePatchType,
+			patch,
+			metav1.PatchOptions{},
+		)
+	case "daemonset":
+		_, err = kubeClient.AppsV1().DaemonSets(namespace).Patch(
+			ctx,
+			name,
+			k8s_types.MergePatchType,
+			patch,
+			metav1.PatchOptions{},
+		)
+	default:
+		err = fmt.Errorf("unknown kind '%s'", kind)
+	}
+	return err
+}
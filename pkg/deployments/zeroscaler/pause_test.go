@@ -0,0 +1,355 @@
+package zeroscaler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8s_types "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8s_testing "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/dailymotion-oss/osiris/pkg/control"
+	k8s "github.com/dailymotion-oss/osiris/pkg/kubernetes"
+)
+
+// staticWatcher is a control watcher with a fixed state
+type staticWatcher struct {
+	state control.State
+}
+
+func (staticWatcher) Run(context.Context) {}
+
+func (w staticWatcher) State() control.State {
+	return w.state
+}
+
+func TestPause(t *testing.T) {
+	var (
+		one   int32 = 1
+		three int32 = 3
+	)
+
+	tests := []struct {
+		name                  string
+		annotations           map[string]string
+		replicas              *int32
+		frozen                bool
+		scaledByHPA           bool
+		patchFails            bool
+		expectedResult        bool
+		expectedManualScaling bool
+		expectedPatch         bool
+		expectedEvent         bool
+	}{
+		{
+			name:           "never scaled by osiris",
+			annotations:    map[string]string{},
+			replicas:       &three,
+			expectedResult: false,
+		},
+		{
+			name: "scaled by osiris",
+			annotations: map[string]string{
+				k8s.ScaledReplicasAnnotationName: "1",
+			},
+			replicas:       &one,
+			expectedResult: false,
+		},
+		{
+			name: "scaled up by someone else",
+			annotations: map[string]string{
+				k8s.ScaledReplicasAnnotationName: "1",
+			},
+			replicas:              &three,
+			expectedResult:        true,
+			expectedManualScaling: true,
+			expectedPatch:         true,
+			expectedEvent:         true,
+		},
+		{
+			name: "scaled up by an HPA",
+			annotations: map[string]string{
+				k8s.ScaledReplicasAnnotationName: "1",
+			},
+			replicas:       &three,
+			scaledByHPA:    true,
+			expectedResult: false,
+		},
+		{
+			name: "scaled up by someone else while frozen",
+			annotations: map[string]string{
+				k8s.ScaledReplicasAnnotationName: "1",
+			},
+			replicas:              &three,
+			frozen:                true,
+			expectedResult:        true,
+			expectedManualScaling: true,
+		},
+		{
+			name: "scaled up by someone else, but the patch fails",
+			annotations: map[string]string{
+				k8s.ScaledReplicasAnnotationName: "1",
+			},
+			replicas:              &three,
+			patchFails:            true,
+			expectedResult:        true,
+			expectedManualScaling: true,
+		},
+		{
+			name: "explicitly paused",
+			annotations: map[string]string{
+				k8s.PausedUntilAnnotationName: time.Now().Add(time.Hour).Format(time.RFC3339),
+			},
+			replicas:       &one,
+			expectedResult: true,
+		},
+		{
+			name: "pause is over",
+			annotations: map[string]string{
+				k8s.PausedUntilAnnotationName: time.Now().Add(-time.Hour).Format(time.RFC3339),
+			},
+			replicas:       &one,
+			expectedResult: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deployment := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "ns",
+					Name:        "app",
+					Annotations: test.annotations,
+				},
+				Spec: appsv1.DeploymentSpec{Replicas: test.replicas},
+			}
+			kubeClient := fake.NewSimpleClientset(deployment)
+			if test.patchFails {
+				kubeClient.PrependReactor("patch", "deployments", func(k8s_testing.Action) (bool, runtime.Object, error) {
+					return true, nil, errors.New("patch failed")
+				})
+			}
+			recorder := record.NewFakeRecorder(10)
+			hpasInformer := newTestHPAsInformer(t, kubeClient)
+			if test.scaledByHPA {
+				require.NoError(t, hpasInformer.GetIndexer().Add(newTestHPA("Deployment", "app")))
+			}
+			z := &zeroscaler{
+				hpasInformer:   hpasInformer,
+				cfg:            Config{ManualScalingPauseDuration: time.Hour},
+				kubeClient:     kubeClient,
+				collectors:     map[string]*metricsCollector{},
+				pauses:         map[string]time.Time{},
+				frozenPauses:   map[k8s_types.UID]frozenPause{},
+				resyncTimers:   map[string]*time.Timer{},
+				recorder:       recorder,
+				controlWatcher: staticWatcher{state: control.State{Frozen: test.frozen}},
+				auditLog:       newAuditLog(10),
+				ctx:            context.Background(),
+			}
+			defer func() {
+				for _, timer := range z.resyncTimers {
+					timer.Stop()
+				}
+			}()
+
+			pausedUntil, manualScaling, paused := z.pausedUntil("Deployment", deployment, deployment.Spec.Replicas)
+			assert.Equal(t, test.expectedResult, paused)
+			assert.Equal(t, test.expectedManualScaling, manualScaling)
+			// the predicate has no side effects
+			assert.Empty(t, kubeClient.Actions())
+			if !paused {
+				return
+			}
+
+			z.pause("Deployment", deployment, deployment.Spec.Replicas, pausedUntil, manualScaling)
+			assert.Equal(t, map[string]time.Time{
+				getKey("Deployment", "ns", "app"): pausedUntil,
+			}, z.pauses)
+			assert.Equal(t, test.expectedEvent, len(recorder.Events) > 0)
+
+			patched, err := kubeClient.AppsV1().Deployments("ns").Get(
+				context.Background(),
+				"app",
+				metav1.GetOptions{},
+			)
+			require.NoError(t, err)
+			if test.expectedPatch {
+				_, paused := k8s.GetPausedUntil(patched.Annotations)
+				assert.True(t, paused)
+				assert.Equal(
+					t,
+					"3",
+					patched.Annotations[k8s.ScaledReplicasAnnotationName],
+				)
+			} else {
+				assert.Equal(t, test.annotations, patched.Annotations)
+			}
+		})
+	}
+}
+
+func newTestHPAsInformer(t *testing.T, kubeClient *fake.Clientset) cache.SharedIndexInformer {
+	informer := k8s.HorizontalPodAutoscalersIndexInformer(kubeClient, metav1.NamespaceAll, nil, nil, 0)
+	require.NoError(t, informer.AddIndexers(cache.Indexers{hpaTargetIndexName: hpaTargetIndexFunc}))
+	return informer
+}
+
+func newTestHPA(kind, name string) *autoscalingv1.HorizontalPodAutoscaler {
+	return &autoscalingv1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name},
+		Spec: autoscalingv1.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{
+				Kind: kind,
+				Name: name,
+			},
+		},
+	}
+}
+
+func TestPauseWhileFrozen(t *testing.T) {
+	var three int32 = 3
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "ns",
+			Name:      "app",
+			UID:       "app-uid",
+			Annotations: map[string]string{
+				k8s.ScaledReplicasAnnotationName: "1",
+			},
+		},
+		Spec: appsv1.DeploymentSpec{Replicas: &three},
+	}
+	kubeClient := fake.NewSimpleClientset(deployment)
+	z := &zeroscaler{
+		cfg:            Config{ManualScalingPauseDuration: time.Hour},
+		kubeClient:     kubeClient,
+		hpasInformer:   newTestHPAsInformer(t, kubeClient),
+		collectors:     map[string]*metricsCollector{},
+		pauses:         map[string]time.Time{},
+		frozenPauses:   map[k8s_types.UID]frozenPause{},
+		resyncTimers:   map[string]*time.Timer{},
+		recorder:       record.NewFakeRecorder(10),
+		controlWatcher: staticWatcher{state: control.State{Frozen: true}},
+		auditLog:       newAuditLog(10),
+		ctx:            context.Background(),
+	}
+	defer func() {
+		for _, timer := range z.resyncTimers {
+			timer.Stop()
+		}
+	}()
+
+	// the pause is kept in memory while frozen, so that it eventually expires
+	pausedUntil, manualScaling, paused := z.pausedUntil("Deployment", deployment, deployment.Spec.Replicas)
+	require.True(t, paused)
+	z.pause("Deployment", deployment, deployment.Spec.Replicas, pausedUntil, manualScaling)
+	nextPausedUntil, _, paused := z.pausedUntil("Deployment", deployment, deployment.Spec.Replicas)
+	assert.True(t, paused)
+	assert.Equal(t, pausedUntil, nextPausedUntil)
+	assert.Empty(t, kubeClient.Actions())
+
+	// once the pause is over, the acknowledged scaling doesn't pause again
+	z.frozenPauses["app-uid"] = frozenPause{
+		until:    time.Now().Add(-time.Minute),
+		replicas: three,
+	}
+	_, _, paused = z.pausedUntil("Deployment", deployment, deployment.Spec.Replicas)
+	assert.False(t, paused)
+
+	// and the acknowledged number of replicas is recorded after the freeze
+	z.ensureScaledReplicasBaseline("Deployment", deployment, deployment.Spec.Replicas)
+	assert.Empty(t, kubeClient.Actions())
+	z.controlWatcher = staticWatcher{}
+	z.ensureScaledReplicasBaseline("Deployment", deployment, deployment.Spec.Replicas)
+	patched, err := kubeClient.AppsV1().Deployments("ns").Get(context.Background(), "app", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "3", patched.Annotations[k8s.ScaledReplicasAnnotationName])
+	assert.Empty(t, z.frozenPauses)
+}
+
+func TestEnsureScaledReplicasBaseline(t *testing.T) {
+	var (
+		one   int32 = 1
+		three int32 = 3
+	)
+
+	tests := []struct {
+		name                   string
+		annotations            map[string]string
+		replicas               *int32
+		scaledByHPA            bool
+		expectedScaledReplicas string
+	}{
+		{
+			name:                   "never scaled by osiris",
+			annotations:            map[string]string{},
+			replicas:               &three,
+			expectedScaledReplicas: "3",
+		},
+		{
+			name: "scaled down by someone else",
+			annotations: map[string]string{
+				k8s.ScaledReplicasAnnotationName: "3",
+			},
+			replicas:               &one,
+			expectedScaledReplicas: "1",
+		},
+		{
+			name: "scaled up by someone else",
+			annotations: map[string]string{
+				k8s.ScaledReplicasAnnotationName: "1",
+			},
+			replicas:               &three,
+			expectedScaledReplicas: "1",
+		},
+		{
+			name:        "scaled by an HPA",
+			annotations: map[string]string{},
+			replicas:    &three,
+			scaledByHPA: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deployment := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "ns",
+					Name:        "app",
+					Annotations: test.annotations,
+				},
+				Spec: appsv1.DeploymentSpec{Replicas: test.replicas},
+			}
+			kubeClient := fake.NewSimpleClientset(deployment)
+			hpasInformer := newTestHPAsInformer(t, kubeClient)
+			if test.scaledByHPA {
+				require.NoError(t, hpasInformer.GetIndexer().Add(newTestHPA("Deployment", "app")))
+			}
+			z := &zeroscaler{
+				cfg:            Config{ManualScalingPauseDuration: time.Hour},
+				kubeClient:     kubeClient,
+				hpasInformer:   hpasInformer,
+				frozenPauses:   map[k8s_types.UID]frozenPause{},
+				controlWatcher: staticWatcher{},
+				ctx:            context.Background(),
+			}
+
+			z.ensureScaledReplicasBaseline("Deployment", deployment, deployment.Spec.Replicas)
+
+			patched, err := kubeClient.AppsV1().Deployments("ns").Get(context.Background(), "app", metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedScaledReplicas, patched.Annotations[k8s.ScaledReplicasAnnotationName])
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package zeroscaler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/dailymotion-oss/osiris/pkg/metrics"
+	"github.com/dailymotion-oss/osiris/pkg/metrics/plugin"
+)
+
+const (
+	pluginScraperName = "plugin"
+)
+
+type pluginScraperConfig struct {
+	// URL is the base URL of the plugin service, for example
+	// http://my-collector.my-namespace.svc:8080
+	URL string `json:"url"`
+	// Config is the plugin-specific configuration, sent as-is to the plugin
+	Config json.RawMessage `json:"config"`
+}
+
+// workloadScraper is implemented by the metrics scrapers which can scrap all
+// the pods of a workload at once.
+type workloadScraper interface {
+	ScrapWorkload(
+		ctx context.Context,
+		workload plugin.Workload,
+		pods []*corev1.Pod,
+	) ([]*metrics.ProxyRequestCount, error)
+}
+
+// pluginScraper is a metrics scraper that delegates the collection of the
+// activity of the pods to an external collector service, using the collector
+// plugin protocol.
+type pluginScraper struct {
+	config pluginScraperConfig
+	client *plugin.Client
+}
+
+func newPluginScraper(config metricsScraperConfig) (*pluginScraper, error) {
+	var cfg pluginScraperConfig
+	if err := json.Unmarshal(config.Implementation, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid plugin configuration: %s", err)
+	}
+	if len(cfg.URL) == 0 {
+		return nil, errors.New("Plugin metrics can't be scraped: missing url")
+	}
+
+	return &pluginScraper{
+		config: cfg,
+		client: plugin.NewClient(scrapeTimeout),
+	}, nil
+}
+
+// Scrap considers the given pod as the whole workload. The metrics collector
+// uses ScrapWorkload instead.
+func (s *pluginScraper) Scrap(pod *corev1.Pod) *metrics.ProxyRequestCount {
+	prcs, err := s.ScrapWorkload(context.Background(), podWorkload(pod), []*corev1.Pod{pod})
+	if err != nil {
+		glog.Errorf("Error collecting metrics of pod %s in namespace %s from plugin %s: %s", pod.Name, pod.Namespace, s.config.URL, err)
+		return nil
+	}
+	return prcs[0]
+}
+
+func (s *pluginScraper) ScrapWorkload(
+	ctx context.Context,
+	workload plugin.Workload,
+	pods []*corev1.Pod,
+) ([]*metrics.ProxyRequestCount, error) {
+	request := plugin.CollectRequest{
+		Workload: workload,
+		Pods:     make([]plugin.Pod, 0, len(pods)),
+		Config:   s.config.Config,
+	}
+	for _, pod := range pods {
+		request.Pods = append(request.Pods, pluginPod(pod))
+	}
+
+	response, err := s.client.Collect(ctx, s.config.URL, request)
+	if err != nil {
+		return nil, err
+	}
+
+	countsByUID := make(map[string]uint64, len(response.Pods))
+	for _, activity := range response.Pods {
+		countsByUID[activity.UID] = activity.ActivityCount
+	}
+	prcs := make([]*metrics.ProxyRequestCount, 0, len(pods))
+	for _, pod := range pods {
+		count, found := countsByUID[string(pod.UID)]
+		if !found {
+			// make sure not to decide on incomplete metrics
+			return nil, fmt.Errorf("missing activity for pod %s", pod.Name)
+		}
+		prcs = append(prcs, &metrics.ProxyRequestCount{
+			ProxyID:      string(pod.UID),
+			RequestCount: count,
+		})
+	}
+	return prcs, nil
+}
+
+// podWorkload returns the workload of the given pod, from its controller:
+// the pods of a deployment are controlled by one of its replicasets, named
+// after the deployment and the hash of the pod template.
+func podWorkload(pod *corev1.Pod) plugin.Workload {
+	workload := plugin.Workload{Namespace: pod.Namespace}
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return workload
+	}
+	workload.Kind, workload.Name = owner.Kind, owner.Name
+	if owner.Kind == "ReplicaSet" {
+		hash := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+		if len(hash) > 0 && strings.HasSuffix(owner.Name, "-"+hash) {
+			workload.Kind = "Deployment"
+			workload.Name = strings.TrimSuffix(owner.Name, "-"+hash)
+		}
+	}
+	return workload
+}
+
+func pluginPod(pod *corev1.Pod) plugin.Pod {
+	p := plugin.Pod{
+		Name:     pod.Name,
+		UID:      string(pod.UID),
+		IP:       pod.Status.PodIP,
+		NodeName: pod.Spec.NodeName,
+		Labels:   pod.Labels,
+		Ports:    map[string]int32{},
+	}
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if len(port.Name) > 0 {
+				p.Ports[port.Name] = port.ContainerPort
+			}
+		}
+	}
+	return p
+}
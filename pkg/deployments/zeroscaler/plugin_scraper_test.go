@@ -0,0 +1,159 @@
+package zeroscaler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/dailymotion-oss/osiris/pkg/metrics"
+	"github.com/dailymotion-oss/osiris/pkg/metrics/plugin"
+)
+
+func TestPluginScraper(t *testing.T) {
+	pods := []*corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod-1", UID: "uid-1"},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:  "app",
+						Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}},
+					},
+				},
+			},
+			Status: corev1.PodStatus{PodIP: "10.0.0.1"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod-2", UID: "uid-2"},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		counts         map[string]uint64
+		expectedResult []*metrics.ProxyRequestCount
+		expectedError  bool
+	}{
+		{
+			name: "all pods",
+			counts: map[string]uint64{
+				"uid-1": 3,
+				"uid-2": 5,
+			},
+			expectedResult: []*metrics.ProxyRequestCount{
+				{ProxyID: "uid-1", RequestCount: 3},
+				{ProxyID: "uid-2", RequestCount: 5},
+			},
+		},
+		{
+			name: "missing pod",
+			counts: map[string]uint64{
+				"uid-1": 3,
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var received plugin.CollectRequest
+			server := httptest.NewServer(plugin.NewHandler(plugin.CollectorFunc(
+				func(_ context.Context, request plugin.CollectRequest) ([]plugin.PodActivity, error) {
+					received = request
+					activities := []plugin.PodActivity{}
+					for uid, count := range test.counts {
+						activities = append(activities, plugin.PodActivity{UID: uid, ActivityCount: count})
+					}
+					return activities, nil
+				},
+			)))
+			defer server.Close()
+
+			scraper, err := newPluginScraper(metricsScraperConfig{
+				ScraperName:    pluginScraperName,
+				Implementation: json.RawMessage(`{"url": "` + server.URL + `", "config": {"queue": "jobs"}}`),
+			})
+			assert.NoError(t, err)
+
+			workload := plugin.Workload{Kind: "Deployment", Namespace: "ns", Name: "app"}
+			actual, err := scraper.ScrapWorkload(context.Background(), workload, pods)
+
+			assert.Equal(t, workload, received.Workload)
+			assert.JSONEq(t, `{"queue": "jobs"}`, string(received.Config))
+			if assert.Len(t, received.Pods, 2) {
+				assert.Equal(t, "10.0.0.1", received.Pods[0].IP)
+				assert.Equal(t, map[string]int32{"http": 8080}, received.Pods[0].Ports)
+			}
+			if test.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedResult, actual)
+		})
+	}
+}
+
+func TestPodWorkload(t *testing.T) {
+	controller := true
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		owner    *metav1.OwnerReference
+		expected plugin.Workload
+	}{
+		{
+			name:     "no controller",
+			expected: plugin.Workload{Namespace: "ns"},
+		},
+		{
+			name:   "deployment",
+			labels: map[string]string{"pod-template-hash": "5d4f8c7b9"},
+			owner: &metav1.OwnerReference{
+				Kind:       "ReplicaSet",
+				Name:       "my-app-5d4f8c7b9",
+				Controller: &controller,
+			},
+			expected: plugin.Workload{Kind: "Deployment", Namespace: "ns", Name: "my-app"},
+		},
+		{
+			name: "bare replicaset",
+			owner: &metav1.OwnerReference{
+				Kind:       "ReplicaSet",
+				Name:       "my-app",
+				Controller: &controller,
+			},
+			expected: plugin.Workload{Kind: "ReplicaSet", Namespace: "ns", Name: "my-app"},
+		},
+		{
+			name: "statefulset",
+			owner: &metav1.OwnerReference{
+				Kind:       "StatefulSet",
+				Name:       "my-db",
+				Controller: &controller,
+			},
+			expected: plugin.Workload{Kind: "StatefulSet", Namespace: "ns", Name: "my-db"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "ns",
+					Name:      "pod",
+					Labels:    test.labels,
+				},
+			}
+			if test.owner != nil {
+				pod.OwnerReferences = []metav1.OwnerReference{*test.owner}
+			}
+			assert.Equal(t, test.expected, podWorkload(pod))
+		})
+	}
+}
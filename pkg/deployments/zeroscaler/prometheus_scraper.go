@@ -1,12 +1,18 @@
 package zeroscaler
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
-	"time"
+	"strconv"
+	"sync"
 
 	"github.com/golang/glog"
 	io_prometheus_client "github.com/prometheus/client_model/go"
@@ -21,10 +27,42 @@ const (
 )
 
 type prometheusScraperConfig struct {
-	Port                     int               `json:"port"`
+	// Scheme is either http (the default) or https
+	Scheme string `json:"scheme"`
+	Port   int    `json:"port"`
+	// PortName is the name of a container port, to use instead of Port
+	PortName                 string            `json:"portName"`
 	Path                     string            `json:"path"`
 	RequestCountMetricName   string            `json:"requestCountMetricName"`
 	RequestCountMetricLabels map[string]string `json:"requestCountMetricLabels"`
+	// TLS is the TLS configuration, for the https scheme
+	TLS *prometheusTLSConfig `json:"tls"`
+	// BearerTokenSecret is a reference to a secret key with a bearer token
+	BearerTokenSecret *secretKeyRef `json:"bearerTokenSecret"`
+	// BasicAuthSecret is a reference to a secret with a username and password
+	BasicAuthSecret *basicAuthSecretRef `json:"basicAuthSecret"`
+}
+
+type prometheusTLSConfig struct {
+	// SecretName is the name of a secret in the namespace of the workload,
+	// with the CA certificate and/or the client certificate and key
+	SecretName         string `json:"secretName"`
+	CAKey              string `json:"caKey"`
+	CertKey            string `json:"certKey"`
+	KeyKey             string `json:"keyKey"`
+	ServerName         string `json:"serverName"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+}
+
+type secretKeyRef struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+type basicAuthSecretRef struct {
+	Name        string `json:"name"`
+	UsernameKey string `json:"usernameKey"`
+	PasswordKey string `json:"passwordKey"`
 }
 
 // prometheusScraper is a metrics scraper that scraps metrics exposed by
@@ -34,42 +72,128 @@ type prometheusScraperConfig struct {
 type prometheusScraper struct {
 	httpClient *http.Client
 	config     prometheusScraperConfig
+	secrets    *secretsCache
+	// the HTTP client using the TLS secret, and the version of the secret it
+	// has been built with
+	tlsHTTPClient      *http.Client
+	tlsSecretVersion   string
+	tlsHTTPClientsLock sync.Mutex
 }
 
-func newPrometheusScraper(config metricsScraperConfig) (*prometheusScraper, error) {
+func newPrometheusScraper(
+	config metricsScraperConfig,
+	clients scraperClients,
+) (*prometheusScraper, error) {
 	var cfg prometheusScraperConfig
 	if err := json.Unmarshal(config.Implementation, &cfg); err != nil {
 		return nil, fmt.Errorf("invalid prometheus configuration: %s", err)
 	}
 
 	// check for missing values
-	if cfg.Port == 0 {
+	if cfg.Port == 0 && len(cfg.PortName) == 0 {
 		return nil, errors.New("Prometheus metrics can't be scraped: missing port")
 	}
 	if len(cfg.RequestCountMetricName) == 0 {
 		return nil, errors.New("Prometheus metrics can't be scraped: missing requestCountMetricName")
 	}
+	if cfg.BearerTokenSecret != nil && cfg.BasicAuthSecret != nil {
+		return nil, errors.New("Prometheus metrics can't be scraped: both bearerTokenSecret and basicAuthSecret are set")
+	}
+	if cfg.BearerTokenSecret != nil && len(cfg.BearerTokenSecret.Name) == 0 {
+		return nil, errors.New("Prometheus metrics can't be scraped: missing bearerTokenSecret name")
+	}
+	if cfg.BasicAuthSecret != nil && len(cfg.BasicAuthSecret.Name) == 0 {
+		return nil, errors.New("Prometheus metrics can't be scraped: missing basicAuthSecret name")
+	}
 
 	// default values
+	switch cfg.Scheme {
+	case "":
+		cfg.Scheme = "http"
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("invalid prometheus scheme %s: must be http or https", cfg.Scheme)
+	}
 	if len(cfg.Path) == 0 {
 		cfg.Path = "/metrics"
 	}
+	if cfg.TLS != nil {
+		if len(cfg.TLS.CAKey) == 0 {
+			cfg.TLS.CAKey = "ca.crt"
+		}
+		if len(cfg.TLS.CertKey) == 0 {
+			cfg.TLS.CertKey = corev1.TLSCertKey
+		}
+		if len(cfg.TLS.KeyKey) == 0 {
+			cfg.TLS.KeyKey = corev1.TLSPrivateKeyKey
+		}
+	}
+	if cfg.BearerTokenSecret != nil && len(cfg.BearerTokenSecret.Key) == 0 {
+		cfg.BearerTokenSecret.Key = "token"
+	}
+	if cfg.BasicAuthSecret != nil {
+		if len(cfg.BasicAuthSecret.UsernameKey) == 0 {
+			cfg.BasicAuthSecret.UsernameKey = corev1.BasicAuthUsernameKey
+		}
+		if len(cfg.BasicAuthSecret.PasswordKey) == 0 {
+			cfg.BasicAuthSecret.PasswordKey = corev1.BasicAuthPasswordKey
+		}
+	}
 
-	return &prometheusScraper{
-		config: cfg,
-		// A very aggressive timeout. When collecting metrics, we want to do it very
-		// quickly to minimize the possibility that some pods we've checked on have
-		// served requests while we've been checking on OTHER pods.
-		httpClient: &http.Client{
-			Timeout: 2 * time.Second,
-		},
-	}, nil
+	s := &prometheusScraper{
+		config:  cfg,
+		secrets: newSecretsCache(clients.kubeClient),
+	}
+	var tlsConfig *tls.Config
+	if cfg.TLS != nil {
+		tlsConfig = &tls.Config{
+			ServerName:         cfg.TLS.ServerName,
+			InsecureSkipVerify: cfg.TLS.InsecureSkipVerify, // nolint: gosec
+		}
+	}
+	s.httpClient = newPrometheusHTTPClient(tlsConfig)
+	return s, nil
+}
+
+func newPrometheusHTTPClient(tlsConfig *tls.Config) *http.Client {
+	client := &http.Client{
+		Timeout: scrapeTimeout,
+	}
+	if tlsConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		client.Transport = transport
+	}
+	return client
 }
 
 func (s *prometheusScraper) Scrap(pod *corev1.Pod) *metrics.ProxyRequestCount {
-	target := fmt.Sprintf("http://%s:%d%s", pod.Status.PodIP, s.config.Port, s.config.Path)
+	port, found := s.getPort(pod)
+	if !found {
+		glog.Errorf("Pod %s has no container port named %s", pod.Name, s.config.PortName)
+		return nil
+	}
+	target := fmt.Sprintf(
+		"%s://%s%s",
+		s.config.Scheme,
+		net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(port)),
+		s.config.Path,
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+	req, err := s.newRequest(ctx, pod.Namespace, target)
+	if err != nil {
+		glog.Errorf("Error preparing metrics request to %s: %s", target, err)
+		return nil
+	}
+	httpClient, err := s.getHTTPClient(ctx, pod.Namespace)
+	if err != nil {
+		glog.Errorf("Error preparing TLS configuration for metrics request to %s: %s", target, err)
+		return nil
+	}
 
-	resp, err := s.httpClient.Get(target)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		glog.Errorf("Error requesting metrics from %s: %s", target, err)
 		return nil
@@ -111,6 +235,99 @@ func (s *prometheusScraper) Scrap(pod *corev1.Pod) *metrics.ProxyRequestCount {
 	return nil
 }
 
+// getPort returns the metrics port of the given pod, either from the
+// configured port number or from the configured container port name.
+func (s *prometheusScraper) getPort(pod *corev1.Pod) (int, bool) {
+	if len(s.config.PortName) == 0 {
+		return s.config.Port, true
+	}
+	for _, c := range pod.Spec.Containers {
+		for _, port := range c.Ports {
+			if port.Name == s.config.PortName {
+				return int(port.ContainerPort), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// newRequest returns a new metrics request, with the configured credentials
+func (s *prometheusScraper) newRequest(ctx context.Context, namespace, target string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case s.config.BearerTokenSecret != nil:
+		token, err := s.secrets.getKey(ctx, namespace, s.config.BearerTokenSecret.Name, s.config.BearerTokenSecret.Key)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+string(token))
+	case s.config.BasicAuthSecret != nil:
+		username, err := s.secrets.getKey(ctx, namespace, s.config.BasicAuthSecret.Name, s.config.BasicAuthSecret.UsernameKey)
+		if err != nil {
+			return nil, err
+		}
+		password, err := s.secrets.getKey(ctx, namespace, s.config.BasicAuthSecret.Name, s.config.BasicAuthSecret.PasswordKey)
+		if err != nil {
+			return nil, err
+		}
+		credentials := base64.StdEncoding.EncodeToString([]byte(string(username) + ":" + string(password)))
+		req.Header.Set("Authorization", "Basic "+credentials)
+	}
+	return req, nil
+}
+
+// getHTTPClient returns the HTTP client to use for the metrics requests. If
+// a TLS secret is configured, the client is rebuilt each time the secret
+// changes, and the idle connections of the previous one are closed.
+func (s *prometheusScraper) getHTTPClient(ctx context.Context, namespace string) (*http.Client, error) {
+	if s.config.TLS == nil || len(s.config.TLS.SecretName) == 0 {
+		return s.httpClient, nil
+	}
+	secret, err := s.secrets.get(ctx, namespace, s.config.TLS.SecretName)
+	if err != nil {
+		return nil, err
+	}
+
+	s.tlsHTTPClientsLock.Lock()
+	defer s.tlsHTTPClientsLock.Unlock()
+	if s.tlsHTTPClient != nil && s.tlsSecretVersion == secret.ResourceVersion {
+		return s.tlsHTTPClient, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         s.config.TLS.ServerName,
+		InsecureSkipVerify: s.config.TLS.InsecureSkipVerify, // nolint: gosec
+	}
+	if ca, found := secret.Data[s.config.TLS.CAKey]; found {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("invalid CA certificate in key %s of secret %s", s.config.TLS.CAKey, secret.Name)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	cert, certFound := secret.Data[s.config.TLS.CertKey]
+	key, keyFound := secret.Data[s.config.TLS.KeyKey]
+	if certFound && keyFound {
+		clientCert, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate in secret %s: %s", secret.Name, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+
+	if s.tlsHTTPClient != nil {
+		// the connections of the previous client use the old certificates,
+		// and would otherwise be kept open until the idle timeout
+		s.tlsHTTPClient.CloseIdleConnections()
+	}
+	s.tlsHTTPClient = newPrometheusHTTPClient(tlsConfig)
+	s.tlsSecretVersion = secret.ResourceVersion
+	return s.tlsHTTPClient, nil
+}
+
 // extractPrometheusMetricFamilyValue extracts a value from the given
 // metricFamily if it has a metric that matches the required labels.
 // Prometheus metrics are organized as follow:
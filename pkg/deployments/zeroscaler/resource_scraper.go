@@ -0,0 +1,396 @@
+package zeroscaler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s_types "k8s.io/apimachinery/pkg/types"
+
+	"github.com/dailymotion-oss/osiris/pkg/metrics"
+	"github.com/dailymotion-oss/osiris/pkg/metrics/plugin"
+)
+
+const (
+	resourceScraperName = "resource"
+)
+
+type resourceScraperConfig struct {
+	// CPUThreshold is the CPU usage (for example "10m") above which a pod is
+	// considered active
+	CPUThreshold string `json:"cpuThreshold"`
+	// NetworkBytesThreshold is the number of bytes (received + transmitted)
+	// since the previous scrape above which a pod is considered active.
+	// 0 (the default) disables the network activity check.
+	NetworkBytesThreshold uint64 `json:"networkBytesThreshold"`
+	// Containers are the names of the containers whose CPU usage is checked.
+	// Default to all the containers of the pod.
+	Containers []string `json:"containers"`
+	// CPUSampleInterval is the interval (a golang duration) at which the CPU
+	// usage of the pods is sampled between 2 scrapes. Default to 15s.
+	CPUSampleInterval string `json:"cpuSampleInterval"`
+}
+
+// resourceScraper is a metrics scraper that uses the resources consumption of
+// the pods as an activity signal. It reads the CPU usage of the pods from the
+// metrics.k8s.io API, and optionally their network counters from the kubelet
+// stats. The CPU usage is sampled in the background between 2 scrapes, and
+// each time a pod used more resources than the configured thresholds since
+// the previous scrape, its "request count" is incremented - so that the
+// workload is considered idle once its pods stay under the thresholds for a
+// whole metrics check interval.
+type resourceScraper struct {
+	clients               scraperClients
+	cpuThreshold          resource.Quantity
+	cpuSampleInterval     time.Duration
+	networkBytesThreshold uint64
+	containers            map[string]struct{}
+	// the pods of the workload as of the latest scrape, by pod UID
+	pods map[k8s_types.UID]*corev1.Pod
+	// the pods whose CPU usage was sampled above the threshold since the
+	// previous scrape
+	cpuActivePods map[k8s_types.UID]struct{}
+	// the number of times each pod was found active, by pod UID
+	activityCounts map[k8s_types.UID]uint64
+	// the latest network counter of each pod, by pod UID
+	networkBytes map[k8s_types.UID]uint64
+	lock         sync.Mutex
+	samplingOnce sync.Once
+	// getStatsSummary returns the raw stats summary of the kubelet running on
+	// the given node
+	getStatsSummary func(ctx context.Context, nodeName string) ([]byte, error)
+}
+
+func newResourceScraper(
+	config metricsScraperConfig,
+	clients scraperClients,
+) (*resourceScraper, error) {
+	var cfg resourceScraperConfig
+	if err := json.Unmarshal(config.Implementation, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid resource configuration: %s", err)
+	}
+
+	if len(cfg.CPUThreshold) == 0 {
+		return nil, errors.New("Resource metrics can't be scraped: missing cpuThreshold")
+	}
+	cpuThreshold, err := resource.ParseQuantity(cfg.CPUThreshold)
+	if err != nil {
+		return nil, fmt.Errorf("invalid resource cpuThreshold %s: %s", cfg.CPUThreshold, err)
+	}
+	cpuSampleInterval := 15 * time.Second
+	if len(cfg.CPUSampleInterval) > 0 {
+		cpuSampleInterval, err = time.ParseDuration(cfg.CPUSampleInterval)
+		if err != nil || cpuSampleInterval <= 0 {
+			return nil, fmt.Errorf("invalid resource cpuSampleInterval %s", cfg.CPUSampleInterval)
+		}
+	}
+	if clients.metricsClient == nil {
+		return nil, errors.New("Resource metrics can't be scraped: no metrics client")
+	}
+
+	s := &resourceScraper{
+		clients:               clients,
+		cpuThreshold:          cpuThreshold,
+		cpuSampleInterval:     cpuSampleInterval,
+		networkBytesThreshold: cfg.NetworkBytesThreshold,
+		pods:                  map[k8s_types.UID]*corev1.Pod{},
+		cpuActivePods:         map[k8s_types.UID]struct{}{},
+		activityCounts:        map[k8s_types.UID]uint64{},
+		networkBytes:          map[k8s_types.UID]uint64{},
+	}
+	s.getStatsSummary = s.getKubeletStatsSummary
+	if len(cfg.Containers) > 0 {
+		s.containers = map[string]struct{}{}
+		for _, container := range cfg.Containers {
+			s.containers[container] = struct{}{}
+		}
+	}
+	return s, nil
+}
+
+func (s *resourceScraper) Scrap(pod *corev1.Pod) *metrics.ProxyRequestCount {
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+
+	prc, err := s.scrapPod(ctx, pod, s.getStatsSummaries(ctx, []*corev1.Pod{pod}))
+	if err != nil {
+		glog.Errorf("Error retrieving resource usage of pod %s in namespace %s: %s", pod.Name, pod.Namespace, err)
+		return nil
+	}
+	return prc
+}
+
+// ScrapWorkload scraps all the pods of the workload, and starts sampling
+// their CPU usage until the given context is done.
+func (s *resourceScraper) ScrapWorkload(
+	ctx context.Context,
+	workload plugin.Workload,
+	pods []*corev1.Pod,
+) ([]*metrics.ProxyRequestCount, error) {
+	// the context of a metrics collector is done when the collector stops -
+	// never sample for a context that can't be done
+	if ctx.Done() != nil {
+		s.samplingOnce.Do(func() {
+			go s.sampleCPU(ctx)
+		})
+	}
+	s.setPods(pods)
+
+	scrapeCtx, cancel := context.WithTimeout(ctx, scrapeTimeout)
+	defer cancel()
+	summaries := s.getStatsSummaries(scrapeCtx, pods)
+	var (
+		prcs = make([]*metrics.ProxyRequestCount, len(pods))
+		errs = make([]error, len(pods))
+		wg   sync.WaitGroup
+	)
+	for i, pod := range pods {
+		wg.Add(1)
+		go func(i int, pod *corev1.Pod) {
+			defer wg.Done()
+			prcs[i], errs[i] = s.scrapPod(scrapeCtx, pod, summaries)
+		}(i, pod)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving resource usage of pod %s: %s", pods[i].Name, err)
+		}
+	}
+	return prcs, nil
+}
+
+// setPods updates the pods of the workload, and forgets about the pods which
+// disappeared.
+func (s *resourceScraper) setPods(pods []*corev1.Pod) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.pods = make(map[k8s_types.UID]*corev1.Pod, len(pods))
+	for _, pod := range pods {
+		s.pods[pod.UID] = pod
+	}
+	for uid := range s.activityCounts {
+		if _, found := s.pods[uid]; !found {
+			delete(s.activityCounts, uid)
+		}
+	}
+	for uid := range s.networkBytes {
+		if _, found := s.pods[uid]; !found {
+			delete(s.networkBytes, uid)
+		}
+	}
+	for uid := range s.cpuActivePods {
+		if _, found := s.pods[uid]; !found {
+			delete(s.cpuActivePods, uid)
+		}
+	}
+}
+
+// scrapPod checks if the pod used more resources than the thresholds since
+// the previous scrape, and returns its activity count. The network usage is
+// read from the given stats summaries of the nodes.
+func (s *resourceScraper) scrapPod(
+	ctx context.Context,
+	pod *corev1.Pod,
+	summaries map[string]nodeStatsSummary,
+) (*metrics.ProxyRequestCount, error) {
+	active, err := s.cpuActive(ctx, pod)
+	if err != nil {
+		return nil, fmt.Errorf("CPU usage: %s", err)
+	}
+	if s.networkBytesThreshold > 0 {
+		networkActive, err := s.networkActive(pod, summaries)
+		if err != nil {
+			return nil, fmt.Errorf("network usage: %s", err)
+		}
+		active = active || networkActive
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, sampledActive := s.cpuActivePods[pod.UID]; sampledActive {
+		active = true
+		delete(s.cpuActivePods, pod.UID)
+	}
+	if active {
+		s.activityCounts[pod.UID]++
+	}
+	return &metrics.ProxyRequestCount{
+		ProxyID:      string(pod.UID),
+		RequestCount: s.activityCounts[pod.UID],
+	}, nil
+}
+
+// sampleCPU periodically checks the CPU usage of the pods of the workload
+// until the given context is done, so that a spike of activity between 2
+// scrapes is not missed.
+func (s *resourceScraper) sampleCPU(ctx context.Context) {
+	ticker := time.NewTicker(s.cpuSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.lock.Lock()
+			pods := make([]*corev1.Pod, 0, len(s.pods))
+			for _, pod := range s.pods {
+				pods = append(pods, pod)
+			}
+			s.lock.Unlock()
+			for _, pod := range pods {
+				sampleCtx, cancel := context.WithTimeout(ctx, scrapeTimeout)
+				active, err := s.cpuActive(sampleCtx, pod)
+				cancel()
+				if err != nil {
+					glog.V(2).Infof("Error sampling CPU usage of pod %s in namespace %s: %s", pod.Name, pod.Namespace, err)
+					continue
+				}
+				if !active {
+					continue
+				}
+				s.lock.Lock()
+				if _, found := s.pods[pod.UID]; found {
+					s.cpuActivePods[pod.UID] = struct{}{}
+				}
+				s.lock.Unlock()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// cpuActive checks if the CPU usage of the pod is above the threshold.
+func (s *resourceScraper) cpuActive(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	podMetrics, err := s.clients.metricsClient.MetricsV1beta1().
+		PodMetricses(pod.Namespace).
+		Get(ctx, pod.Name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	usage := resource.Quantity{}
+	for _, container := range podMetrics.Containers {
+		if s.containers != nil {
+			if _, ok := s.containers[container.Name]; !ok {
+				continue
+			}
+		}
+		if cpu, ok := container.Usage[corev1.ResourceCPU]; ok {
+			usage.Add(cpu)
+		}
+	}
+	return usage.Cmp(s.cpuThreshold) > 0, nil
+}
+
+// kubeletStatsSummary is the subset of the kubelet stats summary we need
+type kubeletStatsSummary struct {
+	Pods []struct {
+		PodRef struct {
+			UID string `json:"uid"`
+		} `json:"podRef"`
+		Network *struct {
+			RxBytes *uint64 `json:"rxBytes"`
+			TxBytes *uint64 `json:"txBytes"`
+		} `json:"network"`
+	} `json:"pods"`
+}
+
+// nodeStatsSummary is the result of the retrieval of the stats summary of a
+// node
+type nodeStatsSummary struct {
+	summary *kubeletStatsSummary
+	err     error
+}
+
+// getStatsSummaries retrieves the stats summaries of the nodes running the
+// given pods - once per node, whatever the number of pods it runs - if the
+// network activity is checked.
+func (s *resourceScraper) getStatsSummaries(
+	ctx context.Context,
+	pods []*corev1.Pod,
+) map[string]nodeStatsSummary {
+	summaries := map[string]nodeStatsSummary{}
+	if s.networkBytesThreshold == 0 {
+		return summaries
+	}
+	nodeNames := map[string]struct{}{}
+	for _, pod := range pods {
+		if len(pod.Spec.NodeName) > 0 {
+			nodeNames[pod.Spec.NodeName] = struct{}{}
+		}
+	}
+	var (
+		lock sync.Mutex
+		wg   sync.WaitGroup
+	)
+	for nodeName := range nodeNames {
+		wg.Add(1)
+		go func(nodeName string) {
+			defer wg.Done()
+			var result nodeStatsSummary
+			rawSummary, err := s.getStatsSummary(ctx, nodeName)
+			if err != nil {
+				result.err = err
+			} else {
+				result.summary = &kubeletStatsSummary{}
+				if err := json.Unmarshal(rawSummary, result.summary); err != nil {
+					result.summary, result.err = nil, err
+				}
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			summaries[nodeName] = result
+		}(nodeName)
+	}
+	wg.Wait()
+	return summaries
+}
+
+// getKubeletStatsSummary returns the raw stats summary of the kubelet running
+// on the given node, through the API server proxy.
+func (s *resourceScraper) getKubeletStatsSummary(ctx context.Context, nodeName string) ([]byte, error) {
+	return s.clients.kubeClient.CoreV1().RESTClient().Get().
+		AbsPath("/api/v1/nodes", nodeName, "proxy/stats/summary").
+		DoRaw(ctx)
+}
+
+// networkActive checks if the pod received or transmitted more bytes than the
+// threshold since the previous scrape, using the stats summary of the node
+// running the pod.
+func (s *resourceScraper) networkActive(pod *corev1.Pod, summaries map[string]nodeStatsSummary) (bool, error) {
+	if len(pod.Spec.NodeName) == 0 {
+		return false, errors.New("pod is not scheduled")
+	}
+	nodeSummary, found := summaries[pod.Spec.NodeName]
+	if !found {
+		return false, fmt.Errorf("no stats summary for node %s", pod.Spec.NodeName)
+	}
+	if nodeSummary.err != nil {
+		return false, nodeSummary.err
+	}
+	for _, podStats := range nodeSummary.summary.Pods {
+		if podStats.PodRef.UID != string(pod.UID) || podStats.Network == nil {
+			continue
+		}
+		var bytes uint64
+		if podStats.Network.RxBytes != nil {
+			bytes += *podStats.Network.RxBytes
+		}
+		if podStats.Network.TxBytes != nil {
+			bytes += *podStats.Network.TxBytes
+		}
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		previousBytes, found := s.networkBytes[pod.UID]
+		s.networkBytes[pod.UID] = bytes
+		return found && bytes >= previousBytes &&
+			bytes-previousBytes > s.networkBytesThreshold, nil
+	}
+	return false, fmt.Errorf("no network stats found on node %s", pod.Spec.NodeName)
+}
@@ -0,0 +1,253 @@
+package zeroscaler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8s_testing "k8s.io/client-go/testing"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+
+	"github.com/dailymotion-oss/osiris/pkg/metrics/plugin"
+)
+
+func TestResourceScraper(t *testing.T) {
+	tests := []struct {
+		name           string
+		implementation string
+		usages         map[string]string
+		expectedCount  uint64
+	}{
+		{
+			name:           "cpu usage above the threshold",
+			implementation: `{"cpuThreshold": "10m"}`,
+			usages:         map[string]string{"app": "8m", "sidecar": "5m"},
+			expectedCount:  1,
+		},
+		{
+			name:           "cpu usage below the threshold",
+			implementation: `{"cpuThreshold": "20m"}`,
+			usages:         map[string]string{"app": "8m", "sidecar": "5m"},
+			expectedCount:  0,
+		},
+		{
+			name:           "only the configured containers are checked",
+			implementation: `{"cpuThreshold": "10m", "containers": ["app"]}`,
+			usages:         map[string]string{"app": "8m", "sidecar": "50m"},
+			expectedCount:  0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			podMetrics := &metricsv1beta1.PodMetrics{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod"},
+			}
+			for container, usage := range test.usages {
+				podMetrics.Containers = append(podMetrics.Containers, metricsv1beta1.ContainerMetrics{
+					Name: container,
+					Usage: corev1.ResourceList{
+						corev1.ResourceCPU: resource.MustParse(usage),
+					},
+				})
+			}
+			metricsClient := &metricsfake.Clientset{}
+			// the object tracker of the fake clientset can't find PodMetrics
+			// objects, so we need to return them ourselves
+			metricsClient.AddReactor("get", "pods", func(action k8s_testing.Action) (bool, runtime.Object, error) {
+				return true, podMetrics, nil
+			})
+			scraper, err := newResourceScraper(
+				metricsScraperConfig{
+					ScraperName:    resourceScraperName,
+					Implementation: []byte(test.implementation),
+				},
+				scraperClients{metricsClient: metricsClient},
+			)
+			require.NoError(t, err)
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod", UID: "pod-uid"},
+			}
+			prc := scraper.Scrap(pod)
+			require.NotNil(t, prc)
+			assert.Equal(t, "pod-uid", prc.ProxyID)
+			assert.Equal(t, test.expectedCount, prc.RequestCount)
+
+			// the count is cumulative
+			prc = scraper.Scrap(pod)
+			require.NotNil(t, prc)
+			assert.Equal(t, 2*test.expectedCount, prc.RequestCount)
+		})
+	}
+}
+
+func TestResourceScraperMissingPodMetrics(t *testing.T) {
+	scraper, err := newResourceScraper(
+		metricsScraperConfig{
+			ScraperName:    resourceScraperName,
+			Implementation: []byte(`{"cpuThreshold": "10m"}`),
+		},
+		scraperClients{metricsClient: metricsfake.NewSimpleClientset()},
+	)
+	require.NoError(t, err)
+
+	prc := scraper.Scrap(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod"},
+	})
+	assert.Nil(t, prc)
+}
+
+func TestResourceScraperSamplesBetweenScrapes(t *testing.T) {
+	var (
+		usage     = "50m"
+		usageLock sync.Mutex
+	)
+	setUsage := func(u string) {
+		usageLock.Lock()
+		defer usageLock.Unlock()
+		usage = u
+	}
+	metricsClient := &metricsfake.Clientset{}
+	metricsClient.AddReactor("get", "pods", func(action k8s_testing.Action) (bool, runtime.Object, error) {
+		usageLock.Lock()
+		defer usageLock.Unlock()
+		return true, &metricsv1beta1.PodMetrics{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "ns",
+				Name:      action.(k8s_testing.GetAction).GetName(),
+			},
+			Containers: []metricsv1beta1.ContainerMetrics{{
+				Name:  "app",
+				Usage: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(usage)},
+			}},
+		}, nil
+	})
+	scraper, err := newResourceScraper(
+		metricsScraperConfig{
+			ScraperName:    resourceScraperName,
+			Implementation: []byte(`{"cpuThreshold": "10m", "cpuSampleInterval": "5ms"}`),
+		},
+		scraperClients{metricsClient: metricsClient},
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pod1 := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod1", UID: "uid1"}}
+	pod2 := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod2", UID: "uid2"}}
+
+	prcs, err := scraper.ScrapWorkload(ctx, plugin.Workload{}, []*corev1.Pod{pod1, pod2})
+	require.NoError(t, err)
+	require.Len(t, prcs, 2)
+	assert.Equal(t, uint64(1), prcs[0].RequestCount)
+
+	// a spike between 2 scrapes is still counted as activity
+	time.Sleep(50 * time.Millisecond)
+	setUsage("1m")
+	// let the in-flight samples complete
+	time.Sleep(20 * time.Millisecond)
+	prcs, err = scraper.ScrapWorkload(ctx, plugin.Workload{}, []*corev1.Pod{pod1})
+	require.NoError(t, err)
+	require.Len(t, prcs, 1)
+	assert.Equal(t, uint64(2), prcs[0].RequestCount)
+
+	// the pods which disappeared are forgotten
+	scraper.lock.Lock()
+	assert.NotContains(t, scraper.activityCounts, pod2.UID)
+	assert.NotContains(t, scraper.pods, pod2.UID)
+	scraper.lock.Unlock()
+
+	// and without any new spike, the pods are idle
+	time.Sleep(50 * time.Millisecond)
+	prcs, err = scraper.ScrapWorkload(ctx, plugin.Workload{}, []*corev1.Pod{pod1})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), prcs[0].RequestCount)
+}
+
+func TestResourceScraperNetworkActivity(t *testing.T) {
+	metricsClient := &metricsfake.Clientset{}
+	metricsClient.AddReactor("get", "pods", func(action k8s_testing.Action) (bool, runtime.Object, error) {
+		return true, &metricsv1beta1.PodMetrics{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "ns",
+				Name:      action.(k8s_testing.GetAction).GetName(),
+			},
+		}, nil
+	})
+	scraper, err := newResourceScraper(
+		metricsScraperConfig{
+			ScraperName:    resourceScraperName,
+			Implementation: []byte(`{"cpuThreshold": "10m", "networkBytesThreshold": 100}`),
+		},
+		scraperClients{metricsClient: metricsClient},
+	)
+	require.NoError(t, err)
+
+	var (
+		summaries = map[string]string{
+			"node-a": `{"pods": [
+				{"podRef": {"uid": "uid1"}, "network": {"rxBytes": 1000, "txBytes": 1000}},
+				{"podRef": {"uid": "uid2"}, "network": {"rxBytes": 1000, "txBytes": 1000}}
+			]}`,
+			"node-b": `{"pods": [
+				{"podRef": {"uid": "uid3"}, "network": {"rxBytes": 1000, "txBytes": 1000}}
+			]}`,
+		}
+		summaryRequests     = map[string]int{}
+		summaryRequestsLock sync.Mutex
+	)
+	scraper.getStatsSummary = func(_ context.Context, nodeName string) ([]byte, error) {
+		summaryRequestsLock.Lock()
+		defer summaryRequestsLock.Unlock()
+		summaryRequests[nodeName]++
+		return []byte(summaries[nodeName]), nil
+	}
+	pods := []*corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod1", UID: "uid1"},
+			Spec:       corev1.PodSpec{NodeName: "node-a"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod2", UID: "uid2"},
+			Spec:       corev1.PodSpec{NodeName: "node-a"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod3", UID: "uid3"},
+			Spec:       corev1.PodSpec{NodeName: "node-b"},
+		},
+	}
+
+	// the first scrape only records the network counters
+	prcs, err := scraper.ScrapWorkload(context.Background(), plugin.Workload{}, pods)
+	require.NoError(t, err)
+	for _, prc := range prcs {
+		assert.Equal(t, uint64(0), prc.RequestCount, prc.ProxyID)
+	}
+	// the summary of each node is retrieved once, whatever its number of pods
+	assert.Equal(t, map[string]int{"node-a": 1, "node-b": 1}, summaryRequests)
+
+	summaries["node-a"] = `{"pods": [
+		{"podRef": {"uid": "uid1"}, "network": {"rxBytes": 1500, "txBytes": 1000}},
+		{"podRef": {"uid": "uid2"}, "network": {"rxBytes": 1050, "txBytes": 1000}}
+	]}`
+	prcs, err = scraper.ScrapWorkload(context.Background(), plugin.Workload{}, pods)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), prcs[0].RequestCount)
+	assert.Equal(t, uint64(0), prcs[1].RequestCount)
+	assert.Equal(t, uint64(0), prcs[2].RequestCount)
+	assert.Equal(t, map[string]int{"node-a": 2, "node-b": 2}, summaryRequests)
+
+	// a pod whose node has no stats can't be scraped
+	summaries["node-b"] = `{"pods": []}`
+	_, err = scraper.ScrapWorkload(context.Background(), plugin.Workload{}, pods)
+	assert.Error(t, err)
+}
@@ -0,0 +1,111 @@
+package zeroscaler
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// reasons used by the deployment controller for the Progressing condition
+// see k8s.io/kubernetes/pkg/controller/deployment/util
+const (
+	newReplicaSetReason      = "NewReplicaSetCreated"
+	foundNewReplicaSetReason = "FoundNewReplicaSet"
+	replicaSetUpdatedReason  = "ReplicaSetUpdated"
+)
+
+// deploymentRolloutInProgress checks if the given deployment is paused or
+// is being rolled out - in which case it should not be scaled down. The
+// returned string explains why the rollout is considered in progress.
+// The logic is similar to the one used by "kubectl rollout status".
+func deploymentRolloutInProgress(deployment *appsv1.Deployment) (bool, string) {
+	if deployment.Spec.Paused {
+		return true, "deployment is paused"
+	}
+	if deployment.Status.ObservedGeneration < deployment.Generation {
+		return true, fmt.Sprintf(
+			"generation %d is not observed yet",
+			deployment.Generation,
+		)
+	}
+	var replicas int32 = 1
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	if deployment.Status.UpdatedReplicas < replicas {
+		return true, fmt.Sprintf(
+			"%d out of %d new replicas have been updated",
+			deployment.Status.UpdatedReplicas,
+			replicas,
+		)
+	}
+	if deployment.Status.Replicas > deployment.Status.UpdatedReplicas {
+		return true, fmt.Sprintf(
+			"%d old replicas are pending termination",
+			deployment.Status.Replicas-deployment.Status.UpdatedReplicas,
+		)
+	}
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type != appsv1.DeploymentProgressing {
+			continue
+		}
+		if condition.Status == corev1.ConditionTrue {
+			switch condition.Reason {
+			case newReplicaSetReason, foundNewReplicaSetReason, replicaSetUpdatedReason:
+				return true, fmt.Sprintf(
+					"deployment is progressing: %s",
+					condition.Message,
+				)
+			}
+		}
+		break
+	}
+	return false, ""
+}
+
+// statefulSetRolloutInProgress checks if the given statefulSet is being
+// rolled out - in which case it should not be scaled down. The returned
+// string explains why the rollout is considered in progress.
+// The logic is similar to the one used by "kubectl rollout status".
+func statefulSetRolloutInProgress(statefulSet *appsv1.StatefulSet) (bool, string) {
+	if statefulSet.Status.ObservedGeneration < statefulSet.Generation {
+		return true, fmt.Sprintf(
+			"generation %d is not observed yet",
+			statefulSet.Generation,
+		)
+	}
+	if statefulSet.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+		// with the OnDelete strategy, rollouts are driven by the user
+		return false, ""
+	}
+	var replicas int32 = 1
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+	rollingUpdate := statefulSet.Spec.UpdateStrategy.RollingUpdate
+	if rollingUpdate != nil && rollingUpdate.Partition != nil &&
+		*rollingUpdate.Partition > 0 {
+		// a partitioned update only targets the replicas with an ordinal greater
+		// than or equal to the partition
+		expectedUpdatedReplicas := replicas - *rollingUpdate.Partition
+		if statefulSet.Status.UpdatedReplicas < expectedUpdatedReplicas {
+			return true, fmt.Sprintf(
+				"%d out of %d new replicas have been updated (partition %d)",
+				statefulSet.Status.UpdatedReplicas,
+				expectedUpdatedReplicas,
+				*rollingUpdate.Partition,
+			)
+		}
+		return false, ""
+	}
+	if statefulSet.Status.UpdateRevision != statefulSet.Status.CurrentRevision {
+		return true, fmt.Sprintf(
+			"%d out of %d new replicas have been updated to revision %s",
+			statefulSet.Status.UpdatedReplicas,
+			replicas,
+			statefulSet.Status.UpdateRevision,
+		)
+	}
+	return false, ""
+}
@@ -0,0 +1,289 @@
+package zeroscaler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDeploymentRolloutInProgress(t *testing.T) {
+	var (
+		one int32 = 1
+		two int32 = 2
+	)
+
+	tests := []struct {
+		name           string
+		deployment     *appsv1.Deployment
+		expectedResult bool
+	}{
+		{
+			name: "stable deployment",
+			deployment: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 3},
+				Spec:       appsv1.DeploymentSpec{Replicas: &one},
+				Status: appsv1.DeploymentStatus{
+					ObservedGeneration: 3,
+					Replicas:           1,
+					UpdatedReplicas:    1,
+					AvailableReplicas:  1,
+					Conditions: []appsv1.DeploymentCondition{
+						{
+							Type:   appsv1.DeploymentProgressing,
+							Status: corev1.ConditionTrue,
+							Reason: "NewReplicaSetAvailable",
+						},
+					},
+				},
+			},
+			expectedResult: false,
+		},
+		{
+			name: "paused deployment",
+			deployment: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 3},
+				Spec:       appsv1.DeploymentSpec{Replicas: &one, Paused: true},
+				Status: appsv1.DeploymentStatus{
+					ObservedGeneration: 3,
+					Replicas:           1,
+					UpdatedReplicas:    1,
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			name: "generation not observed yet",
+			deployment: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 4},
+				Spec:       appsv1.DeploymentSpec{Replicas: &one},
+				Status: appsv1.DeploymentStatus{
+					ObservedGeneration: 3,
+					Replicas:           1,
+					UpdatedReplicas:    1,
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			name: "not all replicas updated",
+			deployment: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 3},
+				Spec:       appsv1.DeploymentSpec{Replicas: &two},
+				Status: appsv1.DeploymentStatus{
+					ObservedGeneration: 3,
+					Replicas:           2,
+					UpdatedReplicas:    1,
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			name: "old replicas pending termination",
+			deployment: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 3},
+				Spec:       appsv1.DeploymentSpec{Replicas: &one},
+				Status: appsv1.DeploymentStatus{
+					ObservedGeneration: 3,
+					Replicas:           2,
+					UpdatedReplicas:    1,
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			name: "progressing deployment",
+			deployment: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 3},
+				Spec:       appsv1.DeploymentSpec{Replicas: &one},
+				Status: appsv1.DeploymentStatus{
+					ObservedGeneration: 3,
+					Replicas:           1,
+					UpdatedReplicas:    1,
+					Conditions: []appsv1.DeploymentCondition{
+						{
+							Type:   appsv1.DeploymentProgressing,
+							Status: corev1.ConditionTrue,
+							Reason: replicaSetUpdatedReason,
+						},
+					},
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			name: "rollout exceeded its progress deadline",
+			deployment: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 3},
+				Spec:       appsv1.DeploymentSpec{Replicas: &one},
+				Status: appsv1.DeploymentStatus{
+					ObservedGeneration: 3,
+					Replicas:           1,
+					UpdatedReplicas:    1,
+					Conditions: []appsv1.DeploymentCondition{
+						{
+							Type:   appsv1.DeploymentProgressing,
+							Status: corev1.ConditionFalse,
+							Reason: "ProgressDeadlineExceeded",
+						},
+					},
+				},
+			},
+			expectedResult: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, _ := deploymentRolloutInProgress(test.deployment)
+
+			assert.Equal(t, test.expectedResult, actual)
+		})
+	}
+}
+
+func TestStatefulSetRolloutInProgress(t *testing.T) {
+	var (
+		zero  int32 = 0
+		two   int32 = 2
+		three int32 = 3
+	)
+
+	tests := []struct {
+		name           string
+		statefulSet    *appsv1.StatefulSet
+		expectedResult bool
+	}{
+		{
+			name: "stable statefulset",
+			statefulSet: &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec: appsv1.StatefulSetSpec{
+					Replicas: &three,
+					UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+						Type: appsv1.RollingUpdateStatefulSetStrategyType,
+					},
+				},
+				Status: appsv1.StatefulSetStatus{
+					ObservedGeneration: 2,
+					UpdatedReplicas:    3,
+					CurrentRevision:    "rev-2",
+					UpdateRevision:     "rev-2",
+				},
+			},
+			expectedResult: false,
+		},
+		{
+			name: "generation not observed yet",
+			statefulSet: &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 3},
+				Spec: appsv1.StatefulSetSpec{
+					Replicas: &three,
+					UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+						Type: appsv1.RollingUpdateStatefulSetStrategyType,
+					},
+				},
+				Status: appsv1.StatefulSetStatus{
+					ObservedGeneration: 2,
+					CurrentRevision:    "rev-2",
+					UpdateRevision:     "rev-2",
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			name: "rolling update in progress",
+			statefulSet: &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 3},
+				Spec: appsv1.StatefulSetSpec{
+					Replicas: &three,
+					UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+						Type: appsv1.RollingUpdateStatefulSetStrategyType,
+						RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{
+							Partition: &zero,
+						},
+					},
+				},
+				Status: appsv1.StatefulSetStatus{
+					ObservedGeneration: 3,
+					UpdatedReplicas:    1,
+					CurrentRevision:    "rev-2",
+					UpdateRevision:     "rev-3",
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			name: "partitioned update in progress",
+			statefulSet: &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 3},
+				Spec: appsv1.StatefulSetSpec{
+					Replicas: &three,
+					UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+						Type: appsv1.RollingUpdateStatefulSetStrategyType,
+						RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{
+							Partition: &two,
+						},
+					},
+				},
+				Status: appsv1.StatefulSetStatus{
+					ObservedGeneration: 3,
+					UpdatedReplicas:    0,
+					CurrentRevision:    "rev-2",
+					UpdateRevision:     "rev-3",
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			name: "partitioned update complete",
+			statefulSet: &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 3},
+				Spec: appsv1.StatefulSetSpec{
+					Replicas: &three,
+					UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+						Type: appsv1.RollingUpdateStatefulSetStrategyType,
+						RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{
+							Partition: &two,
+						},
+					},
+				},
+				Status: appsv1.StatefulSetStatus{
+					ObservedGeneration: 3,
+					UpdatedReplicas:    1,
+					CurrentRevision:    "rev-2",
+					UpdateRevision:     "rev-3",
+				},
+			},
+			expectedResult: false,
+		},
+		{
+			name: "on delete strategy",
+			statefulSet: &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 3},
+				Spec: appsv1.StatefulSetSpec{
+					Replicas: &three,
+					UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+						Type: appsv1.OnDeleteStatefulSetStrategyType,
+					},
+				},
+				Status: appsv1.StatefulSetStatus{
+					ObservedGeneration: 3,
+					CurrentRevision:    "rev-2",
+					UpdateRevision:     "rev-3",
+				},
+			},
+			expectedResult: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, _ := statefulSetRolloutInProgress(test.statefulSet)
+
+			assert.Equal(t, test.expectedResult, actual)
+		})
+	}
+}
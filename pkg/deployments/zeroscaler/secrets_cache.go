@@ -0,0 +1,72 @@
+package zeroscaler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// secretsCacheTTL is how long a secret is cached before being retrieved
+// again - so that rotated credentials are eventually used.
+const secretsCacheTTL = time.Minute
+
+type cachedSecret struct {
+	secret    *corev1.Secret
+	expiresAt time.Time
+}
+
+// secretsCache is a small cache of secrets, to avoid retrieving the same
+// secrets on each metrics check. We don't use an informer here, because
+// watching all the secrets of the cluster would be way too expensive for the
+// few we need.
+type secretsCache struct {
+	kubeClient kubernetes.Interface
+	secrets    map[string]cachedSecret
+	lock       sync.Mutex
+}
+
+func newSecretsCache(kubeClient kubernetes.Interface) *secretsCache {
+	return &secretsCache{
+		kubeClient: kubeClient,
+		secrets:    map[string]cachedSecret{},
+	}
+}
+
+func (c *secretsCache) get(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if cached, found := c.secrets[key]; found && time.Now().Before(cached.expiresAt) {
+		return cached.secret, nil
+	}
+	if c.kubeClient == nil {
+		return nil, fmt.Errorf("can't retrieve secret %s: no kubernetes client", key)
+	}
+	secret, err := c.kubeClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	c.secrets[key] = cachedSecret{
+		secret:    secret,
+		expiresAt: time.Now().Add(secretsCacheTTL),
+	}
+	return secret, nil
+}
+
+// getKey returns the value of the given key of the given secret
+func (c *secretsCache) getKey(ctx context.Context, namespace, name, key string) ([]byte, error) {
+	secret, err := c.get(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	value, found := secret.Data[key]
+	if !found {
+		return nil, fmt.Errorf("key %s not found in secret %s in namespace %s", key, name, namespace)
+	}
+	return value, nil
+}
@@ -0,0 +1,147 @@
+package zeroscaler
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// collectorStatus is the state of a metrics collector, as served by the
+// zeroscaler status API
+type collectorStatus struct {
+	Kind                 string               `json:"kind"`
+	Namespace            string               `json:"namespace"`
+	Name                 string               `json:"name"`
+	Collector            metricsScraperConfig `json:"collector"`
+	MetricsCheckInterval string               `json:"metricsCheckInterval"`
+	// LastScrapeTime is the time of the latest metrics check, if any
+	LastScrapeTime *time.Time `json:"lastScrapeTime,omitempty"`
+	// Pods are the results of the latest metrics check
+	Pods              []scrapeResult `json:"pods"`
+	TotalRequestCount uint64         `json:"totalRequestCount"`
+	LastActivityTime  time.Time      `json:"lastActivityTime"`
+	// IdleSince is set if no activity was observed during the latest metrics
+	// check
+	IdleSince        *time.Time `json:"idleSince,omitempty"`
+	NextDecisionTime time.Time  `json:"nextDecisionTime"`
+	// PausedUntil is set if the workload is paused: its metrics are not
+	// collected until then
+	PausedUntil *time.Time `json:"pausedUntil,omitempty"`
+	// Frozen is true if Osiris is frozen - cluster-wide or in the workload's
+	// namespace: the workload won't be scaled down until it is unfrozen
+	Frozen bool `json:"frozen"`
+}
+
+// scrapeResult is the result of the scraping of a single pod - or of a whole
+// workload, for the scrapers that don't report per-pod results.
+type scrapeResult struct {
+	Pod          string  `json:"pod,omitempty"`
+	ProxyID      string  `json:"proxyId,omitempty"`
+	RequestCount *uint64 `json:"requestCount,omitempty"`
+	Error        string  `json:"error,omitempty"`
+}
+
+func (m *metricsCollector) getStatus() collectorStatus {
+	m.statusLock.RLock()
+	defer m.statusLock.RUnlock()
+	status := collectorStatus{
+		Kind:                 m.config.appKind,
+		Namespace:            m.config.appNamespace,
+		Name:                 m.config.appName,
+		Collector:            m.config.scraperConfig,
+		MetricsCheckInterval: m.config.metricsCheckInterval.String(),
+		Pods:                 append([]scrapeResult{}, m.lastScrapeResults...),
+		TotalRequestCount:    m.lastTotalRequestCount,
+		LastActivityTime:     m.getLastActivityTime(),
+		NextDecisionTime:     m.startTime.Add(m.config.metricsCheckInterval),
+	}
+	if !m.lastScrapeTime.IsZero() {
+		lastScrapeTime := m.lastScrapeTime
+		status.LastScrapeTime = &lastScrapeTime
+		status.NextDecisionTime = lastScrapeTime.Add(m.config.metricsCheckInterval)
+		if m.idle {
+			idleSince := status.LastActivityTime
+			status.IdleSince = &idleSince
+		}
+	}
+	return status
+}
+
+func (m *metricsCollector) setScrapeStatus(
+	scrapeTime time.Time,
+	results []scrapeResult,
+	totalRequestCount uint64,
+	idle bool,
+) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Pod != results[j].Pod {
+			return results[i].Pod < results[j].Pod
+		}
+		return results[i].ProxyID < results[j].ProxyID
+	})
+	m.statusLock.Lock()
+	defer m.statusLock.Unlock()
+	m.lastScrapeTime = scrapeTime
+	m.scrapeCount++
+	m.lastScrapeResults = results
+	m.lastTotalRequestCount = totalRequestCount
+	m.idle = idle
+}
+
+// pausedWorkloadStatus returns the status of a paused workload, which has no
+// metrics collector until the end of its pause
+func pausedWorkloadStatus(key string, pausedUntil time.Time) collectorStatus {
+	var kind, namespace, name string
+	if elems := strings.SplitN(key, ":", 2); len(elems) == 2 {
+		kind = elems[0]
+		if elems = strings.SplitN(elems[1], "/", 2); len(elems) == 2 {
+			namespace, name = elems[0], elems[1]
+		}
+	}
+	return collectorStatus{
+		Kind:             kind,
+		Namespace:        namespace,
+		Name:             name,
+		Pods:             []scrapeResult{},
+		NextDecisionTime: pausedUntil,
+		PausedUntil:      &pausedUntil,
+	}
+}
+
+func (z *zeroscaler) handleCollectorsStatusRequest(w http.ResponseWriter, _ *http.Request) {
+	z.collectorsLock.Lock()
+	statuses := make([]collectorStatus, 0, len(z.collectors))
+	for _, collector := range z.collectors {
+		statuses = append(statuses, collector.getStatus())
+	}
+	for key, pausedUntil := range z.pauses {
+		statuses = append(statuses, pausedWorkloadStatus(key, pausedUntil))
+	}
+	z.collectorsLock.Unlock()
+	controlState := z.controlWatcher.State()
+	for i := range statuses {
+		statuses[i].Frozen = controlState.IsFrozen(statuses[i].Namespace)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return getKey(statuses[i].Kind, statuses[i].Namespace, statuses[i].Name) <
+			getKey(statuses[j].Kind, statuses[j].Namespace, statuses[j].Name)
+	})
+	writeJSONResponse(w, statuses)
+}
+
+func (z *zeroscaler) handleDecisionsRequest(w http.ResponseWriter, _ *http.Request) {
+	writeJSONResponse(w, z.auditLog.list())
+}
+
+func writeJSONResponse(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(body); err != nil {
+		glog.Errorf("Error encoding response in json: %s", err)
+	}
+}
@@ -0,0 +1,104 @@
+package zeroscaler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dailymotion-oss/osiris/pkg/control"
+)
+
+func TestCollectorStatus(t *testing.T) {
+	var (
+		startTime        = time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+		lastActivityTime = startTime.Add(time.Minute)
+		scrapeTime       = startTime.Add(2 * time.Minute)
+		requestCount     = uint64(3)
+	)
+	collector := &metricsCollector{
+		config: metricsCollectorConfig{
+			appKind:              "Deployment",
+			appNamespace:         "ns",
+			appName:              "app",
+			metricsCheckInterval: time.Minute,
+			scraperConfig:        metricsScraperConfig{ScraperName: osirisScraperName},
+		},
+		startTime:        startTime,
+		lastActivityTime: lastActivityTime,
+	}
+
+	// no scrape yet
+	status := collector.getStatus()
+	assert.Nil(t, status.LastScrapeTime)
+	assert.Nil(t, status.IdleSince)
+	assert.Equal(t, startTime.Add(time.Minute), status.NextDecisionTime)
+	assert.Equal(t, "1m0s", status.MetricsCheckInterval)
+
+	// idle
+	collector.setScrapeStatus(scrapeTime, []scrapeResult{
+		{Pod: "pod-b", Error: "some error"},
+		{Pod: "pod-a", ProxyID: "proxy-a", RequestCount: &requestCount},
+	}, 3, true)
+	status = collector.getStatus()
+	assert.Equal(t, &scrapeTime, status.LastScrapeTime)
+	assert.Equal(t, &lastActivityTime, status.IdleSince)
+	assert.Equal(t, scrapeTime.Add(time.Minute), status.NextDecisionTime)
+	assert.Equal(t, uint64(3), status.TotalRequestCount)
+	assert.Equal(t, []scrapeResult{
+		{Pod: "pod-a", ProxyID: "proxy-a", RequestCount: &requestCount},
+		{Pod: "pod-b", Error: "some error"},
+	}, status.Pods)
+
+	// active
+	collector.setScrapeStatus(scrapeTime, nil, 4, false)
+	status = collector.getStatus()
+	assert.Nil(t, status.IdleSince)
+}
+
+func TestPausedWorkloadStatus(t *testing.T) {
+	pausedUntil := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	status := pausedWorkloadStatus(getKey("StatefulSet", "ns", "app"), pausedUntil)
+	assert.Equal(t, "StatefulSet", status.Kind)
+	assert.Equal(t, "ns", status.Namespace)
+	assert.Equal(t, "app", status.Name)
+	assert.Equal(t, &pausedUntil, status.PausedUntil)
+	assert.Equal(t, pausedUntil, status.NextDecisionTime)
+	assert.Empty(t, status.Pods)
+}
+
+func TestCollectorsStatusFrozen(t *testing.T) {
+	pausedUntil := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	z := &zeroscaler{
+		collectors: map[string]*metricsCollector{
+			getKey("Deployment", "frozen-ns", "app"): {
+				config: metricsCollectorConfig{
+					appKind:      "Deployment",
+					appNamespace: "frozen-ns",
+					appName:      "app",
+				},
+			},
+		},
+		pauses: map[string]time.Time{
+			getKey("StatefulSet", "ns", "app"): pausedUntil,
+		},
+		controlWatcher: staticWatcher{
+			state: control.State{FrozenNamespaces: []string{"frozen-ns"}},
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	z.handleCollectorsStatusRequest(rec, httptest.NewRequest("GET", "/collectors", nil))
+
+	var statuses []collectorStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &statuses))
+	require.Len(t, statuses, 2)
+	assert.Equal(t, "frozen-ns", statuses[0].Namespace)
+	assert.True(t, statuses[0].Frozen)
+	assert.Equal(t, "ns", statuses[1].Namespace)
+	assert.False(t, statuses[1].Frozen)
+}
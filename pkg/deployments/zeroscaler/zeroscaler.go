@@ -4,18 +4,26 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"reflect"
 	"strconv"
 	"sync"
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	k8s_types "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	metricsclientset "k8s.io/metrics/pkg/client/clientset/versioned"
 
+	"github.com/dailymotion-oss/osiris/pkg/control"
 	"github.com/dailymotion-oss/osiris/pkg/healthz"
 	k8s "github.com/dailymotion-oss/osiris/pkg/kubernetes"
 )
@@ -27,17 +35,42 @@ type Zeroscaler interface {
 type zeroscaler struct {
 	cfg                  Config
 	kubeClient           kubernetes.Interface
+	metricsClient        metricsclientset.Interface
+	restConfig           *rest.Config
 	deploymentsInformer  cache.SharedInformer
 	statefulSetsInformer cache.SharedInformer
-	collectors           map[string]*metricsCollector
-	collectorsLock       sync.Mutex
-	ctx                  context.Context
+	daemonSetsInformer   cache.SharedInformer
+	namespacesInformer   cache.SharedInformer
+	// the HPAs, indexed by target, so that the workloads scaled by an HPA are
+	// not paused when scaled up
+	hpasInformer cache.SharedIndexInformer
+	collectors   map[string]*metricsCollector
+	// the end of the pause of the paused workloads, by key
+	pauses map[string]time.Time
+	// the pauses of the workloads manually scaled while Osiris is frozen -
+	// which can't be recorded in their annotations - by workload UID
+	frozenPauses     map[k8s_types.UID]frozenPause
+	collectorsLock   sync.Mutex
+	resyncTimers     map[string]*time.Timer
+	resyncTimersLock sync.Mutex
+	recorder         record.EventRecorder
+	controlWatcher   control.Watcher
+	auditLog         *auditLog
+	ctx              context.Context
 }
 
-func NewZeroscaler(cfg Config, kubeClient kubernetes.Interface) Zeroscaler {
+func NewZeroscaler(
+	cfg Config,
+	controlCfg control.Config,
+	kubeClient kubernetes.Interface,
+	metricsClient metricsclientset.Interface,
+	restConfig *rest.Config,
+) Zeroscaler {
 	z := &zeroscaler{
-		cfg:        cfg,
-		kubeClient: kubeClient,
+		cfg:           cfg,
+		kubeClient:    kubeClient,
+		metricsClient: metricsClient,
+		restConfig:    restConfig,
 		deploymentsInformer: k8s.DeploymentsIndexInformer(
 			kubeClient,
 			metav1.NamespaceAll,
@@ -52,7 +85,41 @@ func NewZeroscaler(cfg Config, kubeClient kubernetes.Interface) Zeroscaler {
 			nil,
 			cfg.ResyncInterval,
 		),
-		collectors: map[string]*metricsCollector{},
+		daemonSetsInformer: k8s.DaemonSetsIndexInformer(
+			kubeClient,
+			metav1.NamespaceAll,
+			nil,
+			nil,
+			cfg.ResyncInterval,
+		),
+		namespacesInformer: k8s.NamespacesIndexInformer(
+			kubeClient,
+			nil,
+			nil,
+			cfg.ResyncInterval,
+		),
+		hpasInformer: k8s.HorizontalPodAutoscalersIndexInformer(
+			kubeClient,
+			metav1.NamespaceAll,
+			nil,
+			nil,
+			cfg.ResyncInterval,
+		),
+		collectors:   map[string]*metricsCollector{},
+		pauses:       map[string]time.Time{},
+		frozenPauses: map[k8s_types.UID]frozenPause{},
+		resyncTimers: map[string]*time.Timer{},
+		recorder:     k8s.EventRecorder(kubeClient, "osiris-zeroscaler"),
+		auditLog:     newAuditLog(cfg.AuditLogSize),
+	}
+	z.controlWatcher = control.NewWatcher(controlCfg, kubeClient, z.recorder)
+	if err := z.hpasInformer.AddIndexers(cache.Indexers{
+		hpaTargetIndexName: hpaTargetIndexFunc,
+	}); err != nil {
+		glog.Errorf("Error indexing the HPAs by target: %s", err)
+	}
+	if err := prometheus.Register(zeroscalerMetricsCollector{z: z}); err != nil {
+		glog.Errorf("Error registering zeroscaler metrics: %s", err)
 	}
 	z.deploymentsInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: z.syncDeployment,
@@ -68,10 +135,24 @@ func NewZeroscaler(cfg Config, kubeClient kubernetes.Interface) Zeroscaler {
 		},
 		DeleteFunc: z.syncDeletedStatefulSet,
 	})
+	z.daemonSetsInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: z.syncDaemonSet,
+		UpdateFunc: func(_, newObj interface{}) {
+			z.syncDaemonSet(newObj)
+		},
+		DeleteFunc: z.syncDeletedDaemonSet,
+	})
+	z.namespacesInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: z.syncNamespace,
+		UpdateFunc: func(_, newObj interface{}) {
+			z.syncNamespace(newObj)
+		},
+	})
 	return z
 }
 
-// Run causes the controller to collect metrics for Osiris-enabled deployments and statefulsets.
+// Run causes the controller to collect metrics for Osiris-enabled deployments,
+// statefulsets and daemonsets.
 func (z *zeroscaler) Run(ctx context.Context) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -89,7 +170,27 @@ func (z *zeroscaler) Run(ctx context.Context) {
 		z.statefulSetsInformer.Run(ctx.Done())
 		cancel()
 	}()
-	healthz.RunServer(ctx, 5000)
+	go func() {
+		z.daemonSetsInformer.Run(ctx.Done())
+		cancel()
+	}()
+	go func() {
+		z.namespacesInformer.Run(ctx.Done())
+		cancel()
+	}()
+	go func() {
+		z.hpasInformer.Run(ctx.Done())
+		cancel()
+	}()
+	go func() {
+		z.controlWatcher.Run(ctx)
+		cancel()
+	}()
+	healthz.RunServerWithHandlers(ctx, 5000, map[string]http.HandlerFunc{
+		"/collectors": z.handleCollectorsStatusRequest,
+		"/decisions":  z.handleDecisionsRequest,
+		"/metrics":    promhttp.Handler().ServeHTTP,
+	})
 	cancel()
 }
 
@@ -102,6 +203,27 @@ func (z *zeroscaler) syncDeployment(obj interface{}) {
 			deployment.Name,
 			deployment.Namespace,
 		)
+		if pausedUntil, manualScaling, paused := z.pausedUntil("Deployment", deployment, deployment.Spec.Replicas); paused {
+			z.pause("Deployment", deployment, deployment.Spec.Replicas, pausedUntil, manualScaling)
+			return
+		}
+		z.ensureScaledReplicasBaseline("Deployment", deployment, deployment.Spec.Replicas)
+		if inProgress, reason := deploymentRolloutInProgress(deployment); inProgress {
+			glog.Infof(
+				"Osiris-enabled deployment %s in namespace %s is being rolled out (%s); "+
+					"ensuring NO metrics collection until the rollout is complete",
+				deployment.Name,
+				deployment.Namespace,
+				reason,
+			)
+			z.ensureNoMetricsCollection(
+				"Deployment",
+				deployment.Namespace,
+				deployment.Name,
+				"rollout in progress: "+reason,
+			)
+			return
+		}
 		minReplicas := k8s.GetMinReplicas(deployment.Annotations, 1)
 		if *deployment.Spec.Replicas > 0 &&
 			deployment.Status.AvailableReplicas <= minReplicas {
@@ -118,6 +240,7 @@ func (z *zeroscaler) syncDeployment(obj interface{}) {
 				deployment.Annotations,
 				deployment.Spec.Selector,
 			)
+			z.enforceActiveWorkloadsBudget(deployment.Namespace)
 		} else {
 			glog.Infof(
 				"Osiris-enabled deployment %s in namespace %s is running zero "+
@@ -130,7 +253,10 @@ func (z *zeroscaler) syncDeployment(obj interface{}) {
 				"Deployment",
 				deployment.Namespace,
 				deployment.Name,
+				"running zero replicas or more than the minimum number of replicas",
 			)
+			// the busier workloads count against the budget too
+			z.enforceActiveWorkloadsBudget(deployment.Namespace)
 		}
 	} else {
 		glog.Infof(
@@ -143,6 +269,7 @@ func (z *zeroscaler) syncDeployment(obj interface{}) {
 			"Deployment",
 			deployment.Namespace,
 			deployment.Name,
+			"not Osiris-enabled",
 		)
 	}
 }
@@ -156,6 +283,27 @@ func (z *zeroscaler) syncStatefulSet(obj interface{}) {
 			statefulSet.Name,
 			statefulSet.Namespace,
 		)
+		if pausedUntil, manualScaling, paused := z.pausedUntil("StatefulSet", statefulSet, statefulSet.Spec.Replicas); paused {
+			z.pause("StatefulSet", statefulSet, statefulSet.Spec.Replicas, pausedUntil, manualScaling)
+			return
+		}
+		z.ensureScaledReplicasBaseline("StatefulSet", statefulSet, statefulSet.Spec.Replicas)
+		if inProgress, reason := statefulSetRolloutInProgress(statefulSet); inProgress {
+			glog.Infof(
+				"Osiris-enabled statefulSet %s in namespace %s is being rolled out (%s); "+
+					"ensuring NO metrics collection until the rollout is complete",
+				statefulSet.Name,
+				statefulSet.Namespace,
+				reason,
+			)
+			z.ensureNoMetricsCollection(
+				"StatefulSet",
+				statefulSet.Namespace,
+				statefulSet.Name,
+				"rollout in progress: "+reason,
+			)
+			return
+		}
 		minReplicas := k8s.GetMinReplicas(statefulSet.Annotations, 1)
 		if *statefulSet.Spec.Replicas > 0 &&
 			statefulSet.Status.ReadyReplicas <= minReplicas {
@@ -172,6 +320,7 @@ func (z *zeroscaler) syncStatefulSet(obj interface{}) {
 				statefulSet.Annotations,
 				statefulSet.Spec.Selector,
 			)
+			z.enforceActiveWorkloadsBudget(statefulSet.Namespace)
 		} else {
 			glog.Infof(
 				"Osiris-enabled statefulSet %s in namespace %s is running zero "+
@@ -184,7 +333,10 @@ func (z *zeroscaler) syncStatefulSet(obj interface{}) {
 				"StatefulSet",
 				statefulSet.Namespace,
 				statefulSet.Name,
+				"running zero replicas or more than the minimum number of replicas",
 			)
+			// the busier workloads count against the budget too
+			z.enforceActiveWorkloadsBudget(statefulSet.Namespace)
 		}
 	} else {
 		glog.Infof(
@@ -197,6 +349,7 @@ func (z *zeroscaler) syncStatefulSet(obj interface{}) {
 			"StatefulSet",
 			statefulSet.Namespace,
 			statefulSet.Name,
+			"not Osiris-enabled",
 		)
 	}
 }
@@ -213,7 +366,9 @@ func (z *zeroscaler) syncDeletedDeployment(obj interface{}) {
 		"Deployment",
 		deployment.Namespace,
 		deployment.Name,
+		"deleted",
 	)
+	z.forgetFrozenPause(deployment.UID)
 }
 
 func (z *zeroscaler) syncDeletedStatefulSet(obj interface{}) {
@@ -228,7 +383,9 @@ func (z *zeroscaler) syncDeletedStatefulSet(obj interface{}) {
 		"StatefulSet",
 		statefulSet.Namespace,
 		statefulSet.Name,
+		"deleted",
 	)
+	z.forgetFrozenPause(statefulSet.UID)
 }
 
 func (z *zeroscaler) ensureMetricsCollection(kind, namespace, name string,
@@ -236,6 +393,7 @@ func (z *zeroscaler) ensureMetricsCollection(kind, namespace, name string,
 	z.collectorsLock.Lock()
 	defer z.collectorsLock.Unlock()
 	key := getKey(kind, namespace, name)
+	delete(z.pauses, key)
 	config := metricsCollectorConfig{
 		appKind:                 kind,
 		appName:                 name,
@@ -258,7 +416,19 @@ func (z *zeroscaler) ensureMetricsCollection(kind, namespace, name string,
 			namespace,
 			config.metricsCheckInterval.String(),
 		)
-		collector, err := newMetricsCollector(z.kubeClient, config)
+		collector, err := newMetricsCollector(
+			scraperClients{
+				kubeClient:    z.kubeClient,
+				metricsClient: z.metricsClient,
+				restConfig:    z.restConfig,
+			},
+			z.controlWatcher,
+			z.auditLog,
+			func(depKind, depNamespace, depName string) bool {
+				return z.dependencyInUse([]string{key}, depKind, depNamespace, depName)
+			},
+			config,
+		)
 		if err != nil {
 			glog.Errorf(
 				"Metrics collector for %s %s in namespace %s can't run; "+
@@ -289,16 +459,28 @@ func (z *zeroscaler) ensureMetricsCollection(kind, namespace, name string,
 	)
 }
 
-func (z *zeroscaler) ensureNoMetricsCollection(kind, namespace, name string) {
+func (z *zeroscaler) ensureNoMetricsCollection(kind, namespace, name, reason string) {
 	z.collectorsLock.Lock()
 	defer z.collectorsLock.Unlock()
 	key := getKey(kind, namespace, name)
+	delete(z.pauses, key)
 	if collector, ok := z.collectors[key]; ok {
 		collector.stop()
 		delete(z.collectors, key)
+		z.auditLog.record(kind, namespace, name, decisionCollectionStopped, reason)
 	}
 }
 
+// ensurePausedMetricsCollection ensures no metrics collection for the given
+// workload until the end of its pause, and keeps track of the pause for the
+// status API.
+func (z *zeroscaler) ensurePausedMetricsCollection(kind, namespace, name string, pausedUntil time.Time) {
+	z.ensureNoMetricsCollection(kind, namespace, name, "paused")
+	z.collectorsLock.Lock()
+	defer z.collectorsLock.Unlock()
+	z.pauses[getKey(kind, namespace, name)] = pausedUntil
+}
+
 func getMetricsScraperConfig(
 	kind string,
 	name string,
@@ -121,6 +121,7 @@ func (c *controller) Run(ctx context.Context) {
 // be prevented for non-Osiris-enabled services.
 func (c *controller) syncAppService(obj interface{}) {
 	svc := obj.(*corev1.Service)
+	defer c.resyncTCPServicesEndpoints(svc, c.managedServiceHasTCPPorts(svc))
 	if k8s.ServiceIsEligibleForEndpointsManagement(svc.Annotations) {
 		glog.Infof(
 			"Notified about new or updated Osiris-enabled service %s in namespace %s",
@@ -149,7 +150,9 @@ func (c *controller) syncDeletedAppService(obj interface{}) {
 		svc.Name,
 		svc.Namespace,
 	)
+	hadTCPPorts := c.managedServiceHasTCPPorts(svc)
 	c.ensureServiceEndpointsNotManaged(svc)
+	c.resyncTCPServicesEndpoints(svc, hadTCPPorts)
 }
 
 // ensureServiceEndpointsManaged guarantees ongoing management of the specified
@@ -237,6 +240,54 @@ func (c *controller) syncActivatorPod(obj interface{}) {
 	}
 }
 
+// activatorTCPPortAssignments returns the activator TCP listener ports of the
+// raw TCP ports of all the services - the same ones as the activator's.
+func (c *controller) activatorTCPPortAssignments() map[string]int32 {
+	objs := c.servicesInformer.GetStore().List()
+	services := make([]*corev1.Service, 0, len(objs))
+	for _, obj := range objs {
+		services = append(services, obj.(*corev1.Service))
+	}
+	return k8s.AssignActivatorTCPPorts(services)
+}
+
+// managedServiceHasTCPPorts checks if the managed version of the given service
+// - before its update or deletion - has raw TCP ports.
+func (c *controller) managedServiceHasTCPPorts(svc *corev1.Service) bool {
+	c.managersLock.RLock()
+	defer c.managersLock.RUnlock()
+	mgr, ok := c.managers[getServiceKey(svc)]
+	return ok && k8s.ServiceHasTCPPorts(mgr.service.Annotations)
+}
+
+// resyncTCPServicesEndpoints refreshes the endpoints of the other services
+// with raw TCP ports, when a change to a service with raw TCP ports - before
+// or after the change - may have changed the activator TCP ports assigned to
+// them.
+func (c *controller) resyncTCPServicesEndpoints(
+	svc *corev1.Service,
+	hadTCPPorts bool,
+) {
+	if !hadTCPPorts && !k8s.ServiceHasTCPPorts(svc.Annotations) {
+		return
+	}
+	c.readyActivatorPodsLock.Lock()
+	defer c.readyActivatorPodsLock.Unlock()
+	c.managersLock.RLock()
+	defer c.managersLock.RUnlock()
+	for key, mgr := range c.managers {
+		if key == getServiceKey(svc) ||
+			!k8s.ServiceHasTCPPorts(mgr.service.Annotations) {
+			continue
+		}
+		func() {
+			mgr.readyAppPodsLock.Lock()
+			defer mgr.readyAppPodsLock.Unlock()
+			mgr.syncEndpoints()
+		}()
+	}
+}
+
 // getServiceKey concatenates a service's namespace and name to form a key that
 // is a suitably unique identifier for use as a key in a map of services to
 // the managers that are minding each service's corresponding endpoints
@@ -198,6 +198,18 @@ func (e *endpointsManager) syncEndpoints() {
 		if !foundSuitableAppPod {
 			// None of the ready pods expose a back end service for this service's
 			// port. i.e. There are no endpoints. Add activator endpoints instead.
+			port, ok := e.activatorPort(servicePort)
+			if !ok {
+				// The activator doesn't listen for this port: better no endpoints
+				// than the ones of another service.
+				glog.Errorf(
+					"No activator port for port %d of service %s in namespace %s",
+					servicePort.Port,
+					e.service.Name,
+					e.service.Namespace,
+				)
+				continue
+			}
 			for _, proxyPod := range e.controller.readyActivatorPods {
 				subsets = append(subsets, corev1.EndpointSubset{
 					Addresses: []corev1.EndpointAddress{
@@ -208,7 +220,7 @@ func (e *endpointsManager) syncEndpoints() {
 					Ports: []corev1.EndpointPort{
 						{
 							Name:     servicePort.Name,
-							Port:     5000, // TODO: Maybe don't hard-code this?
+							Port:     port,
 							Protocol: servicePort.Protocol,
 						},
 					},
@@ -265,3 +277,28 @@ func findPodPort(pod corev1.Pod, svcPort corev1.ServicePort) (int32, bool) {
 	}
 	return 0, false
 }
+
+// activatorPort returns the port of the activator pods that serves the given
+// service port: the TCP listener assigned to the ports carrying raw TCP
+// traffic, the TLS passthrough listener for the ports carrying TLS traffic,
+// and the HTTP proxy for the others. It returns false for a raw TCP port
+// without an assigned listener.
+func (e *endpointsManager) activatorPort(servicePort corev1.ServicePort) (int32, bool) {
+	if kubernetes.IsTCPPort(e.service.Annotations, servicePort.Name, servicePort.Port) {
+		port, ok := e.controller.activatorTCPPortAssignments()[kubernetes.ActivatorTCPPortKey(
+			e.service.Namespace,
+			e.service.Name,
+			servicePort.Port,
+		)]
+		return port, ok
+	}
+	// TODO: Maybe don't hard-code this?
+	if kubernetes.IsTLSPassthroughPort(
+		e.service.Annotations,
+		servicePort.Name,
+		servicePort.Port,
+	) {
+		return 5003, true
+	}
+	return 5000, true
+}
@@ -220,11 +220,12 @@ func validateService(svc *corev1.Service) error {
 	if kubernetes.ServiceIsEligibleForEndpointsManagement(svc.Annotations) {
 		_, deploymentPresent := svc.Annotations["osiris.dm.gg/deployment"]
 		_, statefulSetPresent := svc.Annotations["osiris.dm.gg/statefulset"]
-		if !deploymentPresent && !statefulSetPresent {
+		_, daemonSetPresent := svc.Annotations["osiris.dm.gg/daemonset"]
+		if !deploymentPresent && !statefulSetPresent && !daemonSetPresent {
 			return fmt.Errorf(
 				`Osiris-enabled service %s in namespace %s is lacking the required `+
-					`"osiris.dm.gg/deployment" or`+
-					`"osiris.dm.gg/statefulset" annotation`,
+					`"osiris.dm.gg/deployment", "osiris.dm.gg/statefulset" or `+
+					`"osiris.dm.gg/daemonset" annotation`,
 				svc.Name,
 				svc.Namespace,
 			)
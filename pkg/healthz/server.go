@@ -12,7 +12,20 @@ import (
 )
 
 func RunServer(ctx context.Context, port int) {
+	RunServerWithHandlers(ctx, port, nil)
+}
+
+// RunServerWithHandlers runs the healthz server, with additional handlers by
+// path.
+func RunServerWithHandlers(
+	ctx context.Context,
+	port int,
+	handlers map[string]http.HandlerFunc,
+) {
 	mux := http.NewServeMux()
+	for path, handler := range handlers {
+		mux.HandleFunc(path, handler)
+	}
 	mux.HandleFunc("/healthz", HandleHealthCheckRequest)
 	mux.HandleFunc("/debug/pprof/", pprof.Index)
 	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
@@ -2,9 +2,11 @@ package kubernetes
 
 import (
 	"github.com/kelseyhightower/envconfig"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	metricsclientset "k8s.io/metrics/pkg/client/clientset/versioned"
 
 	// required to connect to a GKE cluster when running locally
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
@@ -20,19 +22,42 @@ type config struct {
 
 // Client returns a new Kubernetes client
 func Client() (*kubernetes.Clientset, error) {
-	c := config{}
-	err := envconfig.Process(envconfigPrefix, &c)
+	cfg, err := RestConfig()
 	if err != nil {
 		return nil, err
 	}
-	var cfg *rest.Config
-	if c.MasterURL == "" && c.KubeConfigPath == "" {
-		cfg, err = rest.InClusterConfig()
-	} else {
-		cfg, err = clientcmd.BuildConfigFromFlags(c.MasterURL, c.KubeConfigPath)
+	return kubernetes.NewForConfig(cfg)
+}
+
+// MetricsClient returns a new client for the Kubernetes metrics API
+// (metrics.k8s.io)
+func MetricsClient() (*metricsclientset.Clientset, error) {
+	cfg, err := RestConfig()
+	if err != nil {
+		return nil, err
+	}
+	return metricsclientset.NewForConfig(cfg)
+}
+
+// DynamicClient returns a new Kubernetes dynamic client, for the APIs without
+// a typed client - such as the Gateway API
+func DynamicClient() (dynamic.Interface, error) {
+	cfg, err := RestConfig()
+	if err != nil {
+		return nil, err
 	}
+	return dynamic.NewForConfig(cfg)
+}
+
+// RestConfig returns the configuration used to connect to the Kubernetes API
+func RestConfig() (*rest.Config, error) {
+	c := config{}
+	err := envconfig.Process(envconfigPrefix, &c)
 	if err != nil {
 		return nil, err
 	}
-	return kubernetes.NewForConfig(cfg)
+	if c.MasterURL == "" && c.KubeConfigPath == "" {
+		return rest.InClusterConfig()
+	}
+	return clientcmd.BuildConfigFromFlags(c.MasterURL, c.KubeConfigPath)
 }
@@ -0,0 +1,25 @@
+package kubernetes
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// EventRecorder returns a new recorder of Kubernetes events, for the given
+// component
+func EventRecorder(
+	client kubernetes.Interface,
+	component string,
+) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+		Interface: client.CoreV1().Events(""),
+	})
+	return broadcaster.NewRecorder(
+		scheme.Scheme,
+		corev1.EventSource{Component: component},
+	)
+}
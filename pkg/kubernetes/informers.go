@@ -5,16 +5,36 @@ import (
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 )
 
+// HTTPRouteResource is the Gateway API HTTPRoute resource
+var HTTPRouteResource = schema.GroupVersionResource{
+	Group:    "gateway.networking.k8s.io",
+	Version:  "v1",
+	Resource: "httproutes",
+}
+
+// ReferenceGrantResource is the Gateway API ReferenceGrant resource
+var ReferenceGrantResource = schema.GroupVersionResource{
+	Group:    "gateway.networking.k8s.io",
+	Version:  "v1beta1",
+	Resource: "referencegrants",
+}
+
 func DeploymentsIndexInformer(
 	client kubernetes.Interface,
 	namespace string,
@@ -85,6 +105,76 @@ func StatefulSetsIndexInformer(
 	)
 }
 
+func DaemonSetsIndexInformer(
+	client kubernetes.Interface,
+	namespace string,
+	fieldSelector fields.Selector,
+	labelSelector labels.Selector,
+	resyncPeriod time.Duration,
+) cache.SharedIndexInformer {
+	daemonSetsClient := client.AppsV1().DaemonSets(namespace)
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				if fieldSelector != nil {
+					options.FieldSelector = fieldSelector.String()
+				}
+				if labelSelector != nil {
+					options.LabelSelector = labelSelector.String()
+				}
+				return daemonSetsClient.List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				if fieldSelector != nil {
+					options.FieldSelector = fieldSelector.String()
+				}
+				if labelSelector != nil {
+					options.LabelSelector = labelSelector.String()
+				}
+				return daemonSetsClient.Watch(context.TODO(), options)
+			},
+		},
+		&appsv1.DaemonSet{},
+		resyncPeriod,
+		cache.Indexers{},
+	)
+}
+
+func HorizontalPodAutoscalersIndexInformer(
+	client kubernetes.Interface,
+	namespace string,
+	fieldSelector fields.Selector,
+	labelSelector labels.Selector,
+	resyncPeriod time.Duration,
+) cache.SharedIndexInformer {
+	hpasClient := client.AutoscalingV1().HorizontalPodAutoscalers(namespace)
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				if fieldSelector != nil {
+					options.FieldSelector = fieldSelector.String()
+				}
+				if labelSelector != nil {
+					options.LabelSelector = labelSelector.String()
+				}
+				return hpasClient.List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				if fieldSelector != nil {
+					options.FieldSelector = fieldSelector.String()
+				}
+				if labelSelector != nil {
+					options.LabelSelector = labelSelector.String()
+				}
+				return hpasClient.Watch(context.TODO(), options)
+			},
+		},
+		&autoscalingv1.HorizontalPodAutoscaler{},
+		resyncPeriod,
+		cache.Indexers{},
+	)
+}
+
 func PodsIndexInformer(
 	client kubernetes.Interface,
 	namespace string,
@@ -224,3 +314,216 @@ func NodesIndexInformer(
 		cache.Indexers{},
 	)
 }
+
+func NamespacesIndexInformer(
+	client kubernetes.Interface,
+	fieldSelector fields.Selector,
+	labelSelector labels.Selector,
+	resyncPeriod time.Duration,
+) cache.SharedIndexInformer {
+	namespacesClient := client.CoreV1().Namespaces()
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				if fieldSelector != nil {
+					options.FieldSelector = fieldSelector.String()
+				}
+				if labelSelector != nil {
+					options.LabelSelector = labelSelector.String()
+				}
+				return namespacesClient.List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				if fieldSelector != nil {
+					options.FieldSelector = fieldSelector.String()
+				}
+				if labelSelector != nil {
+					options.LabelSelector = labelSelector.String()
+				}
+				return namespacesClient.Watch(context.TODO(), options)
+			},
+		},
+		&corev1.Namespace{},
+		resyncPeriod,
+		cache.Indexers{},
+	)
+}
+
+func ConfigMapsIndexInformer(
+	client kubernetes.Interface,
+	namespace string,
+	fieldSelector fields.Selector,
+	labelSelector labels.Selector,
+	resyncPeriod time.Duration,
+) cache.SharedIndexInformer {
+	configMapsClient := client.CoreV1().ConfigMaps(namespace)
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				if fieldSelector != nil {
+					options.FieldSelector = fieldSelector.String()
+				}
+				if labelSelector != nil {
+					options.LabelSelector = labelSelector.String()
+				}
+				return configMapsClient.List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				if fieldSelector != nil {
+					options.FieldSelector = fieldSelector.String()
+				}
+				if labelSelector != nil {
+					options.LabelSelector = labelSelector.String()
+				}
+				return configMapsClient.Watch(context.TODO(), options)
+			},
+		},
+		&corev1.ConfigMap{},
+		resyncPeriod,
+		cache.Indexers{},
+	)
+}
+
+func LeasesIndexInformer(
+	client kubernetes.Interface,
+	namespace string,
+	fieldSelector fields.Selector,
+	labelSelector labels.Selector,
+	resyncPeriod time.Duration,
+) cache.SharedIndexInformer {
+	leasesClient := client.CoordinationV1().Leases(namespace)
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				if fieldSelector != nil {
+					options.FieldSelector = fieldSelector.String()
+				}
+				if labelSelector != nil {
+					options.LabelSelector = labelSelector.String()
+				}
+				return leasesClient.List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				if fieldSelector != nil {
+					options.FieldSelector = fieldSelector.String()
+				}
+				if labelSelector != nil {
+					options.LabelSelector = labelSelector.String()
+				}
+				return leasesClient.Watch(context.TODO(), options)
+			},
+		},
+		&coordinationv1.Lease{},
+		resyncPeriod,
+		cache.Indexers{},
+	)
+}
+
+func IngressesIndexInformer(
+	client kubernetes.Interface,
+	namespace string,
+	fieldSelector fields.Selector,
+	labelSelector labels.Selector,
+	resyncPeriod time.Duration,
+) cache.SharedIndexInformer {
+	ingressesClient := client.NetworkingV1().Ingresses(namespace)
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				if fieldSelector != nil {
+					options.FieldSelector = fieldSelector.String()
+				}
+				if labelSelector != nil {
+					options.LabelSelector = labelSelector.String()
+				}
+				return ingressesClient.List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				if fieldSelector != nil {
+					options.FieldSelector = fieldSelector.String()
+				}
+				if labelSelector != nil {
+					options.LabelSelector = labelSelector.String()
+				}
+				return ingressesClient.Watch(context.TODO(), options)
+			},
+		},
+		&networkingv1.Ingress{},
+		resyncPeriod,
+		cache.Indexers{},
+	)
+}
+
+// HTTPRoutesIndexInformer returns an informer for the Gateway API HTTPRoutes,
+// as unstructured objects - the Gateway API has no typed client here.
+func HTTPRoutesIndexInformer(
+	client dynamic.Interface,
+	namespace string,
+	fieldSelector fields.Selector,
+	labelSelector labels.Selector,
+	resyncPeriod time.Duration,
+) cache.SharedIndexInformer {
+	httpRoutesClient := client.Resource(HTTPRouteResource).Namespace(namespace)
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				if fieldSelector != nil {
+					options.FieldSelector = fieldSelector.String()
+				}
+				if labelSelector != nil {
+					options.LabelSelector = labelSelector.String()
+				}
+				return httpRoutesClient.List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				if fieldSelector != nil {
+					options.FieldSelector = fieldSelector.String()
+				}
+				if labelSelector != nil {
+					options.LabelSelector = labelSelector.String()
+				}
+				return httpRoutesClient.Watch(context.TODO(), options)
+			},
+		},
+		&unstructured.Unstructured{},
+		resyncPeriod,
+		cache.Indexers{},
+	)
+}
+
+// ReferenceGrantsIndexInformer returns an informer for the Gateway API
+// ReferenceGrants, as unstructured objects.
+func ReferenceGrantsIndexInformer(
+	client dynamic.Interface,
+	namespace string,
+	fieldSelector fields.Selector,
+	labelSelector labels.Selector,
+	resyncPeriod time.Duration,
+) cache.SharedIndexInformer {
+	referenceGrantsClient := client.Resource(ReferenceGrantResource).Namespace(namespace)
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				if fieldSelector != nil {
+					options.FieldSelector = fieldSelector.String()
+				}
+				if labelSelector != nil {
+					options.LabelSelector = labelSelector.String()
+				}
+				return referenceGrantsClient.List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				if fieldSelector != nil {
+					options.FieldSelector = fieldSelector.String()
+				}
+				if labelSelector != nil {
+					options.LabelSelector = labelSelector.String()
+				}
+				return referenceGrantsClient.Watch(context.TODO(), options)
+			},
+		},
+		&unstructured.Unstructured{},
+		resyncPeriod,
+		cache.Indexers{},
+	)
+}
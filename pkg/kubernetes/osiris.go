@@ -1,17 +1,36 @@
 package kubernetes
 
 import (
+	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 const (
 	IgnoredPathsAnnotationName         = "osiris.dm.gg/ignoredPaths"
 	MetricsCollectorAnnotationName     = "osiris.dm.gg/metricsCollector"
 	MetricsCheckIntervalAnnotationName = "osiris.dm.gg/metricsCheckInterval"
+	PausedUntilAnnotationName          = "osiris.dm.gg/pausedUntil"
+	ScaledReplicasAnnotationName       = "osiris.dm.gg/scaledReplicas"
+	ParkedNodeSelectorAnnotationName   = "osiris.dm.gg/parkedNodeSelector"
+	WakingUpPageTemplateAnnotationName = "osiris.dm.gg/wakingUpPageTemplate"
 	enableScalingAnnotationName        = "osiris.dm.gg/enableScaling"
 	collectMetricsAnnotationName       = "osiris.dm.gg/collectMetrics"
 	manageEndpointsAnnotationName      = "osiris.dm.gg/manageEndpoints"
+	maxActiveWorkloadsAnnotationName   = "osiris.dm.gg/maxActiveWorkloads"
+	maxQueuedRequestsAnnotationName    = "osiris.dm.gg/maxQueuedRequests"
+	maxRequestWaitAnnotationName       = "osiris.dm.gg/maxRequestWait"
+	wakingUpPageAnnotationName         = "osiris.dm.gg/wakingUpPage"
+	activationTimeoutAnnotationName    = "osiris.dm.gg/activationTimeout"
+	activationReadyPodsAnnotationName  = "osiris.dm.gg/activationReadyPods"
+	tlsPassthroughPortsAnnotationName  = "osiris.dm.gg/tlsPassthroughPorts"
+	tcpPortsAnnotationName             = "osiris.dm.gg/tcpPorts"
+	h2cPortsAnnotationName             = "osiris.dm.gg/h2cPorts"
 )
 
 // WorkloadIsEligibleForAutoScaling checks the annotations to see if the
@@ -32,6 +51,19 @@ func ServiceIsEligibleForEndpointsManagement(annotations map[string]string) bool
 	return annotationBooleanValue(annotations, manageEndpointsAnnotationName)
 }
 
+// ServiceHasWakingUpPage checks the annotations to see if the activator
+// should answer the browser requests for the service with a waking up page,
+// instead of holding them during the activation.
+func ServiceHasWakingUpPage(annotations map[string]string) bool {
+	return annotationBooleanValue(annotations, wakingUpPageAnnotationName)
+}
+
+// BooleanValue checks if the value of the given key in the given map (of
+// annotations, configmap data, ...) is a "true" value.
+func BooleanValue(values map[string]string, key string) bool {
+	return annotationBooleanValue(values, key)
+}
+
 func annotationBooleanValue(annotations map[string]string, key string) bool {
 	enabled, ok := annotations[key]
 	if !ok {
@@ -59,3 +91,278 @@ func GetMinReplicas(annotations map[string]string, defaultVal int32) int32 {
 	}
 	return int32(minReplicas)
 }
+
+// GetMaxActiveWorkloads gets the maximum number of Osiris-enabled workloads
+// allowed to run at the same time in a namespace, from the namespace's
+// annotations. The second returned value is false if no valid (positive)
+// budget is defined.
+func GetMaxActiveWorkloads(annotations map[string]string) (int, bool) {
+	val, ok := annotations[maxActiveWorkloadsAnnotationName]
+	if !ok {
+		return 0, false
+	}
+	maxActiveWorkloads, err := strconv.Atoi(strings.TrimSpace(val))
+	if err != nil || maxActiveWorkloads <= 0 {
+		return 0, false
+	}
+	return maxActiveWorkloads, true
+}
+
+// GetPausedUntil gets the time until which Osiris should not change the
+// number of replicas of a workload, from the annotations. The second returned
+// value is false if no valid time is defined.
+func GetPausedUntil(annotations map[string]string) (time.Time, bool) {
+	val, ok := annotations[PausedUntilAnnotationName]
+	if !ok {
+		return time.Time{}, false
+	}
+	pausedUntil, err := time.Parse(time.RFC3339, strings.TrimSpace(val))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return pausedUntil, true
+}
+
+// WorkloadIsPaused checks the annotations to see if Osiris should currently
+// leave the number of replicas of the workload untouched.
+func WorkloadIsPaused(annotations map[string]string) bool {
+	pausedUntil, ok := GetPausedUntil(annotations)
+	return ok && time.Now().Before(pausedUntil)
+}
+
+// GetScaledReplicas gets the number of replicas that Osiris set the last time
+// it scaled the workload, from the annotations. The second returned value is
+// false if Osiris never scaled the workload.
+func GetScaledReplicas(annotations map[string]string) (int32, bool) {
+	val, ok := annotations[ScaledReplicasAnnotationName]
+	if !ok {
+		return 0, false
+	}
+	scaledReplicas, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, false
+	}
+	return int32(scaledReplicas), true
+}
+
+// GetMaxQueuedRequests gets the maximum number of requests the activator keeps
+// waiting for the activation of a workload, from the annotations. If it fails
+// to do so, it returns the default value.
+func GetMaxQueuedRequests(annotations map[string]string, defaultVal int) int {
+	val, ok := annotations[maxQueuedRequestsAnnotationName]
+	if !ok {
+		return defaultVal
+	}
+	maxQueuedRequests, err := strconv.Atoi(strings.TrimSpace(val))
+	if err != nil || maxQueuedRequests < 0 {
+		return defaultVal
+	}
+	return maxQueuedRequests
+}
+
+// GetMaxRequestWait gets how long the activator keeps a request waiting for
+// the activation of a workload, from the annotations - 0 meaning no limit. If
+// it fails to do so, it returns the default value.
+func GetMaxRequestWait(annotations map[string]string, defaultVal time.Duration) time.Duration {
+	val, ok := annotations[maxRequestWaitAnnotationName]
+	if !ok {
+		return defaultVal
+	}
+	maxRequestWait, err := time.ParseDuration(strings.TrimSpace(val))
+	if err != nil || maxRequestWait < 0 {
+		return defaultVal
+	}
+	return maxRequestWait
+}
+
+// GetActivationTimeout gets how long the activator waits for a workload to be
+// ready after its activation, from the annotations. If it fails to do so, it
+// returns the default value.
+func GetActivationTimeout(annotations map[string]string, defaultVal time.Duration) time.Duration {
+	val, ok := annotations[activationTimeoutAnnotationName]
+	if !ok {
+		return defaultVal
+	}
+	activationTimeout, err := time.ParseDuration(strings.TrimSpace(val))
+	if err != nil || activationTimeout <= 0 {
+		return defaultVal
+	}
+	return activationTimeout
+}
+
+// GetActivationReadyPods gets the number - or percentage, such as "50%" - of
+// ready pods required to consider a workload activated, from the
+// annotations. If it fails to do so, it returns 1.
+func GetActivationReadyPods(annotations map[string]string) intstr.IntOrString {
+	defaultVal := intstr.FromInt(1)
+	val, ok := annotations[activationReadyPodsAnnotationName]
+	if !ok {
+		return defaultVal
+	}
+	val = strings.TrimSpace(val)
+	if strings.HasSuffix(val, "%") {
+		percent, err := strconv.Atoi(strings.TrimSuffix(val, "%"))
+		if err != nil || percent <= 0 || percent > 100 {
+			return defaultVal
+		}
+		return intstr.FromString(val)
+	}
+	readyPods, err := strconv.Atoi(val)
+	if err != nil || readyPods <= 0 {
+		return defaultVal
+	}
+	return intstr.FromInt(readyPods)
+}
+
+// IsTLSPassthroughPort checks the annotations of a service to see if the
+// service port with the given name and number carries TLS traffic that the
+// activator should pass through - without terminating TLS - instead of HTTP
+// traffic. Ports are listed by name or number, comma-separated.
+func IsTLSPassthroughPort(annotations map[string]string, name string, port int32) bool {
+	return isListedPort(annotations[tlsPassthroughPortsAnnotationName], name, port)
+}
+
+// IsH2CPort checks whether the given service port accepts HTTP/2 over
+// cleartext (h2c), so that the activator can proxy the HTTP/2 requests to it
+// without downgrading them to HTTP/1.1. It does if its appProtocol is
+// kubernetes.io/h2c or grpc, or if it is listed - by name or number,
+// comma-separated - in the annotations of the service.
+func IsH2CPort(annotations map[string]string, port corev1.ServicePort) bool {
+	if port.AppProtocol != nil {
+		switch strings.ToLower(*port.AppProtocol) {
+		case "kubernetes.io/h2c", "grpc":
+			return true
+		}
+	}
+	return isListedPort(annotations[h2cPortsAnnotationName], port.Name, port.Port)
+}
+
+// isListedPort checks if the port with the given name and number is in the
+// given comma-separated list of port names and numbers.
+func isListedPort(list string, name string, port int32) bool {
+	for _, listedPort := range strings.Split(list, ",") {
+		listedPort = strings.TrimSpace(listedPort)
+		if len(listedPort) == 0 {
+			continue
+		}
+		if (len(name) > 0 && listedPort == name) || listedPort == strconv.Itoa(int(port)) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// MinActivatorTCPPort and MaxActivatorTCPPort define the range of the ports
+	// of the activator TCP listeners - away from the other ports of the
+	// activator, and from the privileged ports.
+	MinActivatorTCPPort = 20000
+	MaxActivatorTCPPort = 29999
+)
+
+// IsTCPPort checks the annotations of a service to see if the service port
+// with the given name and number carries raw TCP traffic - such as a database
+// protocol. Ports are listed by name or number, comma-separated, followed by
+// "=" and the port of the activator TCP listener dedicated to them.
+func IsTCPPort(annotations map[string]string, name string, port int32) bool {
+	_, listed := getRequestedActivatorTCPPort(annotations, name, port)
+	return listed
+}
+
+// ServiceHasTCPPorts checks the annotations of a service to see if it has raw
+// TCP ports.
+func ServiceHasTCPPorts(annotations map[string]string) bool {
+	_, ok := annotations[tcpPortsAnnotationName]
+	return ok
+}
+
+// GetActivatorTCPPort returns the port of the activator TCP listener requested
+// for the given raw TCP service port. It returns false if the service port is
+// not a raw TCP port, or if the requested port is missing or out of the
+// [MinActivatorTCPPort, MaxActivatorTCPPort] range. Note that the requested
+// port may also be used by another service: see AssignActivatorTCPPorts.
+func GetActivatorTCPPort(
+	annotations map[string]string,
+	name string,
+	port int32,
+) (int32, bool) {
+	activatorPort, _ := getRequestedActivatorTCPPort(annotations, name, port)
+	if activatorPort < MinActivatorTCPPort || activatorPort > MaxActivatorTCPPort {
+		return 0, false
+	}
+	return activatorPort, true
+}
+
+func getRequestedActivatorTCPPort(
+	annotations map[string]string,
+	name string,
+	port int32,
+) (activatorPort int32, listed bool) {
+	val, ok := annotations[tcpPortsAnnotationName]
+	if !ok {
+		return 0, false
+	}
+	for _, tcpPort := range strings.Split(val, ",") {
+		elems := strings.SplitN(strings.TrimSpace(tcpPort), "=", 2)
+		if len(elems[0]) == 0 ||
+			(elems[0] != name && elems[0] != strconv.Itoa(int(port))) {
+			continue
+		}
+		if len(elems) == 2 {
+			requestedPort, err := strconv.ParseInt(strings.TrimSpace(elems[1]), 10, 32)
+			if err == nil {
+				return int32(requestedPort), true
+			}
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// ActivatorTCPPortKey returns the key of a service port in the map returned by
+// AssignActivatorTCPPorts.
+func ActivatorTCPPortKey(namespace string, service string, port int32) string {
+	return fmt.Sprintf("%s/%s:%d", namespace, service, port)
+}
+
+// AssignActivatorTCPPorts returns the activator TCP listener ports assigned to
+// the raw TCP ports of the given Osiris-enabled services, by
+// ActivatorTCPPortKey. When several service ports request the same activator
+// port, only the one of the oldest service - then by namespace and name, and
+// by order of the ports - gets it, so that the activator and the endpoints
+// controller always agree on the assignments. The other service ports, and the
+// ones with an invalid activator port, are not assigned any port.
+func AssignActivatorTCPPorts(services []*corev1.Service) map[string]int32 {
+	sortedServices := make([]*corev1.Service, 0, len(services))
+	for _, svc := range services {
+		if ServiceIsEligibleForEndpointsManagement(svc.Annotations) {
+			sortedServices = append(sortedServices, svc)
+		}
+	}
+	sort.Slice(sortedServices, func(i, j int) bool {
+		a, b := sortedServices[i], sortedServices[j]
+		if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			return a.CreationTimestamp.Before(&b.CreationTimestamp)
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	assignments := map[string]int32{}
+	usedPorts := map[int32]struct{}{}
+	for _, svc := range sortedServices {
+		for _, port := range svc.Spec.Ports {
+			activatorPort, ok := GetActivatorTCPPort(svc.Annotations, port.Name, port.Port)
+			if !ok {
+				continue
+			}
+			if _, used := usedPorts[activatorPort]; used {
+				continue
+			}
+			usedPorts[activatorPort] = struct{}{}
+			assignments[ActivatorTCPPortKey(svc.Namespace, svc.Name, port.Port)] = activatorPort
+		}
+	}
+	return assignments
+}
@@ -2,6 +2,12 @@ package kubernetes
 
 import (
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 func TestAnnotationBooleanValue(t *testing.T) {
@@ -113,3 +119,503 @@ func TestGetMinReplicas(t *testing.T) {
 		})
 	}
 }
+
+func TestGetMaxActiveWorkloads(t *testing.T) {
+	testcases := []struct {
+		name           string
+		annotations    map[string]string
+		expectedResult int
+		expectedStatus bool
+	}{
+		{
+			name: "map with max active workloads entry",
+			annotations: map[string]string{
+				maxActiveWorkloadsAnnotationName: "5",
+			},
+			expectedResult: 5,
+			expectedStatus: true,
+		},
+		{
+			name:           "map with no max active workloads entry",
+			annotations:    map[string]string{},
+			expectedResult: 0,
+			expectedStatus: false,
+		},
+		{
+			name: "map with invalid max active workloads entry",
+			annotations: map[string]string{
+				maxActiveWorkloadsAnnotationName: "invalid",
+			},
+			expectedResult: 0,
+			expectedStatus: false,
+		},
+		{
+			name: "map with zero max active workloads entry",
+			annotations: map[string]string{
+				maxActiveWorkloadsAnnotationName: "0",
+			},
+			expectedResult: 0,
+			expectedStatus: false,
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			actual, ok := GetMaxActiveWorkloads(test.annotations)
+			if actual != test.expectedResult || ok != test.expectedStatus {
+				t.Errorf(
+					"expected GetMaxActiveWorkloads to return (%d, %t), but got (%d, %t)",
+					test.expectedResult, test.expectedStatus, actual, ok)
+			}
+		})
+	}
+}
+
+func TestGetMaxQueuedRequests(t *testing.T) {
+	testcases := []struct {
+		name           string
+		annotations    map[string]string
+		expectedResult int
+	}{
+		{
+			name: "map with max queued requests entry",
+			annotations: map[string]string{
+				maxQueuedRequestsAnnotationName: "50",
+			},
+			expectedResult: 50,
+		},
+		{
+			name: "map with zero max queued requests entry",
+			annotations: map[string]string{
+				maxQueuedRequestsAnnotationName: "0",
+			},
+			expectedResult: 0,
+		},
+		{
+			name:           "map with no max queued requests entry",
+			annotations:    map[string]string{},
+			expectedResult: 100,
+		},
+		{
+			name: "map with negative max queued requests entry",
+			annotations: map[string]string{
+				maxQueuedRequestsAnnotationName: "-1",
+			},
+			expectedResult: 100,
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			actual := GetMaxQueuedRequests(test.annotations, 100)
+			if actual != test.expectedResult {
+				t.Errorf(
+					"expected GetMaxQueuedRequests to return %d, but got %d",
+					test.expectedResult, actual)
+			}
+		})
+	}
+}
+
+func TestGetMaxRequestWait(t *testing.T) {
+	testcases := []struct {
+		name           string
+		annotations    map[string]string
+		expectedResult time.Duration
+	}{
+		{
+			name: "map with max request wait entry",
+			annotations: map[string]string{
+				maxRequestWaitAnnotationName: "30s",
+			},
+			expectedResult: 30 * time.Second,
+		},
+		{
+			name: "map with disabled max request wait entry",
+			annotations: map[string]string{
+				maxRequestWaitAnnotationName: "0",
+			},
+			expectedResult: 0,
+		},
+		{
+			name: "map with negative max request wait entry",
+			annotations: map[string]string{
+				maxRequestWaitAnnotationName: "-30s",
+			},
+			expectedResult: time.Minute,
+		},
+		{
+			name:           "map with no max request wait entry",
+			annotations:    map[string]string{},
+			expectedResult: time.Minute,
+		},
+		{
+			name: "map with invalid max request wait entry",
+			annotations: map[string]string{
+				maxRequestWaitAnnotationName: "30",
+			},
+			expectedResult: time.Minute,
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			actual := GetMaxRequestWait(test.annotations, time.Minute)
+			if actual != test.expectedResult {
+				t.Errorf(
+					"expected GetMaxRequestWait to return %s, but got %s",
+					test.expectedResult, actual)
+			}
+		})
+	}
+}
+
+func TestGetActivationTimeout(t *testing.T) {
+	testcases := []struct {
+		name           string
+		annotations    map[string]string
+		expectedResult time.Duration
+	}{
+		{
+			name: "map with activation timeout entry",
+			annotations: map[string]string{
+				activationTimeoutAnnotationName: "10m",
+			},
+			expectedResult: 10 * time.Minute,
+		},
+		{
+			name:           "map with no activation timeout entry",
+			annotations:    map[string]string{},
+			expectedResult: 2 * time.Minute,
+		},
+		{
+			name: "map with negative activation timeout entry",
+			annotations: map[string]string{
+				activationTimeoutAnnotationName: "-1m",
+			},
+			expectedResult: 2 * time.Minute,
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			actual := GetActivationTimeout(test.annotations, 2*time.Minute)
+			if actual != test.expectedResult {
+				t.Errorf(
+					"expected GetActivationTimeout to return %s, but got %s",
+					test.expectedResult, actual)
+			}
+		})
+	}
+}
+
+func TestGetActivationReadyPods(t *testing.T) {
+	testcases := []struct {
+		name           string
+		annotations    map[string]string
+		expectedResult intstr.IntOrString
+	}{
+		{
+			name: "map with number of ready pods",
+			annotations: map[string]string{
+				activationReadyPodsAnnotationName: "3",
+			},
+			expectedResult: intstr.FromInt(3),
+		},
+		{
+			name: "map with percentage of ready pods",
+			annotations: map[string]string{
+				activationReadyPodsAnnotationName: "51%",
+			},
+			expectedResult: intstr.FromString("51%"),
+		},
+		{
+			name:           "map with no ready pods entry",
+			annotations:    map[string]string{},
+			expectedResult: intstr.FromInt(1),
+		},
+		{
+			name: "map with invalid percentage of ready pods",
+			annotations: map[string]string{
+				activationReadyPodsAnnotationName: "150%",
+			},
+			expectedResult: intstr.FromInt(1),
+		},
+		{
+			name: "map with zero ready pods",
+			annotations: map[string]string{
+				activationReadyPodsAnnotationName: "0",
+			},
+			expectedResult: intstr.FromInt(1),
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			actual := GetActivationReadyPods(test.annotations)
+			if actual != test.expectedResult {
+				t.Errorf(
+					"expected GetActivationReadyPods to return %s, but got %s",
+					test.expectedResult.String(), actual.String())
+			}
+		})
+	}
+}
+
+func TestIsTLSPassthroughPort(t *testing.T) {
+	testcases := []struct {
+		name           string
+		annotations    map[string]string
+		portName       string
+		port           int32
+		expectedResult bool
+	}{
+		{
+			name: "port listed by number",
+			annotations: map[string]string{
+				tlsPassthroughPortsAnnotationName: "443, 8443",
+			},
+			port:           8443,
+			expectedResult: true,
+		},
+		{
+			name: "port listed by name",
+			annotations: map[string]string{
+				tlsPassthroughPortsAnnotationName: "https",
+			},
+			portName:       "https",
+			port:           443,
+			expectedResult: true,
+		},
+		{
+			name: "port not listed",
+			annotations: map[string]string{
+				tlsPassthroughPortsAnnotationName: "443",
+			},
+			portName:       "http",
+			port:           80,
+			expectedResult: false,
+		},
+		{
+			name:           "map with no tls passthrough ports entry",
+			annotations:    map[string]string{},
+			port:           443,
+			expectedResult: false,
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			actual := IsTLSPassthroughPort(test.annotations, test.portName, test.port)
+			if actual != test.expectedResult {
+				t.Errorf(
+					"expected IsTLSPassthroughPort to return %t, but got %t",
+					test.expectedResult, actual)
+			}
+		})
+	}
+}
+
+func TestIsH2CPort(t *testing.T) {
+	h2c := "kubernetes.io/h2c"
+	grpc := "grpc"
+	http := "http"
+	testcases := []struct {
+		name           string
+		annotations    map[string]string
+		port           corev1.ServicePort
+		expectedResult bool
+	}{
+		{
+			name: "h2c app protocol",
+			port: corev1.ServicePort{
+				Name:        "api",
+				Port:        8080,
+				AppProtocol: &h2c,
+			},
+			expectedResult: true,
+		},
+		{
+			name: "grpc app protocol",
+			port: corev1.ServicePort{
+				Port:        9000,
+				AppProtocol: &grpc,
+			},
+			expectedResult: true,
+		},
+		{
+			name: "port listed by name",
+			annotations: map[string]string{
+				h2cPortsAnnotationName: "grpc-api, 8443",
+			},
+			port: corev1.ServicePort{
+				Name: "grpc-api",
+				Port: 9000,
+			},
+			expectedResult: true,
+		},
+		{
+			name: "port listed by number",
+			annotations: map[string]string{
+				h2cPortsAnnotationName: "9000",
+			},
+			port: corev1.ServicePort{
+				Name:        "api",
+				Port:        9000,
+				AppProtocol: &http,
+			},
+			expectedResult: true,
+		},
+		{
+			name: "http app protocol",
+			port: corev1.ServicePort{
+				Name:        "api",
+				Port:        8080,
+				AppProtocol: &http,
+			},
+			expectedResult: false,
+		},
+		{
+			name: "port not listed",
+			annotations: map[string]string{
+				h2cPortsAnnotationName: "9000",
+			},
+			port: corev1.ServicePort{
+				Name: "http",
+				Port: 80,
+			},
+			expectedResult: false,
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			actual := IsH2CPort(test.annotations, test.port)
+			if actual != test.expectedResult {
+				t.Errorf(
+					"expected IsH2CPort to return %t, but got %t",
+					test.expectedResult, actual)
+			}
+		})
+	}
+}
+
+func TestGetActivatorTCPPort(t *testing.T) {
+	testcases := []struct {
+		name           string
+		annotations    map[string]string
+		portName       string
+		port           int32
+		expectedResult int32
+		expectedStatus bool
+		expectedTCP    bool
+	}{
+		{
+			name: "port listed by name",
+			annotations: map[string]string{
+				tcpPortsAnnotationName: "postgres=25432",
+			},
+			portName:       "postgres",
+			port:           5432,
+			expectedResult: 25432,
+			expectedStatus: true,
+			expectedTCP:    true,
+		},
+		{
+			name: "port listed by number",
+			annotations: map[string]string{
+				tcpPortsAnnotationName: "http, 6379=26379",
+			},
+			port:           6379,
+			expectedResult: 26379,
+			expectedStatus: true,
+			expectedTCP:    true,
+		},
+		{
+			name: "port without an activator port",
+			annotations: map[string]string{
+				tcpPortsAnnotationName: "6379",
+			},
+			port:        6379,
+			expectedTCP: true,
+		},
+		{
+			name: "port with an activator port of the activator itself",
+			annotations: map[string]string{
+				tcpPortsAnnotationName: "6379=5000",
+			},
+			port:        6379,
+			expectedTCP: true,
+		},
+		{
+			name: "port with a privileged activator port",
+			annotations: map[string]string{
+				tcpPortsAnnotationName: "6379=443",
+			},
+			port:        6379,
+			expectedTCP: true,
+		},
+		{
+			name: "port not listed",
+			annotations: map[string]string{
+				tcpPortsAnnotationName: "6379=26379",
+			},
+			portName: "http",
+			port:     80,
+		},
+		{
+			name:        "map with no tcp ports entry",
+			annotations: map[string]string{},
+			port:        6379,
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			actual, ok := GetActivatorTCPPort(test.annotations, test.portName, test.port)
+			if actual != test.expectedResult || ok != test.expectedStatus {
+				t.Errorf(
+					"expected GetActivatorTCPPort to return (%d, %t), but got (%d, %t)",
+					test.expectedResult, test.expectedStatus, actual, ok)
+			}
+			if tcp := IsTCPPort(test.annotations, test.portName, test.port); tcp != test.expectedTCP {
+				t.Errorf("expected IsTCPPort to return %t, but got %t", test.expectedTCP, tcp)
+			}
+		})
+	}
+}
+
+func TestAssignActivatorTCPPorts(t *testing.T) {
+	now := time.Now()
+	newService := func(namespace, name string, created time.Time, tcpPorts string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         namespace,
+				Name:              name,
+				CreationTimestamp: metav1.NewTime(created),
+				Annotations: map[string]string{
+					manageEndpointsAnnotationName: "true",
+					tcpPortsAnnotationName:        tcpPorts,
+				},
+			},
+			Spec: corev1.ServiceSpec{
+				Ports: []corev1.ServicePort{{Name: "db", Port: 5432}},
+			},
+		}
+	}
+	notManaged := newService("ns", "not-managed", now.Add(-time.Hour), "db=25432")
+	delete(notManaged.Annotations, manageEndpointsAnnotationName)
+
+	services := []*corev1.Service{
+		newService("ns", "new", now, "db=25432"),
+		newService("ns", "old", now.Add(-time.Minute), "db=25432"),
+		newService("a-ns", "same-age", now, "db=26000"),
+		newService("b-ns", "same-age", now, "db=26000"),
+		newService("ns", "invalid", now, "db=80"),
+		notManaged,
+	}
+	assert.Equal(t, map[string]int32{
+		"ns/old:5432":        25432,
+		"a-ns/same-age:5432": 26000,
+	}, AssignActivatorTCPPorts(services))
+}
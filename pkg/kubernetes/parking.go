@@ -0,0 +1,81 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ParkingNodeSelectorKey is the key of the node selector added to the pods
+// of a parked daemonSet. No node has this label, so a parked daemonSet runs
+// no pods.
+const ParkingNodeSelectorKey = "osiris.dm.gg/parked"
+
+// DaemonSetIsParked checks if a daemonSet with the given pods node selector
+// has been parked by Osiris.
+func DaemonSetIsParked(nodeSelector map[string]string) bool {
+	_, parked := nodeSelector[ParkingNodeSelectorKey]
+	return parked
+}
+
+// ParkPatch returns a merge patch that parks a daemonSet - the equivalent of
+// scaling it to zero, for a workload that has no replicas. It adds a node
+// selector matching no node to its pods, and saves the original node selector
+// in the osiris.dm.gg/parkedNodeSelector annotation.
+func ParkPatch(nodeSelector map[string]string) []byte {
+	if nodeSelector == nil {
+		nodeSelector = map[string]string{}
+	}
+	originalNodeSelector, _ := json.Marshal(nodeSelector)
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				ParkedNodeSelectorAnnotationName: string(originalNodeSelector),
+			},
+		},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"nodeSelector": map[string]string{
+						ParkingNodeSelectorKey: "true",
+					},
+				},
+			},
+		},
+	}
+	patchBytes, _ := json.Marshal(patch)
+	return patchBytes
+}
+
+// UnparkPatch returns a merge patch that unparks a daemonSet parked with
+// ParkPatch, restoring the original node selector of its pods.
+func UnparkPatch(annotations map[string]string) ([]byte, error) {
+	var originalNodeSelector map[string]string
+	if rawNodeSelector, ok := annotations[ParkedNodeSelectorAnnotationName]; ok {
+		if err := json.Unmarshal([]byte(rawNodeSelector), &originalNodeSelector); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %s", ParkedNodeSelectorAnnotationName, err)
+		}
+	}
+	// with a merge patch, keys set to null are removed
+	nodeSelector := map[string]interface{}{
+		ParkingNodeSelectorKey: nil,
+	}
+	for key, value := range originalNodeSelector {
+		nodeSelector[key] = value
+	}
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				ParkedNodeSelectorAnnotationName: nil,
+			},
+		},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"nodeSelector": nodeSelector,
+				},
+			},
+		},
+	}
+	patchBytes, _ := json.Marshal(patch)
+	return patchBytes, nil
+}
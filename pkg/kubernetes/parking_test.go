@@ -0,0 +1,80 @@
+package kubernetes
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s_types "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParkAndUnpark(t *testing.T) {
+	testcases := []struct {
+		name         string
+		nodeSelector map[string]string
+	}{
+		{
+			name: "no node selector",
+		},
+		{
+			name: "existing node selector",
+			nodeSelector: map[string]string{
+				"kubernetes.io/os": "linux",
+				"pool":             "agents",
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			ctx := context.Background()
+			client := fake.NewSimpleClientset(&appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "agent"},
+				Spec: appsv1.DaemonSetSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{NodeSelector: testcase.nodeSelector},
+					},
+				},
+			})
+			daemonSets := client.AppsV1().DaemonSets("ns")
+
+			parked, err := daemonSets.Patch(ctx, "agent", k8s_types.MergePatchType,
+				ParkPatch(testcase.nodeSelector), metav1.PatchOptions{})
+			if err != nil {
+				t.Fatalf("error parking daemonSet: %s", err)
+			}
+			if !DaemonSetIsParked(parked.Spec.Template.Spec.NodeSelector) {
+				t.Errorf("expected daemonSet to be parked, got node selector %v",
+					parked.Spec.Template.Spec.NodeSelector)
+			}
+
+			patch, err := UnparkPatch(parked.Annotations)
+			if err != nil {
+				t.Fatalf("error building unpark patch: %s", err)
+			}
+			unparked, err := daemonSets.Patch(ctx, "agent", k8s_types.MergePatchType,
+				patch, metav1.PatchOptions{})
+			if err != nil {
+				t.Fatalf("error unparking daemonSet: %s", err)
+			}
+			if DaemonSetIsParked(unparked.Spec.Template.Spec.NodeSelector) {
+				t.Errorf("expected daemonSet to be unparked")
+			}
+			if len(testcase.nodeSelector) > 0 &&
+				!reflect.DeepEqual(testcase.nodeSelector, unparked.Spec.Template.Spec.NodeSelector) {
+				t.Errorf("expected node selector %v, got %v",
+					testcase.nodeSelector, unparked.Spec.Template.Spec.NodeSelector)
+			}
+			if len(testcase.nodeSelector) == 0 && len(unparked.Spec.Template.Spec.NodeSelector) > 0 {
+				t.Errorf("expected no node selector, got %v", unparked.Spec.Template.Spec.NodeSelector)
+			}
+			if _, found := unparked.Annotations[ParkedNodeSelectorAnnotationName]; found {
+				t.Errorf("expected %s annotation to be removed", ParkedNodeSelectorAnnotationName)
+			}
+		})
+	}
+}
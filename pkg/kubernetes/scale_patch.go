@@ -0,0 +1,25 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// ScalePatch returns a merge patch that sets the number of replicas of a
+// deployment or statefulSet. The number of replicas is also recorded in the
+// osiris.dm.gg/scaledReplicas annotation, so that scaling operations not made
+// by Osiris can be detected.
+func ScalePatch(replicas int32) []byte {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				ScaledReplicasAnnotationName: strconv.Itoa(int(replicas)),
+			},
+		},
+		"spec": map[string]interface{}{
+			"replicas": replicas,
+		},
+	}
+	patchBytes, _ := json.Marshal(patch)
+	return patchBytes
+}
@@ -0,0 +1,70 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client is a client for the collect endpoint of the plugins
+type Client struct {
+	httpClient *http.Client
+}
+
+// NewClient returns a new Client, with the given timeout for each request
+func NewClient(timeout time.Duration) *Client {
+	return &Client{
+		httpClient: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+// Collect sends the given request to the plugin at the given base URL, and
+// returns its response.
+func (c *Client) Collect(
+	ctx context.Context,
+	baseURL string,
+	request CollectRequest,
+) (*CollectResponse, error) {
+	if len(request.APIVersion) == 0 {
+		request.APIVersion = APIVersion
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	target := strings.TrimSuffix(baseURL, "/") + CollectPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err == nil && len(errResp.Error) > 0 {
+			return nil, fmt.Errorf("plugin %s replied with status %d: %s", target, resp.StatusCode, errResp.Error)
+		}
+		return nil, fmt.Errorf("plugin %s replied with status %d", target, resp.StatusCode)
+	}
+
+	var collectResp CollectResponse
+	if err := json.NewDecoder(resp.Body).Decode(&collectResp); err != nil {
+		return nil, fmt.Errorf("invalid response from plugin %s: %s", target, err)
+	}
+	if collectResp.APIVersion != APIVersion {
+		return nil, fmt.Errorf("plugin %s replied with unsupported apiVersion %q", target, collectResp.APIVersion)
+	}
+	return &collectResp, nil
+}
@@ -0,0 +1,113 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CheckConformance runs the conformance checks of the protocol against the
+// plugin at the given base URL. The given request must describe pods that the
+// plugin can collect the activity of - typically stand-in pods served by the
+// tests of the plugin - and their activity must not change while the checks
+// are running. It returns an error describing the first failed check.
+func CheckConformance(ctx context.Context, baseURL string, request CollectRequest) error {
+	var (
+		client     = NewClient(5 * time.Second)
+		httpClient = &http.Client{Timeout: 5 * time.Second}
+		target     = strings.TrimSuffix(baseURL, "/") + CollectPath
+	)
+	request.APIVersion = APIVersion
+
+	// only POST is allowed
+	resp, err := httpClient.Get(target)
+	if err != nil {
+		return fmt.Errorf("GET request failed: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		return fmt.Errorf("GET request: expected status %d, got %d", http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+
+	// unknown versions must be rejected, with an error response
+	unknownVersionRequest := request
+	unknownVersionRequest.APIVersion = "osiris.dm.gg/collector/v0"
+	body, err := json.Marshal(unknownVersionRequest)
+	if err != nil {
+		return err
+	}
+	resp, err = httpClient.Post(target, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("request with an unknown apiVersion failed: %s", err)
+	}
+	var errResp ErrorResponse
+	err = json.NewDecoder(resp.Body).Decode(&errResp)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		return fmt.Errorf("request with an unknown apiVersion: expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+	if err != nil || len(errResp.Error) == 0 {
+		return fmt.Errorf("request with an unknown apiVersion: expected an error response")
+	}
+
+	// a workload without pods has no activity
+	emptyRequest := request
+	emptyRequest.Pods = []Pod{}
+	collectResp, err := client.Collect(ctx, baseURL, emptyRequest)
+	if err != nil {
+		return fmt.Errorf("request without pods failed: %s", err)
+	}
+	if len(collectResp.Pods) != 0 {
+		return fmt.Errorf("request without pods: expected no activity, got %d pods", len(collectResp.Pods))
+	}
+
+	// each pod must have exactly 1 activity count
+	firstResp, err := client.Collect(ctx, baseURL, request)
+	if err != nil {
+		return fmt.Errorf("request failed: %s", err)
+	}
+	firstCounts, err := activityCountsByUID(request, firstResp)
+	if err != nil {
+		return err
+	}
+
+	// activity counts are counters, they must not decrease
+	secondResp, err := client.Collect(ctx, baseURL, request)
+	if err != nil {
+		return fmt.Errorf("second request failed: %s", err)
+	}
+	secondCounts, err := activityCountsByUID(request, secondResp)
+	if err != nil {
+		return err
+	}
+	for uid, count := range secondCounts {
+		if count < firstCounts[uid] {
+			return fmt.Errorf("activity count of pod %s decreased from %d to %d", uid, firstCounts[uid], count)
+		}
+	}
+
+	return nil
+}
+
+func activityCountsByUID(request CollectRequest, response *CollectResponse) (map[string]uint64, error) {
+	counts := map[string]uint64{}
+	for _, activity := range response.Pods {
+		if _, found := counts[activity.UID]; found {
+			return nil, fmt.Errorf("duplicate activity for pod %s", activity.UID)
+		}
+		counts[activity.UID] = activity.ActivityCount
+	}
+	for _, pod := range request.Pods {
+		if _, found := counts[pod.UID]; !found {
+			return nil, fmt.Errorf("missing activity for pod %s", pod.UID)
+		}
+	}
+	if len(counts) != len(request.Pods) {
+		return nil, fmt.Errorf("expected activity for %d pods, got %d", len(request.Pods), len(counts))
+	}
+	return counts, nil
+}
@@ -0,0 +1,75 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/golang/glog"
+)
+
+// Collector is implemented by the plugins to collect the activity of the pods
+// of a workload.
+type Collector interface {
+	Collect(ctx context.Context, request CollectRequest) ([]PodActivity, error)
+}
+
+// CollectorFunc is an adapter to use ordinary functions as Collectors
+type CollectorFunc func(ctx context.Context, request CollectRequest) ([]PodActivity, error)
+
+// Collect calls f(ctx, request)
+func (f CollectorFunc) Collect(ctx context.Context, request CollectRequest) ([]PodActivity, error) {
+	return f(ctx, request)
+}
+
+// NewHandler returns an http.Handler serving the collect endpoint of the
+// protocol on top of the given Collector. It takes care of the protocol
+// details - methods, versions, encoding - so that plugins only have to
+// implement a Collector.
+func NewHandler(collector Collector) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(CollectPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method))
+			return
+		}
+
+		var request CollectRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %s", err))
+			return
+		}
+		if request.APIVersion != APIVersion {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported apiVersion %q", request.APIVersion))
+			return
+		}
+
+		activities, err := collector.Collect(r.Context(), request)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if activities == nil {
+			activities = []PodActivity{}
+		}
+		writeJSON(w, http.StatusOK, CollectResponse{
+			APIVersion: APIVersion,
+			Pods:       activities,
+		})
+	})
+	return mux
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, ErrorResponse{Error: message})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		glog.Errorf("Error writing collector plugin response: %s", err)
+	}
+}
@@ -0,0 +1,73 @@
+// Package plugin defines the protocol between the Osiris zeroscaler and the
+// external metrics collectors - or plugins. It allows to build custom activity
+// signals without changing Osiris.
+//
+// The protocol is a simple HTTP/JSON protocol. On each metrics check, the
+// zeroscaler sends a POST request to the CollectPath of the plugin, with a
+// CollectRequest describing the workload and its pods. The plugin replies
+// with a CollectResponse containing an activity count for each pod. An
+// activity count is a counter: it must never decrease for a given pod, and
+// the workload is considered idle when the counts of all its pods stay the
+// same between 2 checks.
+//
+// Errors are returned with a non-200 HTTP status code and an ErrorResponse.
+package plugin
+
+import (
+	"encoding/json"
+)
+
+const (
+	// APIVersion is the version of the protocol
+	APIVersion = "osiris.dm.gg/collector/v1"
+	// CollectPath is the path of the collect endpoint of the plugins
+	CollectPath = "/v1/collect"
+)
+
+// CollectRequest is the request sent by the zeroscaler to a plugin
+type CollectRequest struct {
+	APIVersion string   `json:"apiVersion"`
+	Workload   Workload `json:"workload"`
+	Pods       []Pod    `json:"pods"`
+	// Config is the plugin-specific configuration, as written in the
+	// metricsCollector annotation of the workload
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// Workload identifies the workload whose activity is collected
+type Workload struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// Pod is a pod of the workload
+type Pod struct {
+	Name     string            `json:"name"`
+	UID      string            `json:"uid"`
+	IP       string            `json:"ip"`
+	NodeName string            `json:"nodeName,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	// Ports are the named container ports of the pod, by name
+	Ports map[string]int32 `json:"ports,omitempty"`
+}
+
+// CollectResponse is the response of a plugin to a CollectRequest
+type CollectResponse struct {
+	APIVersion string        `json:"apiVersion"`
+	Pods       []PodActivity `json:"pods"`
+}
+
+// PodActivity is the activity count of a single pod
+type PodActivity struct {
+	// UID is the UID of the pod, as sent in the request
+	UID string `json:"uid"`
+	// ActivityCount is a counter of the activity of the pod - for example a
+	// number of requests or processed messages
+	ActivityCount uint64 `json:"activityCount"`
+}
+
+// ErrorResponse is the body of the responses with a non-200 status code
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
@@ -0,0 +1,118 @@
+// Package reference is the reference implementation of a collector plugin.
+// It collects the request counts exposed by the pods on an HTTP endpoint in
+// the Osiris proxy format - by default the Osiris proxy itself - and can be
+// used as a starting point to build custom plugins.
+package reference
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dailymotion-oss/osiris/pkg/metrics"
+	"github.com/dailymotion-oss/osiris/pkg/metrics/plugin"
+)
+
+const (
+	defaultPortName = "osiris-metrics"
+	defaultPath     = "/metrics"
+)
+
+// Config is the plugin-specific configuration, sent by the zeroscaler in the
+// config field of the requests.
+type Config struct {
+	// PortName is the name of the container port exposing the request count.
+	// Default to the Osiris proxy metrics port.
+	PortName string `json:"portName"`
+	// Path is the path of the request count endpoint
+	Path string `json:"path"`
+}
+
+type collector struct {
+	httpClient *http.Client
+}
+
+// NewCollector returns the reference Collector
+func NewCollector() plugin.Collector {
+	return &collector{
+		httpClient: &http.Client{
+			Timeout: 2 * time.Second,
+		},
+	}
+}
+
+// NewHandler returns an http.Handler serving the reference plugin
+func NewHandler() http.Handler {
+	return plugin.NewHandler(NewCollector())
+}
+
+func (c *collector) Collect(
+	ctx context.Context,
+	request plugin.CollectRequest,
+) ([]plugin.PodActivity, error) {
+	var cfg Config
+	if len(request.Config) > 0 {
+		if err := json.Unmarshal(request.Config, &cfg); err != nil {
+			return nil, fmt.Errorf("invalid config: %s", err)
+		}
+	}
+	if len(cfg.PortName) == 0 {
+		cfg.PortName = defaultPortName
+	}
+	if len(cfg.Path) == 0 {
+		cfg.Path = defaultPath
+	}
+
+	var (
+		activities = make([]plugin.PodActivity, len(request.Pods))
+		errs       = make([]error, len(request.Pods))
+		wg         sync.WaitGroup
+	)
+	for i, pod := range request.Pods {
+		wg.Add(1)
+		go func(i int, pod plugin.Pod) {
+			defer wg.Done()
+			count, err := c.requestCount(ctx, pod, cfg)
+			activities[i] = plugin.PodActivity{
+				UID:           pod.UID,
+				ActivityCount: count,
+			}
+			errs[i] = err
+		}(i, pod)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return activities, nil
+}
+
+func (c *collector) requestCount(ctx context.Context, pod plugin.Pod, cfg Config) (uint64, error) {
+	port, found := pod.Ports[cfg.PortName]
+	if !found {
+		return 0, fmt.Errorf("pod %s has no port named %s", pod.Name, cfg.PortName)
+	}
+	target := fmt.Sprintf("http://%s:%d%s", pod.IP, port, cfg.Path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error requesting metrics from %s: %s", target, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected HTTP response code %d when requesting metrics from %s", resp.StatusCode, target)
+	}
+	var prc metrics.ProxyRequestCount
+	if err := json.NewDecoder(resp.Body).Decode(&prc); err != nil {
+		return 0, fmt.Errorf("error decoding metrics from %s: %s", target, err)
+	}
+	return prc.RequestCount, nil
+}
@@ -0,0 +1,132 @@
+package reference
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dailymotion-oss/osiris/pkg/metrics"
+	"github.com/dailymotion-oss/osiris/pkg/metrics/plugin"
+)
+
+// newStandInPod starts a server exposing the given request count in the
+// Osiris proxy format, and returns the matching plugin pod.
+func newStandInPod(t *testing.T, uid string, requestCount uint64) plugin.Pod {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != defaultPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(metrics.ProxyRequestCount{
+			ProxyID:      uid,
+			RequestCount: requestCount,
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	host, rawPort, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(rawPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plugin.Pod{
+		Name: fmt.Sprintf("pod-%s", uid),
+		UID:  uid,
+		IP:   host,
+		Ports: map[string]int32{
+			defaultPortName: int32(port),
+		},
+	}
+}
+
+func TestConformance(t *testing.T) {
+	server := httptest.NewServer(NewHandler())
+	defer server.Close()
+
+	err := plugin.CheckConformance(context.Background(), server.URL, plugin.CollectRequest{
+		Workload: plugin.Workload{
+			Kind:      "Deployment",
+			Namespace: "default",
+			Name:      "my-app",
+		},
+		Pods: []plugin.Pod{
+			newStandInPod(t, "uid-1", 3),
+			newStandInPod(t, "uid-2", 0),
+		},
+	})
+	assert.NoError(t, err)
+}
+
+func TestConformanceFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		collector plugin.CollectorFunc
+	}{
+		{
+			name: "missing pod",
+			collector: func(context.Context, plugin.CollectRequest) ([]plugin.PodActivity, error) {
+				return []plugin.PodActivity{}, nil
+			},
+		},
+		{
+			name: "duplicate pod",
+			collector: func(_ context.Context, request plugin.CollectRequest) ([]plugin.PodActivity, error) {
+				activities := []plugin.PodActivity{}
+				for _, pod := range request.Pods {
+					activities = append(activities,
+						plugin.PodActivity{UID: pod.UID},
+						plugin.PodActivity{UID: pod.UID},
+					)
+				}
+				return activities, nil
+			},
+		},
+		{
+			name: "decreasing counter",
+			collector: func() plugin.CollectorFunc {
+				count := uint64(10)
+				return func(_ context.Context, request plugin.CollectRequest) ([]plugin.PodActivity, error) {
+					activities := []plugin.PodActivity{}
+					for _, pod := range request.Pods {
+						activities = append(activities, plugin.PodActivity{UID: pod.UID, ActivityCount: count})
+					}
+					count--
+					return activities, nil
+				}
+			}(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(plugin.NewHandler(test.collector))
+			defer server.Close()
+
+			err := plugin.CheckConformance(context.Background(), server.URL, plugin.CollectRequest{
+				Pods: []plugin.Pod{{Name: "pod", UID: "uid"}},
+			})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCollectUnreachablePod(t *testing.T) {
+	server := httptest.NewServer(NewHandler())
+	defer server.Close()
+
+	_, err := plugin.NewClient(5*time.Second).Collect(context.Background(), server.URL, plugin.CollectRequest{
+		Pods: []plugin.Pod{{Name: "pod", UID: "uid", IP: "127.0.0.1"}},
+	})
+	assert.Error(t, err)
+}